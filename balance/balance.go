@@ -0,0 +1,384 @@
+// Package balance contains client side load balancing across multiple
+// endpoints.
+//
+// Balancer is cliware middleware that attaches itself to request context.
+// Actual endpoint selection is done by RoundTripper returned by NewTransport,
+// for every attempt to send request, so retried requests can go to different
+// endpoint. Clients created with gwc.New already use this RoundTripper.
+package balance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+// Endpoint is single backend that requests can be sent to.
+type Endpoint struct {
+	URL *url.URL
+
+	mu                  sync.Mutex
+	priority            int
+	weight              int
+	outstanding         int
+	consecutiveFailures int
+	ejectedUntil        time.Time
+	unhealthy           bool
+}
+
+// Outstanding returns number of requests currently in flight to endpoint.
+func (e *Endpoint) Outstanding() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.outstanding
+}
+
+// Available returns true if endpoint is neither ejected because of failures
+// nor marked unhealthy by health checks.
+func (e *Endpoint) Available() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.available(time.Now())
+}
+
+func (e *Endpoint) available(now time.Time) bool {
+	return !e.unhealthy && !now.Before(e.ejectedUntil)
+}
+
+// String returns URL of endpoint.
+func (e *Endpoint) String() string {
+	return e.URL.String()
+}
+
+// Balancer distributes requests across endpoints using configured strategy.
+type Balancer struct {
+	mu        sync.RWMutex
+	endpoints []*Endpoint
+	strategy  Strategy
+
+	maxFailures int
+	ejectFor    time.Duration
+}
+
+// New creates and returns balancer that distributes requests across provided
+// URLs using provided strategy. Only scheme and host of URLs are used.
+func New(strategy Strategy, rawURLs ...string) (*Balancer, error) {
+	urls, err := parseURLs(rawURLs)
+	if err != nil {
+		return nil, err
+	}
+	b := &Balancer{strategy: strategy}
+	b.SetEndpoints(urls)
+	return b, nil
+}
+
+func parseURLs(rawURLs []string) ([]*url.URL, error) {
+	if len(rawURLs) == 0 {
+		return nil, fmt.Errorf("balance: no endpoints provided")
+	}
+	urls := make([]*url.URL, 0, len(rawURLs))
+	for _, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("balance: endpoint %q has no host", raw)
+		}
+		if u.Scheme == "" {
+			u.Scheme = "https"
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
+
+// Target is URL of endpoint with its priority and weight, like in DNS SRV
+// records.
+type Target struct {
+	URL *url.URL
+	// Priority of endpoint. Only available endpoints with lowest priority
+	// are used, endpoints with higher priority are used when none of them
+	// is available.
+	Priority int
+	// Weight of endpoint, relative to other endpoints with same priority.
+	// If any of them has weight, strategy picks endpoints in proportion to
+	// their weights and endpoints with zero weight are used only when all
+	// endpoints with weight are unavailable.
+	Weight int
+}
+
+// SetEndpoints replaces endpoints of this balancer with endpoints with
+// same priority and no weight. State (like outstanding requests and
+// ejection) of endpoints with same scheme and host as existing ones is
+// preserved.
+func (b *Balancer) SetEndpoints(urls []*url.URL) {
+	targets := make([]Target, len(urls))
+	for i, u := range urls {
+		targets[i] = Target{URL: u}
+	}
+	b.SetTargets(targets)
+}
+
+// SetTargets replaces endpoints of this balancer with provided targets.
+// State of endpoints with same scheme and host as existing ones is
+// preserved, same as with SetEndpoints. Scheme of URLs without it is https,
+// same as with New.
+func (b *Balancer) SetTargets(targets []Target) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	existing := make(map[string]*Endpoint, len(b.endpoints))
+	for _, e := range b.endpoints {
+		existing[e.URL.Scheme+"://"+e.URL.Host] = e
+	}
+	endpoints := make([]*Endpoint, 0, len(targets))
+	for _, t := range targets {
+		if t.URL.Scheme == "" {
+			u := *t.URL
+			u.Scheme = "https"
+			t.URL = &u
+		}
+		e, ok := existing[t.URL.Scheme+"://"+t.URL.Host]
+		if !ok {
+			e = &Endpoint{URL: t.URL}
+		}
+		e.mu.Lock()
+		e.priority, e.weight = t.Priority, t.Weight
+		e.mu.Unlock()
+		endpoints = append(endpoints, e)
+	}
+	b.endpoints = endpoints
+}
+
+// OutlierEjection enables passive outlier ejection. Endpoint that fails
+// maxFailures times in a row (connection error or status code 500+) is not
+// used for provided duration.
+func (b *Balancer) OutlierEjection(maxFailures int, ejectFor time.Duration) *Balancer {
+	b.maxFailures = maxFailures
+	b.ejectFor = ejectFor
+	return b
+}
+
+// Endpoints returns all endpoints of this balancer.
+func (b *Balancer) Endpoints() []*Endpoint {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.endpoints
+}
+
+// Exec is implementation of cliware.Middleware interface. It sets balancer
+// to request context.
+func (b *Balancer) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, balancerKey, &target{balancer: b})
+	}).Exec(next)
+}
+
+// pick returns endpoint that next request should be sent to. If no endpoint
+// is available, all of them are considered.
+func (b *Balancer) pick(req *http.Request) *Endpoint {
+	all := b.Endpoints()
+	if len(all) == 0 {
+		return nil
+	}
+	now := time.Now()
+	available := make([]candidate, 0, len(all))
+	candidates := make([]candidate, 0, len(all))
+	for _, e := range all {
+		e.mu.Lock()
+		c := candidate{endpoint: e, priority: e.priority, weight: e.weight}
+		if e.available(now) {
+			available = append(available, c)
+		}
+		e.mu.Unlock()
+		candidates = append(candidates, c)
+	}
+	if len(available) > 0 {
+		candidates = available
+	}
+	return b.strategy.Pick(weighted(candidates), req)
+}
+
+// candidate is endpoint with priority and weight it had when request was
+// sent.
+type candidate struct {
+	endpoint *Endpoint
+	priority int
+	weight   int
+}
+
+// maxShares limits number of times endpoints are repeated for weights.
+const maxShares = 100
+
+// weighted returns endpoints with lowest priority among provided ones. If
+// any of them has weight, endpoints are repeated in proportion to their
+// weights, so strategies that pick endpoints uniformly honor weights.
+func weighted(candidates []candidate) []*Endpoint {
+	lowest := candidates[0].priority
+	for _, c := range candidates {
+		if c.priority < lowest {
+			lowest = c.priority
+		}
+	}
+	var preferred []candidate
+	total, divisor := 0, 0
+	for _, c := range candidates {
+		if c.priority != lowest {
+			continue
+		}
+		preferred = append(preferred, c)
+		if c.weight > 0 {
+			total += c.weight
+			divisor = gcd(divisor, c.weight)
+		}
+	}
+	endpoints := make([]*Endpoint, 0, len(preferred))
+	if total == 0 {
+		for _, c := range preferred {
+			endpoints = append(endpoints, c.endpoint)
+		}
+		return endpoints
+	}
+	for _, c := range preferred {
+		if c.weight <= 0 {
+			continue
+		}
+		shares := c.weight / divisor
+		if total/divisor > maxShares {
+			shares = c.weight * maxShares / total
+			if shares == 0 {
+				shares = 1
+			}
+		}
+		for i := 0; i < shares; i++ {
+			endpoints = append(endpoints, c.endpoint)
+		}
+	}
+	return endpoints
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// Send sends provided request to endpoint chosen by this balancer, using
+// provided RoundTripper. Scheme and host of request URL are replaced with
+// ones from chosen endpoint. Request is outstanding until body of its
+// response is closed.
+func (b *Balancer) Send(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	e := b.pick(req)
+	if e == nil {
+		return nil, fmt.Errorf("balance: no endpoints available")
+	}
+	r := req.Clone(req.Context())
+	r.Body = req.Body
+	r.URL.Scheme = e.URL.Scheme
+	r.URL.Host = e.URL.Host
+	r.Host = ""
+
+	b.started(e)
+	resp, err := next.RoundTrip(r)
+	b.finished(e, err != nil || resp.StatusCode >= 500)
+	if err != nil || resp.Body == nil {
+		b.done(e)
+		return resp, err
+	}
+	resp.Body = &doneBody{ReadCloser: resp.Body, done: func() { b.done(e) }}
+	return resp, nil
+}
+
+func (b *Balancer) started(e *Endpoint) {
+	e.mu.Lock()
+	e.outstanding++
+	e.mu.Unlock()
+}
+
+// done marks request to provided endpoint as no longer outstanding.
+func (b *Balancer) done(e *Endpoint) {
+	e.mu.Lock()
+	e.outstanding--
+	e.mu.Unlock()
+}
+
+// finished records result of request to provided endpoint.
+func (b *Balancer) finished(e *Endpoint, failed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !failed {
+		e.consecutiveFailures = 0
+		return
+	}
+	e.consecutiveFailures++
+	if b.maxFailures > 0 && e.consecutiveFailures >= b.maxFailures {
+		e.ejectedUntil = time.Now().Add(b.ejectFor)
+		e.consecutiveFailures = 0
+	}
+}
+
+// doneBody is response body that calls done function once, when it is
+// closed.
+type doneBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *doneBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// HealthCheck starts active health checking of all endpoints. Every interval
+// GET request is sent to provided path on each endpoint, and endpoints that
+// respond with error or status code 500+ are not used until they pass next
+// check. Health checks stop when provided context is done. If client is nil,
+// http.DefaultClient is used.
+func (b *Balancer) HealthCheck(ctx context.Context, client *http.Client, path string, interval time.Duration) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			b.check(ctx, client, path)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (b *Balancer) check(ctx context.Context, client *http.Client, path string) {
+	for _, e := range b.Endpoints() {
+		u := *e.URL
+		u.Path = path
+		req, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			continue
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		healthy := err == nil && resp.StatusCode < 500
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		e.mu.Lock()
+		e.unhealthy = !healthy
+		e.mu.Unlock()
+	}
+}
@@ -0,0 +1,206 @@
+package balance_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware-middlewares/retry"
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/balance"
+	"github.com/delicb/gwc/gwctest"
+)
+
+// hostRecorder is mock transport that records hosts of all requests and
+// responds with 500 for hosts marked as failing.
+type hostRecorder struct {
+	mu      sync.Mutex
+	hosts   []string
+	failing map[string]bool
+}
+
+func (r *hostRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts = append(r.hosts, req.URL.Host)
+	status := 200
+	if r.failing[req.URL.Host] {
+		status = 500
+	}
+	return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+}
+
+func newClient(recorder *hostRecorder, b *balance.Balancer) *gwc.Client {
+	return gwc.New(&http.Client{Transport: recorder}, b)
+}
+
+func mustNew(t *testing.T, strategy balance.Strategy, urls ...string) *balance.Balancer {
+	b, err := balance.New(strategy, urls...)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	return b
+}
+
+func TestRoundRobin(t *testing.T) {
+	recorder := &hostRecorder{}
+	b := mustNew(t, balance.RoundRobin(), "http://a", "http://b", "http://c")
+	client := newClient(recorder, b)
+	for i := 0; i < 6; i++ {
+		if _, err := client.Get().Path("/users").Send(); err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+	}
+	expected := []string{"a", "b", "c", "a", "b", "c"}
+	for i := range expected {
+		if recorder.hosts[i] != expected[i] {
+			t.Fatalf("Wrong hosts. Got: %v, expected: %v", recorder.hosts, expected)
+		}
+	}
+}
+
+func TestRetryGoesToDifferentEndpoint(t *testing.T) {
+	recorder := &hostRecorder{failing: map[string]bool{"a": true}}
+	b := mustNew(t, balance.RoundRobin(), "http://a", "http://b")
+	client := newClient(recorder, b)
+	client.Use(retry.SetClassifier(retry.ErrorOr500Plus))
+	client.Use(retry.SetBackoffStrategy(retry.ConstantBackoff(0)))
+	resp, err := client.Get().Path("/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Wrong status code. Got: %d, expected: 200", resp.StatusCode)
+	}
+	if len(recorder.hosts) != 2 || recorder.hosts[0] != "a" || recorder.hosts[1] != "b" {
+		t.Errorf("Wrong hosts. Got: %v, expected: [a b]", recorder.hosts)
+	}
+}
+
+func TestOutlierEjection(t *testing.T) {
+	recorder := &hostRecorder{failing: map[string]bool{"a": true}}
+	b := mustNew(t, balance.RoundRobin(), "http://a", "http://b").OutlierEjection(1, time.Hour)
+	client := newClient(recorder, b)
+	for i := 0; i < 4; i++ {
+		client.Post().Path("/").Send()
+	}
+	expected := []string{"a", "b", "b", "b"}
+	for i := range expected {
+		if recorder.hosts[i] != expected[i] {
+			t.Fatalf("Wrong hosts. Got: %v, expected: %v", recorder.hosts, expected)
+		}
+	}
+	if b.Endpoints()[0].Available() {
+		t.Error("Failing endpoint not ejected.")
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	recorder := &hostRecorder{}
+	strategy := balance.ConsistentHash(func(req *http.Request) string {
+		return req.URL.Query().Get("user")
+	})
+	b := mustNew(t, strategy, "http://a", "http://b", "http://c")
+	client := newClient(recorder, b)
+	for i := 0; i < 5; i++ {
+		client.Get().Path("/").SetQuery("user", "john").Send()
+	}
+	for _, h := range recorder.hosts {
+		if h != recorder.hosts[0] {
+			t.Fatalf("Same key sent to different hosts: %v", recorder.hosts)
+		}
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	b := mustNew(t, balance.LeastOutstanding(), "http://a", "http://b")
+	e := b.Endpoints()
+	got := balance.LeastOutstanding().Pick(e, nil)
+	if got != e[0] {
+		t.Errorf("Wrong endpoint. Got: %s, expected: %s", got, e[0])
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	mock := gwctest.New(t)
+	mock.Expect().Match(func(r *http.Request) bool { return r.URL.Host == "a" }).AnyTimes().Respond().Status(503)
+	mock.Expect().AnyTimes()
+
+	b := mustNew(t, balance.RoundRobin(), "http://a", "http://b")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.HealthCheck(ctx, mock.HTTPClient(), "/health", time.Hour)
+
+	deadline := time.Now().Add(time.Second)
+	for b.Endpoints()[0].Available() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if b.Endpoints()[0].Available() {
+		t.Error("Unhealthy endpoint still available.")
+	}
+	if !b.Endpoints()[1].Available() {
+		t.Error("Healthy endpoint not available.")
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := balance.New(balance.RoundRobin()); err == nil {
+		t.Error("Expected error for no endpoints.")
+	}
+	if _, err := balance.New(balance.RoundRobin(), "/path-only"); err == nil {
+		t.Error("Expected error for endpoint without host.")
+	}
+}
+
+func TestOutstandingUntilBodyClosed(t *testing.T) {
+	recorder := &hostRecorder{}
+	b := mustNew(t, balance.LeastOutstanding(), "http://a")
+	client := newClient(recorder, b)
+	resp, err := client.Get().Path("/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	e := b.Endpoints()[0]
+	if got := e.Outstanding(); got != 1 {
+		t.Errorf("Wrong outstanding requests before body is closed. Got: %d, expected: 1", got)
+	}
+	resp.Body.Close()
+	resp.Body.Close()
+	if got := e.Outstanding(); got != 0 {
+		t.Errorf("Wrong outstanding requests after body is closed. Got: %d, expected: 0", got)
+	}
+}
+
+func TestRedirectToOtherHost(t *testing.T) {
+	var mu sync.Mutex
+	var hosts []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		hosts = append(hosts, req.URL.Host)
+		mu.Unlock()
+		resp := &http.Response{StatusCode: 200, Header: http.Header{}, Body: http.NoBody, Request: req}
+		if req.URL.Path == "/redirect" {
+			resp.StatusCode = http.StatusFound
+			resp.Header.Set("Location", "http://external.example.com/landing")
+		}
+		return resp, nil
+	})
+	b := mustNew(t, balance.RoundRobin(), "http://a", "http://b")
+	client := gwc.New(&http.Client{Transport: transport}, b)
+	resp, err := client.Get().URL("http://service/redirect").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	resp.Body.Close()
+	if len(hosts) != 2 || hosts[0] != "a" || hosts[1] != "external.example.com" {
+		t.Errorf("Wrong hosts. Got: %v, expected: [a external.example.com]", hosts)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
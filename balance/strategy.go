@@ -0,0 +1,154 @@
+package balance
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Strategy chooses one of provided endpoints for request. Provided slice is
+// never empty. It contains available endpoints with lowest priority, and
+// endpoints with weights are repeated in proportion to them, so strategies
+// that pick endpoints uniformly (like RoundRobin and Random) honor weights.
+type Strategy interface {
+	Pick(endpoints []*Endpoint, req *http.Request) *Endpoint
+}
+
+// StrategyFunc is adapter that allows usage of ordinary function as Strategy.
+type StrategyFunc func(endpoints []*Endpoint, req *http.Request) *Endpoint
+
+// Pick is implementation of Strategy interface.
+func (f StrategyFunc) Pick(endpoints []*Endpoint, req *http.Request) *Endpoint {
+	return f(endpoints, req)
+}
+
+// RoundRobin returns strategy that picks endpoints in turn.
+func RoundRobin() Strategy {
+	var mu sync.Mutex
+	next := 0
+	return StrategyFunc(func(endpoints []*Endpoint, req *http.Request) *Endpoint {
+		mu.Lock()
+		defer mu.Unlock()
+		e := endpoints[next%len(endpoints)]
+		next++
+		return e
+	})
+}
+
+// lockedRand is random source safe for concurrent use.
+type lockedRand struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func (r *lockedRand) Intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rnd.Intn(n)
+}
+
+// Random returns strategy that picks random endpoint. Provided seed is used
+// for random source.
+func Random(seed int64) Strategy {
+	rnd := &lockedRand{rnd: rand.New(rand.NewSource(seed))}
+	return StrategyFunc(func(endpoints []*Endpoint, req *http.Request) *Endpoint {
+		return endpoints[rnd.Intn(len(endpoints))]
+	})
+}
+
+// LeastOutstanding returns strategy that picks endpoint with least requests
+// in flight. First such endpoint is picked if there are more of them.
+func LeastOutstanding() Strategy {
+	return StrategyFunc(func(endpoints []*Endpoint, req *http.Request) *Endpoint {
+		best := endpoints[0]
+		for _, e := range endpoints[1:] {
+			if e.Outstanding() < best.Outstanding() {
+				best = e
+			}
+		}
+		return best
+	})
+}
+
+// PowerOfTwo returns strategy that picks two random endpoints and uses one
+// with less requests in flight. Provided seed is used for random source.
+func PowerOfTwo(seed int64) Strategy {
+	rnd := &lockedRand{rnd: rand.New(rand.NewSource(seed))}
+	return StrategyFunc(func(endpoints []*Endpoint, req *http.Request) *Endpoint {
+		first := endpoints[rnd.Intn(len(endpoints))]
+		second := endpoints[rnd.Intn(len(endpoints))]
+		if second.Outstanding() < first.Outstanding() {
+			return second
+		}
+		return first
+	})
+}
+
+// replicas is number of points on hash ring for each endpoint.
+const replicas = 100
+
+// ConsistentHash returns strategy that picks endpoint based on consistent
+// hashing of key returned by provided function, so that requests with same
+// key go to same endpoint as long as it is available.
+func ConsistentHash(key func(req *http.Request) string) Strategy {
+	return &consistentHash{key: key}
+}
+
+type ringPoint struct {
+	hash     uint32
+	endpoint *Endpoint
+}
+
+type consistentHash struct {
+	key func(req *http.Request) string
+
+	mu        sync.Mutex
+	endpoints []*Endpoint
+	ring      []ringPoint
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+func (c *consistentHash) Pick(endpoints []*Endpoint, req *http.Request) *Endpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !sameEndpoints(c.endpoints, endpoints) {
+		c.build(endpoints)
+	}
+	h := hash(c.key(req))
+	i := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= h })
+	if i == len(c.ring) {
+		i = 0
+	}
+	return c.ring[i].endpoint
+}
+
+func (c *consistentHash) build(endpoints []*Endpoint) {
+	c.endpoints = append([]*Endpoint(nil), endpoints...)
+	c.ring = make([]ringPoint, 0, len(endpoints)*replicas)
+	for _, e := range endpoints {
+		for i := 0; i < replicas; i++ {
+			c.ring = append(c.ring, ringPoint{hash: hash(e.URL.Host + "#" + strconv.Itoa(i)), endpoint: e})
+		}
+	}
+	sort.Slice(c.ring, func(i, j int) bool { return c.ring[i].hash < c.ring[j].hash })
+}
+
+func sameEndpoints(a, b []*Endpoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
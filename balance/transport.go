@@ -0,0 +1,68 @@
+package balance
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type balancerKeyType string
+
+var balancerKey balancerKeyType = "balancer"
+
+// target is balancer set to context of single request, with host of that
+// request. Requests with same context and other host (like redirects to
+// other servers) are not balanced.
+type target struct {
+	balancer *Balancer
+
+	mu   sync.Mutex
+	host string
+	seen bool
+}
+
+// balanced reports if request with provided host should be balanced. Host
+// of first request is remembered, and only requests with same host are
+// balanced.
+func (t *target) balanced(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.seen {
+		t.host, t.seen = host, true
+	}
+	return t.host == host
+}
+
+// FromContext returns balancer set to provided context or nil if there is
+// none.
+func FromContext(ctx context.Context) *Balancer {
+	if t, ok := ctx.Value(balancerKey).(*target); ok {
+		return t.balancer
+	}
+	return nil
+}
+
+// NewTransport returns RoundTripper that sends each request to endpoint
+// chosen by balancer from request context, by replacing scheme and host of
+// request URL. Requests without balancer in context are sent unchanged, as
+// well as requests with host other than host of first request sent with
+// same context, like redirects to other servers. If next is nil,
+// http.DefaultTransport is used.
+func NewTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	to, ok := req.Context().Value(balancerKey).(*target)
+	if !ok || !to.balanced(req.URL.Host) {
+		return t.next.RoundTrip(req)
+	}
+	return to.balancer.Send(t.next, req)
+}
@@ -0,0 +1,218 @@
+package gwc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// BatchResult holds result of single request sent as part of a batch.
+type BatchResult struct {
+	// Index is position of request in list of requests provided to batch.
+	Index    int
+	Request  *Request
+	Response *Response
+	Err      error
+}
+
+// BatchError aggregates errors of all failed requests in a batch.
+type BatchError struct {
+	Results []*BatchResult
+}
+
+// Error is implementation of error interface.
+func (e *BatchError) Error() string {
+	msgs := make([]string, len(e.Results))
+	for i, r := range e.Results {
+		msgs[i] = fmt.Sprintf("request %d: %v", r.Index, r.Err)
+	}
+	return fmt.Sprintf("gwc: %d requests in batch failed: %s", len(e.Results), strings.Join(msgs, "; "))
+}
+
+// Batch sends multiple requests concurrently.
+type Batch struct {
+	parallelism int
+	failFast    bool
+}
+
+// NewBatch creates and returns new batch with default configuration: all
+// requests are sent at once and all of them are sent even if some fail.
+func (c *Client) NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Batch sends all provided requests concurrently, with default batch
+// configuration, and returns their results in same order as requests.
+// See Batch.Do for details.
+func (c *Client) Batch(ctx context.Context, requests ...*Request) ([]*BatchResult, error) {
+	return c.NewBatch().Do(ctx, requests...)
+}
+
+// Parallelism sets maximum number of requests sent at the same time. Zero
+// or negative value means no limit.
+func (b *Batch) Parallelism(n int) *Batch {
+	b.parallelism = n
+	return b
+}
+
+// FailFast configures batch to cancel all requests in flight and not to send
+// new ones as soon as any request fails.
+func (b *Batch) FailFast() *Batch {
+	b.failFast = true
+	return b
+}
+
+// Do sends all provided requests and returns their results in same order as
+// requests. Provided context is used for all requests, in addition to
+// context that request already has, so its deadline is shared by whole
+// batch. If any request failed, *BatchError is returned together with
+// results.
+func (b *Batch) Do(ctx context.Context, requests ...*Request) ([]*BatchResult, error) {
+	results := make([]*BatchResult, len(requests))
+	for r := range b.Stream(ctx, requests...) {
+		results[r.Index] = r
+	}
+	var failed []*BatchResult
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) > 0 {
+		return results, &BatchError{Results: failed}
+	}
+	return results, nil
+}
+
+// Stream sends all provided requests and returns channel that yields their
+// results in order of completion. Channel is closed when all requests are
+// done. Result is yielded for every request, including ones that were not
+// sent because batch was canceled or aborted. Provided requests are not
+// changed, batch sends their copies, so they can be sent again.
+func (b *Batch) Stream(ctx context.Context, requests ...*Request) <-chan *BatchResult {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	out := make(chan *BatchResult, len(requests))
+
+	parallelism := b.parallelism
+	if parallelism <= 0 || parallelism > len(requests) {
+		parallelism = len(requests)
+	}
+	sem := make(chan struct{}, parallelism)
+
+	// in flight requests are canceled if batch is aborted, but requests
+	// that are already done are not, so their bodies can still be read.
+	// Context of done request is released when its body is closed.
+	var mu sync.Mutex
+	inFlight := make(map[int]context.CancelFunc)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	abort := func() {
+		stopOnce.Do(func() {
+			close(stop)
+			mu.Lock()
+			for _, cancel := range inFlight {
+				cancel()
+			}
+			mu.Unlock()
+		})
+	}
+
+	var wg sync.WaitGroup
+	go func() {
+		defer close(out)
+		for i, r := range requests {
+			result := &BatchResult{Index: i, Request: r}
+			select {
+			case sem <- struct{}{}:
+			case <-stop:
+			case <-ctx.Done():
+			}
+			if err := batchStopped(ctx, stop); err != nil {
+				result.Err = err
+				out <- result
+				continue
+			}
+
+			done := make(chan struct{})
+			reqCtx, cancel := requestContext(ctx, r, done)
+			mu.Lock()
+			inFlight[i] = cancel
+			mu.Unlock()
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				result.Response, result.Err = result.Request.copy(reqCtx).Send()
+				close(done)
+				if result.Err == nil && result.Response.Body != nil {
+					result.Response.Body = &cancelBody{ReadCloser: result.Response.Body, cancel: cancel}
+				} else {
+					cancel()
+				}
+				mu.Lock()
+				delete(inFlight, i)
+				mu.Unlock()
+				if result.Err != nil && b.failFast {
+					abort()
+				}
+				out <- result
+			}(i)
+		}
+		wg.Wait()
+	}()
+	return out
+}
+
+// cancelBody is response body that cancels request context when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// ErrBatchAborted is error set to results of requests that were not sent
+// because other request in fail fast batch failed.
+var ErrBatchAborted = errors.New("gwc: request not sent, batch aborted")
+
+// batchStopped returns error if no more requests should be sent.
+func batchStopped(ctx context.Context, stop chan struct{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case <-stop:
+		return ErrBatchAborted
+	default:
+		return nil
+	}
+}
+
+// requestContext returns context for request sent in batch. If request
+// already has context, returned context is derived from it, but it is also
+// canceled when batch context is done before done channel is closed.
+func requestContext(ctx context.Context, r *Request, done chan struct{}) (context.Context, context.CancelFunc) {
+	if r.Context() == nil {
+		return context.WithCancel(ctx)
+	}
+	reqCtx, cancel := context.WithCancel(r.Context())
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-reqCtx.Done():
+		case <-done:
+		}
+	}()
+	return reqCtx, cancel
+}
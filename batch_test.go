@@ -0,0 +1,183 @@
+package gwc_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/gwc"
+)
+
+func TestClient_Batch(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	})
+	client := gwc.NewForHandler(handler)
+	results, err := client.Batch(context.Background(),
+		client.Get().URL("http://service/a"),
+		client.Get().URL("http://service/b"),
+		client.Get().URL("http://service/c"),
+	)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for i, expected := range []string{"/a", "/b", "/c"} {
+		if results[i].Index != i {
+			t.Errorf("Wrong result index. Got: %d, expected: %d", results[i].Index, i)
+		}
+		body, err := results[i].Response.String()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if body != expected {
+			t.Errorf("Wrong body. Got: %s, expected: %s", body, expected)
+		}
+	}
+}
+
+func TestBatch_Parallelism(t *testing.T) {
+	var current, max int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+	})
+	client := gwc.NewForHandler(handler)
+	var requests []*gwc.Request
+	for i := 0; i < 10; i++ {
+		requests = append(requests, client.Get().URL("http://service/"))
+	}
+	if _, err := client.NewBatch().Parallelism(2).Do(context.Background(), requests...); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if got := atomic.LoadInt32(&max); got > 2 {
+		t.Errorf("Too many concurrent requests. Got: %d, expected at most 2", got)
+	}
+}
+
+func TestBatch_FailFast(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			panic("fail")
+		}
+		<-r.Context().Done()
+	})
+	client := gwc.NewForHandler(handler)
+	results, err := client.NewBatch().Parallelism(2).FailFast().Do(context.Background(),
+		client.Post().URL("http://service/slow"),
+		client.Post().URL("http://service/fail"),
+		client.Post().URL("http://service/never"),
+	)
+	batchErr, ok := err.(*gwc.BatchError)
+	if !ok {
+		t.Fatalf("Expected BatchError, got: %v", err)
+	}
+	if len(batchErr.Results) != 3 {
+		t.Errorf("Wrong number of failed requests. Got: %d, expected: 3", len(batchErr.Results))
+	}
+	if results[0].Err == nil {
+		t.Error("Slow request not canceled.")
+	}
+	if results[2].Err != gwc.ErrBatchAborted {
+		t.Errorf("Wrong error for unsent request. Got: %v, expected: %v", results[2].Err, gwc.ErrBatchAborted)
+	}
+}
+
+func TestBatch_CollectAll(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			panic("fail")
+		}
+	})
+	client := gwc.NewForHandler(handler)
+	results, err := client.Batch(context.Background(),
+		client.Post().URL("http://service/fail"),
+		client.Post().URL("http://service/ok"),
+	)
+	batchErr, ok := err.(*gwc.BatchError)
+	if !ok || len(batchErr.Results) != 1 || batchErr.Results[0].Index != 0 {
+		t.Fatalf("Wrong batch error: %v", err)
+	}
+	if results[1].Err != nil {
+		t.Error("Got unexpected error:", results[1].Err)
+	}
+}
+
+func TestBatch_Stream(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	})
+	client := gwc.NewForHandler(handler)
+	stream := client.NewBatch().Stream(context.Background(),
+		client.Get().URL("http://service/slow"),
+		client.Get().URL("http://service/fast"),
+	)
+	first := <-stream
+	close(release)
+	if first.Index != 1 {
+		t.Errorf("Results not yielded in completion order. First index: %d", first.Index)
+	}
+	second := <-stream
+	if second.Index != 0 {
+		t.Errorf("Wrong second index: %d", second.Index)
+	}
+	if _, ok := <-stream; ok {
+		t.Error("Stream not closed after all results.")
+	}
+}
+
+func TestBatch_RequestNotModified(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	client := gwc.NewForHandler(handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	contexts := make(chan context.Context, 2)
+	req := client.Get().URL("http://service/").SetContext(ctx).Use(cliware.RequestProcessor(func(r *http.Request) error {
+		contexts <- r.Context()
+		return nil
+	}))
+
+	results, err := client.Batch(context.Background(), req)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if req.Context() != ctx {
+		t.Error("Context of request changed by batch.")
+	}
+	sent := <-contexts
+	body, err := results[0].Response.String()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body != "ok" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "ok")
+	}
+	if sent.Err() == nil {
+		t.Error("Request context not released after body was closed.")
+	}
+
+	if _, err := req.Send(); err != nil {
+		t.Error("Got unexpected error sending request again:", err)
+	}
+	if err := (<-contexts).Err(); err != nil {
+		t.Error("Request sent again with canceled context:", err)
+	}
+}
@@ -0,0 +1,174 @@
+// Package chaos contains fault injection middleware used for testing how
+// code that uses gwc behaves when things go wrong.
+//
+// Injector can be used as cliware middleware (on gwc.Client, gwc.Group or
+// single request), in which case faults are injected once per sent request.
+// It can also wrap http.RoundTripper, in which case faults are injected below
+// retry logic, so that every retry attempt can fail on its own.
+//
+// All randomness comes from seed provided to New, so test runs can be
+// reproduced.
+package chaos
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+
+	"github.com/delicb/cliware"
+)
+
+// Schedule determines if fault should be injected for n-th request (first
+// request has n equal to 1).
+type Schedule func(n int) bool
+
+// Every returns schedule that triggers on every n-th request.
+func Every(n int) Schedule {
+	return Schedule(func(i int) bool {
+		return n > 0 && i%n == 0
+	})
+}
+
+// Nth returns schedule that triggers only on provided request numbers.
+func Nth(numbers ...int) Schedule {
+	return Schedule(func(i int) bool {
+		for _, n := range numbers {
+			if n == i {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// rule defines when fault should be injected.
+type rule struct {
+	probability float64
+	schedule    Schedule
+	fault       Fault
+}
+
+func (r *rule) triggers(rnd *rand.Rand, n int) bool {
+	if r.schedule != nil {
+		return r.schedule(n)
+	}
+	return rnd.Float64() < r.probability
+}
+
+// Injector injects faults into requests based on configured rules. It is
+// safe for concurrent use and can be reconfigured while requests are being
+// sent.
+type Injector struct {
+	mu      sync.Mutex
+	rnd     *rand.Rand
+	rules   []*rule
+	enabled bool
+	count   int
+}
+
+// New creates and returns new enabled Injector without any rules. Provided
+// seed is used for all random decisions.
+func New(seed int64) *Injector {
+	return &Injector{
+		rnd:     rand.New(rand.NewSource(seed)),
+		enabled: true,
+	}
+}
+
+// Inject adds rule that injects provided fault with given probability
+// (between 0 and 1).
+func (i *Injector) Inject(probability float64, fault Fault) *Injector {
+	return i.addRule(&rule{probability: probability, fault: fault})
+}
+
+// InjectOn adds rule that injects provided fault when schedule triggers.
+func (i *Injector) InjectOn(schedule Schedule, fault Fault) *Injector {
+	return i.addRule(&rule{schedule: schedule, fault: fault})
+}
+
+func (i *Injector) addRule(r *rule) *Injector {
+	i.mu.Lock()
+	i.rules = append(i.rules, r)
+	i.mu.Unlock()
+	return i
+}
+
+// Reset removes all rules and resets request counter.
+func (i *Injector) Reset() {
+	i.mu.Lock()
+	i.rules = nil
+	i.count = 0
+	i.mu.Unlock()
+}
+
+// Enable turns on fault injection.
+func (i *Injector) Enable() {
+	i.mu.Lock()
+	i.enabled = true
+	i.mu.Unlock()
+}
+
+// Disable turns off fault injection. Requests are passed through unchanged
+// and are not counted for schedules.
+func (i *Injector) Disable() {
+	i.mu.Lock()
+	i.enabled = false
+	i.mu.Unlock()
+}
+
+// Enabled returns true if fault injection is turned on.
+func (i *Injector) Enabled() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.enabled
+}
+
+// pick returns fault that should be applied to next request (or nil) and
+// random source that fault should use.
+func (i *Injector) pick() (Fault, *rand.Rand) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.enabled {
+		return nil, nil
+	}
+	i.count++
+	for _, r := range i.rules {
+		if r.triggers(i.rnd, i.count) {
+			return r.fault, rand.New(rand.NewSource(i.rnd.Int63()))
+		}
+	}
+	return nil, nil
+}
+
+func (i *Injector) handle(next cliware.Handler, req *http.Request) (*http.Response, error) {
+	fault, rnd := i.pick()
+	if fault == nil {
+		return next.Handle(req)
+	}
+	return fault(rnd, next, req)
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (i *Injector) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return i.handle(next, req)
+	})
+}
+
+// Transport returns http.RoundTripper that injects faults before calling
+// provided one. If next is nil, http.DefaultTransport is used.
+func (i *Injector) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{injector: i, next: next}
+}
+
+type transport struct {
+	injector *Injector
+	next     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.injector.handle(cliware.HandlerFunc(t.next.RoundTrip), req)
+}
@@ -0,0 +1,151 @@
+package chaos_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware-middlewares/retry"
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/chaos"
+	"github.com/delicb/gwc/gwctest"
+)
+
+func okClient(t *testing.T) *http.Client {
+	mock := gwctest.New(t)
+	mock.Expect().AnyTimes().Respond().Body("0123456789")
+	return mock.HTTPClient()
+}
+
+func TestInjector_Schedule(t *testing.T) {
+	injector := chaos.New(1).InjectOn(chaos.Every(2), chaos.Status(503))
+	client := gwc.New(okClient(t), injector)
+	for i, expected := range []int{200, 503, 200, 503} {
+		resp, err := client.Post().URL("http://example.com/").Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if resp.StatusCode != expected {
+			t.Errorf("Wrong status code for request %d. Got: %d, expected: %d", i+1, resp.StatusCode, expected)
+		}
+	}
+}
+
+func TestInjector_Reproducible(t *testing.T) {
+	run := func() []bool {
+		injector := chaos.New(42).Inject(0.5, chaos.ConnectionError())
+		client := gwc.New(okClient(t), injector)
+		var failures []bool
+		for i := 0; i < 20; i++ {
+			_, err := client.Post().URL("http://example.com/").Send()
+			failures = append(failures, err == chaos.ErrInjected)
+		}
+		return failures
+	}
+	first, second := run(), run()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Runs with same seed differ: %v, %v", first, second)
+		}
+	}
+}
+
+func TestInjector_Disable(t *testing.T) {
+	injector := chaos.New(1).Inject(1, chaos.ConnectionError())
+	injector.Disable()
+	client := gwc.New(okClient(t), injector)
+	if _, err := client.Post().URL("http://example.com/").Send(); err != nil {
+		t.Error("Got unexpected error with disabled injector:", err)
+	}
+	injector.Enable()
+	if _, err := client.Post().URL("http://example.com/").Send(); err != chaos.ErrInjected {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, chaos.ErrInjected)
+	}
+}
+
+func TestInjector_TransportWithRetry(t *testing.T) {
+	injector := chaos.New(1).InjectOn(chaos.Nth(1, 2), chaos.ConnectionError())
+	httpClient := &http.Client{Transport: injector.Transport(okClient(t).Transport)}
+	client := gwc.New(httpClient, retry.Times(3), retry.SetBackoffStrategy(retry.ConstantBackoff(0)))
+	resp, err := client.Get().URL("http://example.com/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Wrong status code. Got: %d, expected: 200", resp.StatusCode)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	injector := chaos.New(1).Inject(1, chaos.Timeout(0))
+	client := gwc.New(okClient(t), injector)
+	_, err := client.Post().URL("http://example.com/").Send()
+	netErr, ok := err.(net.Error)
+	if !ok || !netErr.Timeout() {
+		t.Errorf("Expected timeout error, got: %v", err)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	injector := chaos.New(1).Inject(1, chaos.Latency(time.Minute))
+	client := gwc.New(okClient(t), injector)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := client.Post().URL("http://example.com/").SetContext(ctx).Send()
+	if err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestTruncateBody(t *testing.T) {
+	injector := chaos.New(1).Inject(1, chaos.TruncateBody(4))
+	client := gwc.New(okClient(t), injector)
+	resp, err := client.Post().URL("http://example.com/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.ContentLength != 4 {
+		t.Errorf("Wrong content length. Got: %d, expected: %d", resp.ContentLength, 4)
+	}
+	_, err = resp.Bytes()
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestTruncateBody_ShortBody(t *testing.T) {
+	for _, n := range []int64{10, 20} {
+		injector := chaos.New(1).Inject(1, chaos.TruncateBody(n))
+		client := gwc.New(okClient(t), injector)
+		resp, err := client.Post().URL("http://example.com/").Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		body, err := resp.String()
+		if err != nil {
+			t.Errorf("Got unexpected error for limit %d: %v", n, err)
+		}
+		if body != "0123456789" {
+			t.Errorf("Wrong body for limit %d. Got: %s, expected: %s", n, body, "0123456789")
+		}
+	}
+}
+
+func TestCorruptBody(t *testing.T) {
+	injector := chaos.New(1).Inject(1, chaos.CorruptBody(3))
+	client := gwc.New(okClient(t), injector)
+	resp, err := client.Post().URL("http://example.com/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	body, err := resp.String()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if len(body) != 10 || body == "0123456789" {
+		t.Errorf("Body not corrupted: %q", body)
+	}
+}
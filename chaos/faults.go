@@ -0,0 +1,161 @@
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+// ErrInjected is error returned by connection error fault.
+var ErrInjected = errors.New("chaos: injected connection error")
+
+// Fault defines how request is handled when rule triggers. Provided random
+// source should be used for any randomness.
+type Fault func(rnd *rand.Rand, next cliware.Handler, req *http.Request) (*http.Response, error)
+
+// Latency returns fault that waits for provided duration before request is
+// sent. If request context is done while waiting, its error is returned.
+func Latency(d time.Duration) Fault {
+	return Fault(func(rnd *rand.Rand, next cliware.Handler, req *http.Request) (*http.Response, error) {
+		if err := sleep(req.Context(), d); err != nil {
+			return nil, err
+		}
+		return next.Handle(req)
+	})
+}
+
+// Error returns fault that does not send request and returns provided error
+// instead.
+func Error(err error) Fault {
+	return Fault(func(rnd *rand.Rand, next cliware.Handler, req *http.Request) (*http.Response, error) {
+		return nil, err
+	})
+}
+
+// ConnectionError returns fault that does not send request and returns
+// ErrInjected instead.
+func ConnectionError() Fault {
+	return Error(ErrInjected)
+}
+
+// timeoutError is error that behaves like network timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "chaos: injected timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Timeout returns fault that waits for provided duration (or until request
+// context is done) and returns error that reports itself as timeout, without
+// sending request.
+func Timeout(d time.Duration) Fault {
+	return Fault(func(rnd *rand.Rand, next cliware.Handler, req *http.Request) (*http.Response, error) {
+		if err := sleep(req.Context(), d); err != nil {
+			return nil, err
+		}
+		return nil, timeoutError{}
+	})
+}
+
+// Status returns fault that does not send request and returns response with
+// provided status code and empty body instead.
+func Status(code int) Fault {
+	return Fault(func(rnd *rand.Rand, next cliware.Handler, req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+			StatusCode: code,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			Request:    req,
+		}, nil
+	})
+}
+
+// TruncateBody returns fault that sends request, but cuts response body
+// after provided number of bytes. Reading past that point returns
+// io.ErrUnexpectedEOF, if body has more data. Bodies that are not longer
+// than n are not changed. Content length of response is set to n, if it is
+// larger.
+func TruncateBody(n int64) Fault {
+	return Fault(func(rnd *rand.Rand, next cliware.Handler, req *http.Request) (*http.Response, error) {
+		resp, err := next.Handle(req)
+		if err != nil || resp == nil || resp.Body == nil {
+			return resp, err
+		}
+		resp.Body = &truncatedBody{body: resp.Body, remaining: n}
+		if resp.ContentLength > n {
+			resp.ContentLength = n
+		}
+		return resp, nil
+	})
+}
+
+type truncatedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// body is truncated only if it has more data
+		n, err := b.body.Read(make([]byte, 1))
+		if n > 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *truncatedBody) Close() error {
+	return b.body.Close()
+}
+
+// CorruptBody returns fault that sends request and changes provided number
+// of randomly chosen bytes in response body.
+func CorruptBody(bytesToCorrupt int) Fault {
+	return Fault(func(rnd *rand.Rand, next cliware.Handler, req *http.Request) (*http.Response, error) {
+		resp, err := next.Handle(req)
+		if err != nil || resp == nil || resp.Body == nil {
+			return resp, err
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < bytesToCorrupt && len(data) > 0; i++ {
+			pos := rnd.Intn(len(data))
+			data[pos] ^= byte(rnd.Intn(255) + 1)
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	})
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -2,10 +2,18 @@ package gwc
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/delicb/cliware"
 	"github.com/delicb/cliware-middlewares/retry"
+
+	"github.com/delicb/gwc/balance"
+	"github.com/delicb/gwc/discovery"
+	"github.com/delicb/gwc/failover"
+	"github.com/delicb/gwc/idempotency"
 )
 
 // Doer defines that object is capable of executing HTTP request with provided
@@ -23,6 +31,16 @@ type Client struct {
 	Before *cliware.Chain
 	After  *cliware.Chain
 	client *http.Client
+
+	// mu guards fields that are set lazily, when requests are created
+	mu        sync.Mutex
+	failovers map[string]*failover.Failover
+
+	idempotencyAuto      bool
+	idempotencyGenerator idempotency.Generator
+	idempotencyStore     idempotency.Store
+
+	unixURLs bool
 }
 
 // New creates and returns instance of a client.
@@ -38,7 +56,7 @@ func New(client *http.Client, middlewares ...cliware.Middleware) *Client {
 		// not using http.DefaultClient since changing its RoundTripper would change it globally
 		client = &http.Client{}
 	}
-	retry.Enable(client)
+	enableTransport(client)
 	chain := cliware.NewChain(middlewares...)
 	return &Client{
 		client: client,
@@ -47,6 +65,43 @@ func New(client *http.Client, middlewares ...cliware.Middleware) *Client {
 	}
 }
 
+// transport is RoundTripper that gwc sets to every http.Client it uses.
+// It wraps original RoundTripper with ones that implement logic configured
+// by middlewares via request context (like retries, service discovery,
+// load balancing, custom dialers and limits for compressed responses).
+type transport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip is implementation of http.RoundTripper interface.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if ratio := compressionRatioFromContext(req.Context()); ratio > 0 && wantsGzip(req) {
+		return roundTripGzip(t.next, req, ratio)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// enableTransport replaces transport of provided client with gwc transport,
+// unless it is already set. Original transport is still used for sending
+// requests.
+func enableTransport(client *http.Client) {
+	if _, ok := client.Transport.(*transport); ok {
+		return
+	}
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	// discovery and balancing have to be below retries, so that every retry
+	// can go to different endpoint
+	next = newDialTransport(next)
+	next = balance.NewTransport(next)
+	next = discovery.NewTransport(next)
+	next = retry.NewRetryTransport(next)
+	next = idempotency.NewTransport(next)
+	client.Transport = &transport{next: next}
+}
+
 // Use adds provided middleware to this clients middleware chain.
 func (c *Client) Use(m cliware.Middleware) *Client {
 	c.Before.Use(m)
@@ -73,6 +128,112 @@ func (c *Client) UsePostFunc(m func(cliware.Handler) cliware.Handler) *Client {
 	return c
 }
 
+// JSONDecoding sets options used by Response.JSON to decode response bodies
+// of requests sent by this client. See JSONDecoding middleware for details.
+func (c *Client) JSONDecoding(options ...JSONOption) *Client {
+	return c.Use(JSONDecoding(options...))
+}
+
+// MaxResponseBytes limits size of response bodies read by this client.
+// See MaxResponseBytes middleware for details.
+func (c *Client) MaxResponseBytes(n int64) *Client {
+	return c.Use(MaxResponseBytes(n))
+}
+
+// MaxCompressionRatio limits how much compressed response bodies read by
+// this client can expand. See MaxCompressionRatio middleware for details.
+func (c *Client) MaxCompressionRatio(ratio float64) *Client {
+	return c.Use(MaxCompressionRatio(ratio))
+}
+
+// CookieJar sets jar that stores cookies set by responses and adds them to
+// requests sent by this client, including redirects. Package jar has cookie
+// jar that can be saved to and loaded from files.
+func (c *Client) CookieJar(jar http.CookieJar) *Client {
+	c.client.Jar = jar
+	return c
+}
+
+// IdempotencyKeys enables automatic Idempotency-Key header on all POST and
+// PATCH requests created by this client. Provided generator is used for new
+// keys (UUID if nil) and provided store is used for keys of operations set
+// with Request.IdempotentOperation (in memory store if nil).
+func (c *Client) IdempotencyKeys(generator idempotency.Generator, store idempotency.Store) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.idempotencyAuto = true
+	c.idempotencyGenerator = generator
+	c.idempotencyStore = store
+	return c
+}
+
+// UnixURLs enables URLs of HTTP servers listening on Unix sockets, like
+// unix:///var/run/docker.sock:/v1.41/containers/json, in Request.URL and
+// Request.BaseURL. They are disabled by default, since they make requests
+// go to local sockets, which URLs from untrusted input should not be able
+// to do. UnixSocket middleware can be used without enabling them.
+func (c *Client) UnixURLs() *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.unixURLs = true
+	return c
+}
+
+// unixURL returns middleware that sends request to provided unix URL, see
+// unixURL function, or middleware that fails request if unix URLs are not
+// enabled.
+func (c *Client) unixURL(rawURL string, set func(string) cliware.Middleware) cliware.Middleware {
+	c.mu.Lock()
+	enabled := c.unixURLs
+	c.mu.Unlock()
+	if !enabled {
+		return cliware.RequestProcessor(func(*http.Request) error {
+			return fmt.Errorf("gwc: unix URL %s is not enabled, see Client.UnixURLs", rawURL)
+		})
+	}
+	return unixURL(rawURL, set)
+}
+
+// idempotencySettings returns whether idempotency keys are enabled for all
+// unsafe requests and generator of keys.
+func (c *Client) idempotencySettings() (bool, idempotency.Generator) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.idempotencyAuto, c.idempotencyGenerator
+}
+
+// idempotencyKeyStore returns store for idempotency keys of operations,
+// creating in memory one if it is not set.
+func (c *Client) idempotencyKeyStore() idempotency.Store {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.idempotencyStore == nil {
+		c.idempotencyStore = idempotency.NewMemoryStore()
+	}
+	return c.idempotencyStore
+}
+
+// failover returns failover middleware for provided base URLs. Same instance
+// is returned for same list of base URLs, so that all requests sent by this
+// client share information about failed base URLs.
+func (c *Client) failover(rawURLs []string) (*failover.Failover, error) {
+	key := strings.Join(rawURLs, " ")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.failovers[key]; ok {
+		return f, nil
+	}
+	f, err := failover.New(failover.DefaultCooldown, rawURLs...)
+	if err != nil {
+		return nil, err
+	}
+	if c.failovers == nil {
+		c.failovers = make(map[string]*failover.Failover)
+	}
+	c.failovers[key] = f
+	return f, nil
+}
+
 // Request creates and returns new request that uses this client to perform
 // HTTP request and uses its defined middlewares.
 func (c *Client) Request() *Request {
@@ -87,9 +248,13 @@ func (c *Client) Get() *Request {
 }
 
 // Post creates and returns new POST request.
+// If idempotency keys are enabled, request will have Idempotency-Key header.
 func (c *Client) Post() *Request {
 	r := c.Request()
 	r.Method("POST")
+	if auto, _ := c.idempotencySettings(); auto {
+		r.Idempotent()
+	}
 	return r
 }
 
@@ -108,9 +273,13 @@ func (c *Client) Delete() *Request {
 }
 
 // Patch creates and returns new PATCH request.
+// If idempotency keys are enabled, request will have Idempotency-Key header.
 func (c *Client) Patch() *Request {
 	r := c.Request()
 	r.Method("PATCH")
+	if auto, _ := c.idempotencySettings(); auto {
+		r.Idempotent()
+	}
 	return r
 }
 
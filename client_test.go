@@ -28,6 +28,13 @@ func newMockTransport(responseCode int) *mockTransport {
 	return &mockTransport{responseCode: responseCode}
 }
 
+// roundTripperFunc is adapter that allows usage of function as RoundTripper.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
 type mockMiddleware struct {
 	called bool
 	count  int
@@ -249,3 +256,20 @@ func TestClient_AfterCalledOnce(t *testing.T) {
 		t.Error("Middleware not called only once.")
 	}
 }
+
+func TestClient_IdempotencyKeys(t *testing.T) {
+	var keys []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		keys = append(keys, req.Header.Get("Idempotency-Key"))
+		return &http.Response{StatusCode: 200, Request: req}, nil
+	})
+	client := gwc.New(&http.Client{Transport: transport})
+	client.IdempotencyKeys(func() (string, error) { return "generated", nil }, nil)
+	client.Post().Send()
+	client.Patch().Send()
+	client.Put().Send()
+	expected := []string{"generated", "generated", ""}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Wrong idempotency keys. Got: %v, expected: %v", keys, expected)
+	}
+}
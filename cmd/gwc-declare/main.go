@@ -0,0 +1,59 @@
+// Command gwc-declare generates implementation of interface that describes
+// API, which sends requests with declare.Binder. See declare.Generate for
+// description of interface.
+//
+// Usage:
+//
+//	gwc-declare -type UserAPI [-o output.go] [api.go]
+//
+// It can be used with go generate, in which case file with go:generate
+// comment is used if no file is provided:
+//
+//	//go:generate gwc-declare -type UserAPI -o userapi_gen.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/delicb/gwc/declare"
+)
+
+func main() {
+	typ := flag.String("type", "", "name of interface to implement")
+	output := flag.String("o", "", "output file, standard output if not set")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: gwc-declare -type name [flags] [api.go]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	input := os.Getenv("GOFILE")
+	if flag.NArg() == 1 {
+		input = flag.Arg(0)
+	}
+	if *typ == "" || input == "" || flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	src, err := ioutil.ReadFile(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gwc-declare:", err)
+		os.Exit(1)
+	}
+	generated, err := declare.Generate(src, *typ)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gwc-declare:", err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(generated)
+		return
+	}
+	if err := ioutil.WriteFile(*output, generated, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "gwc-declare:", err)
+		os.Exit(1)
+	}
+}
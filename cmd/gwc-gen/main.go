@@ -0,0 +1,53 @@
+// Command gwc-gen generates gwc client from OpenAPI 3.0 or 3.1 document in
+// JSON format.
+//
+// Usage:
+//
+//	gwc-gen [-package name] [-o output.go] openapi.json
+//
+// It can be used with go generate:
+//
+//	//go:generate gwc-gen -package petstore -o petstore.go openapi.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/delicb/gwc/openapi"
+)
+
+func main() {
+	pkg := flag.String("package", "client", "name of package of generated code")
+	output := flag.String("o", "", "output file, standard output if not set")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: gwc-gen [flags] openapi.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	doc, err := openapi.Load(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gwc-gen:", err)
+		os.Exit(1)
+	}
+	src, err := openapi.Generate(doc, openapi.Config{Package: *pkg})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gwc-gen:", err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "gwc-gen:", err)
+		os.Exit(1)
+	}
+}
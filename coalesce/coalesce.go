@@ -0,0 +1,228 @@
+// Package coalesce contains middleware that deduplicates concurrent
+// identical requests.
+//
+// When request arrives while identical one is already in flight, it is not
+// sent. Instead, it waits for response of request in flight and gets its own
+// copy of it, including body. Only safe methods (GET and HEAD) are
+// coalesced. Request in flight is canceled only when all requests waiting
+// for it are canceled.
+//
+// Since requests are compared after all other middlewares are applied,
+// Coalescer should be added to gwc.Client with UsePost and to single request
+// or gwc.Group after all other middlewares that modify request.
+package coalesce
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+// KeyFunc returns key that identifies request. Requests with same key are
+// considered identical.
+type KeyFunc func(req *http.Request) string
+
+// call is request in flight, together with its result once it is done.
+type call struct {
+	done chan struct{}
+	resp *http.Response
+	body []byte
+	err  error
+
+	// waiters is number of requests waiting for this call, guarded by
+	// mutex of Coalescer
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Coalescer is middleware that deduplicates concurrent identical requests.
+type Coalescer struct {
+	key     KeyFunc
+	headers []string
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// New creates and returns Coalescer that considers requests identical if
+// they have same method and URL.
+func New() *Coalescer {
+	c := &Coalescer{calls: make(map[string]*call)}
+	c.key = c.defaultKey
+	return c
+}
+
+// Headers sets names of headers that are compared, together with method
+// and URL, to decide if requests are identical. It is used only with
+// default key function.
+func (c *Coalescer) Headers(names ...string) *Coalescer {
+	c.headers = make([]string, len(names))
+	for i, n := range names {
+		c.headers[i] = http.CanonicalHeaderKey(n)
+	}
+	sort.Strings(c.headers)
+	return c
+}
+
+// Key sets custom function that decides if requests are identical.
+func (c *Coalescer) Key(key KeyFunc) *Coalescer {
+	c.key = key
+	return c
+}
+
+func (c *Coalescer) defaultKey(req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteString(" ")
+	b.WriteString(req.URL.String())
+	for _, h := range c.headers {
+		b.WriteString("\n")
+		b.WriteString(h)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(req.Header[h], ", "))
+	}
+	return b.String()
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (c *Coalescer) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			return next.Handle(req)
+		}
+		key := c.key(req)
+
+		c.mu.Lock()
+		if cl, ok := c.calls[key]; ok {
+			cl.waiters++
+			c.mu.Unlock()
+			select {
+			case <-cl.done:
+				return cl.result(req)
+			case <-req.Context().Done():
+				c.leave(cl, key)
+				return nil, req.Context().Err()
+			}
+		}
+		// shared request is not canceled with context of request that
+		// started it, but only when all requests waiting for it are canceled
+		ctx, cancel := context.WithCancel(detachedContext{req.Context()})
+		cl := &call{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		c.calls[key] = cl
+		c.mu.Unlock()
+
+		stop := make(chan struct{})
+		go func() {
+			select {
+			case <-req.Context().Done():
+				c.leave(cl, key)
+			case <-stop:
+			}
+		}()
+		c.do(cl, key, next, req.WithContext(ctx))
+		close(stop)
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		return cl.result(req)
+	})
+}
+
+// leave removes request from waiters of provided call and cancels call if
+// no request waits for it any more. Canceled call is removed, so that new
+// requests with same key do not join it.
+func (c *Coalescer) leave(cl *call, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cl.waiters--
+	if cl.waiters == 0 {
+		cl.cancel()
+		c.remove(cl, key)
+	}
+}
+
+// remove removes provided call, unless it was already replaced by newer
+// call with same key. It has to be called with lock held.
+func (c *Coalescer) remove(cl *call, key string) {
+	if c.calls[key] == cl {
+		delete(c.calls, key)
+	}
+}
+
+// do sends request and stores its result to provided call. Waiting
+// requests are released even if next handler panics, with error as result,
+// and panic is propagated to caller.
+func (c *Coalescer) do(cl *call, key string, next cliware.Handler, req *http.Request) {
+	defer func() {
+		p := recover()
+		if p != nil {
+			cl.resp, cl.body = nil, nil
+			cl.err = fmt.Errorf("coalesce: request panicked: %v", p)
+		}
+		c.mu.Lock()
+		c.remove(cl, key)
+		c.mu.Unlock()
+		close(cl.done)
+		cl.cancel()
+		if p != nil {
+			panic(p)
+		}
+	}()
+
+	cl.resp, cl.err = next.Handle(req)
+	if cl.resp != nil && cl.resp.Body != nil {
+		var readErr error
+		cl.body, readErr = ioutil.ReadAll(cl.resp.Body)
+		cl.resp.Body.Close()
+		if readErr != nil && cl.err == nil {
+			cl.err = readErr
+		}
+	}
+}
+
+// detachedContext has values of its parent, but it is not canceled when
+// parent is.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+// result returns independent copy of response of this call.
+func (cl *call) result(req *http.Request) (*http.Response, error) {
+	if cl.resp == nil {
+		return nil, cl.err
+	}
+	resp := new(http.Response)
+	*resp = *cl.resp
+	resp.Header = cl.resp.Header.Clone()
+	resp.Trailer = cl.resp.Trailer.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(cl.body))
+	resp.Request = req
+	return resp, cl.err
+}
+
+// InFlight returns number of distinct requests currently in flight.
+func (c *Coalescer) InFlight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.calls)
+}
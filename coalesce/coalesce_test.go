@@ -0,0 +1,229 @@
+package coalesce_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/coalesce"
+)
+
+// blockingHandler counts requests and blocks each one until release is
+// closed.
+func blockingHandler(calls *int32, release chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		<-release
+		w.Write([]byte("flags"))
+	})
+}
+
+func waitInFlight(c *coalesce.Coalescer, n int) {
+	deadline := time.Now().Add(time.Second)
+	for c.InFlight() < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalescer(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	coalescer := coalesce.New()
+	client := gwc.NewForHandler(blockingHandler(&calls, release))
+	client.UsePost(coalescer)
+
+	const n = 10
+	bodies := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Get().URL("http://flags/").Send()
+			if err != nil {
+				t.Error("Got unexpected error:", err)
+				return
+			}
+			bodies[i], _ = resp.String()
+		}(i)
+	}
+	waitInFlight(coalescer, 1)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Wrong number of requests sent. Got: %d, expected: 1", got)
+	}
+	for i, b := range bodies {
+		if b != "flags" {
+			t.Errorf("Wrong body for request %d. Got: %q, expected: flags", i, b)
+		}
+	}
+}
+
+func TestCoalescer_DifferentKeys(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	coalescer := coalesce.New().Headers("Authorization")
+	client := gwc.NewForHandler(blockingHandler(&calls, release))
+	client.UsePost(coalescer)
+
+	var wg sync.WaitGroup
+	for _, token := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			client.Get().URL("http://flags/").SetHeader("Authorization", token).Send()
+		}(token)
+	}
+	waitInFlight(coalescer, 2)
+	close(release)
+	wg.Wait()
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Wrong number of requests sent. Got: %d, expected: 2", got)
+	}
+}
+
+func TestCoalescer_UnsafeMethod(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	close(release)
+	client := gwc.NewForHandler(blockingHandler(&calls, release))
+	client.UsePost(coalesce.New().Key(func(*http.Request) string { return "same" }))
+	client.Post().URL("http://flags/").Send()
+	client.Post().URL("http://flags/").Send()
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Wrong number of requests sent. Got: %d, expected: 2", got)
+	}
+}
+
+func TestCoalescer_LeaderCanceled(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	coalescer := coalesce.New()
+	client := gwc.NewForHandler(blockingHandler(&calls, release))
+	client.UsePost(coalescer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := client.Get().URL("http://flags/").SetContext(ctx).Send()
+		leaderErr <- err
+	}()
+	waitInFlight(coalescer, 1)
+	waiter := make(chan string, 1)
+	go func() {
+		resp, err := client.Get().URL("http://flags/").Send()
+		if err != nil {
+			t.Error("Got unexpected error:", err)
+			waiter <- ""
+			return
+		}
+		body, _ := resp.String()
+		waiter <- body
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if body := <-waiter; body != "flags" {
+		t.Errorf("Wrong body of waiting request. Got: %q, expected: flags", body)
+	}
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("Wrong error of canceled request. Got: %v, expected: %v", err, context.Canceled)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Wrong number of requests sent. Got: %d, expected: 1", got)
+	}
+}
+
+func TestCoalescer_AllCanceled(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// first request ignores cancellation
+			<-release
+			return nil, req.Context().Err()
+		}
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader("flags")), Request: req}, nil
+	})
+	defer close(release)
+	coalescer := coalesce.New()
+	client := gwc.New(&http.Client{Transport: transport})
+	client.UsePost(coalescer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go client.Get().URL("http://flags/").SetContext(ctx).Send()
+	waitInFlight(coalescer, 1)
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for coalescer.InFlight() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// canceled request is still in flight, but new one does not join it
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := client.Get().URL("http://flags/").SetContext(ctx).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body, _ := resp.String(); body != "flags" {
+		t.Errorf("Wrong body. Got: %q, expected: flags", body)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Wrong number of requests sent. Got: %d, expected: 2", got)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCoalescer_Panic(t *testing.T) {
+	coalescer := coalesce.New()
+	release := make(chan struct{})
+	handler := coalescer.Exec(cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		<-release
+		panic("boom")
+	}))
+	req, _ := http.NewRequest("GET", "http://flags/", nil)
+
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		handler.Handle(req)
+	}()
+	waitInFlight(coalescer, 1)
+	waiter := make(chan error, 1)
+	go func() {
+		resp, err := handler.Handle(req)
+		if resp != nil {
+			t.Error("Got response from panicking request.")
+		}
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if err := <-waiter; err == nil {
+		t.Error("Expected error for waiter of panicking request.")
+	}
+	if p := <-panicked; p != "boom" {
+		t.Errorf("Panic not propagated. Got: %v, expected: boom", p)
+	}
+}
@@ -3,6 +3,10 @@ package gwc
 import (
 	"context"
 	"net/http"
+
+	"github.com/delicb/cliware"
+
+	"github.com/delicb/gwc/jsonschema"
 )
 
 type clientKeyType string
@@ -28,3 +32,23 @@ func ClientFromContext(ctx context.Context) *http.Client {
 	}
 	return nil
 }
+
+type schemaKeyType string
+
+var schemaKey schemaKeyType = "schema"
+
+// ResponseSchema returns middleware that sets JSON Schema against which
+// response body is validated by Response.JSON. It can be used with Client,
+// Group or single Request.
+func ResponseSchema(schema *jsonschema.Schema) cliware.Middleware {
+	return cliware.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, schemaKey, schema)
+	})
+}
+
+// schemaFromContext returns JSON Schema set by ResponseSchema middleware, or
+// nil if there is none.
+func schemaFromContext(ctx context.Context) *jsonschema.Schema {
+	schema, _ := ctx.Value(schemaKey).(*jsonschema.Schema)
+	return schema
+}
@@ -0,0 +1,327 @@
+// Package declare creates API clients from declarative descriptions.
+//
+// API is described as struct whose fields are functions, with tags that
+// describe requests they send. Go can not implement interfaces at runtime,
+// so struct of functions is used instead of interface (interfaces are
+// supported with generated code, see below). Bind sets every function field
+// to implementation that builds request with gwc and decodes its response:
+//
+//	type UserAPI struct {
+//		Get    func(ctx context.Context, id string) (*User, error)          `gwc:"GET /users/:id" args:"path:id"`
+//		Search func(ctx context.Context, q string, limit int) ([]User, error) `gwc:"GET /users" args:"query:q,query:limit"`
+//		Create func(ctx context.Context, token string, u *User) (*User, error) `gwc:"POST /users" args:"header:Authorization,body"`
+//		Delete func(ctx context.Context, id string) error                    `gwc:"DELETE /users/:id" args:"path:id"`
+//	}
+//
+//	var users UserAPI
+//	err := declare.New(client, url.BaseURL("https://api.example.com")).Bind(&users)
+//
+// Tag "gwc" holds method and path of request, where path parameters are
+// prefixed with colon. Tag "args" describes function arguments, in order,
+// skipping leading context.Context if function has one. Each argument is
+// one of "path:<name>", "query:<name>", "header:<name>" or "body" (encoded
+// as JSON). Slice arguments used as query or header produce multiple values.
+//
+// Functions have to return error as last result, optionally preceded by
+// one value. If that value is *gwc.Response, it is returned as is. Otherwise,
+// response body is decoded from JSON to it and responses with status code
+// 400 or higher are returned as *errors.HTTPError from
+// github.com/delicb/cliware-middlewares/errors.
+//
+// Path arguments are escaped and replace whole path segments only, so value
+// like "../admin" can not change other parts of URL.
+//
+// API can also be described as interface, with tag of each method in its doc
+// comment. Implementation of such interface is generated by Generate, usually
+// through gwc-declare command and go generate:
+//
+//	//go:generate go run github.com/delicb/gwc/cmd/gwc-declare -type UserAPI -o userapi_gen.go
+//
+//	type UserAPI interface {
+//		// gwc:"GET /users/:id" args:"path:id"
+//		Get(ctx context.Context, id string) (*User, error)
+//	}
+//
+//	users, err := NewUserAPI(declare.New(client, url.BaseURL("https://api.example.com")))
+package declare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/delicb/cliware"
+	cwerrors "github.com/delicb/cliware-middlewares/errors"
+
+	"github.com/delicb/gwc"
+)
+
+var (
+	contextType  = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	responseType = reflect.TypeOf((*gwc.Response)(nil))
+)
+
+// Binder binds API descriptions to implementations that send requests with
+// gwc client.
+type Binder struct {
+	client  *gwc.Client
+	group   *gwc.Group
+	methods map[string][]cliware.Middleware
+}
+
+// New creates and returns binder that sends requests with provided client.
+// Provided middlewares are used for all requests of bound API, through
+// gwc.Group.
+func New(client *gwc.Client, middlewares ...cliware.Middleware) *Binder {
+	return &Binder{
+		client:  client,
+		group:   gwc.NewGroup(client, middlewares...),
+		methods: make(map[string][]cliware.Middleware),
+	}
+}
+
+// Group returns group whose middlewares are used for all requests of bound
+// API.
+func (b *Binder) Group() *gwc.Group {
+	return b.group
+}
+
+// Method adds middlewares used only for requests sent by function field
+// with provided name. It has to be called before Bind.
+func (b *Binder) Method(name string, middlewares ...cliware.Middleware) *Binder {
+	b.methods[name] = append(b.methods[name], middlewares...)
+	return b
+}
+
+// Bind sets implementations to all function fields of struct pointed to by
+// provided value. Fields without "gwc" tag are skipped. Error is returned
+// if any field is not described correctly.
+func (b *Binder) Bind(api interface{}) error {
+	v := reflect.ValueOf(api)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("declare: expected pointer to struct, got %T", api)
+	}
+	v = v.Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("gwc"); !ok {
+			continue
+		}
+		e, err := parseEndpoint(field)
+		if err != nil {
+			return fmt.Errorf("declare: field %s: %v", field.Name, err)
+		}
+		e.binder = b
+		e.middlewares = b.methods[field.Name]
+		v.Field(i).Set(reflect.MakeFunc(field.Type, e.call))
+	}
+	return nil
+}
+
+// argument describes how function argument is set to request.
+type argument struct {
+	kind string
+	name string
+}
+
+// endpoint is single bound function.
+type endpoint struct {
+	binder      *Binder
+	middlewares []cliware.Middleware
+
+	method     string
+	path       string
+	hasContext bool
+	args       []argument
+	result     reflect.Type
+}
+
+func parseEndpoint(field reflect.StructField) (*endpoint, error) {
+	t := field.Type
+	if t.Kind() != reflect.Func {
+		return nil, fmt.Errorf("expected function, got %s", t)
+	}
+	e := &endpoint{}
+
+	parts := strings.Fields(field.Tag.Get("gwc"))
+	if len(parts) != 2 {
+		return nil, fmt.Errorf(`tag "gwc" has to be in form "METHOD /path"`)
+	}
+	e.method, e.path = strings.ToUpper(parts[0]), parts[1]
+
+	in := 0
+	if t.NumIn() > 0 && t.In(0) == contextType {
+		e.hasContext = true
+		in = 1
+	}
+	if spec := field.Tag.Get("args"); spec != "" {
+		for _, s := range strings.Split(spec, ",") {
+			kind, name := strings.TrimSpace(s), ""
+			if i := strings.Index(kind, ":"); i >= 0 {
+				kind, name = kind[:i], kind[i+1:]
+			}
+			switch {
+			case kind == "body" && name == "":
+			case (kind == "path" || kind == "query" || kind == "header") && name != "":
+			default:
+				return nil, fmt.Errorf("invalid argument %q", s)
+			}
+			e.args = append(e.args, argument{kind: kind, name: name})
+		}
+	}
+	if t.NumIn()-in != len(e.args) || t.IsVariadic() {
+		return nil, fmt.Errorf("function has %d arguments, but %d are described", t.NumIn()-in, len(e.args))
+	}
+
+	switch {
+	case t.NumOut() == 1 && t.Out(0) == errorType:
+	case t.NumOut() == 2 && t.Out(1) == errorType:
+		e.result = t.Out(0)
+	default:
+		return nil, fmt.Errorf("function has to return error, optionally preceded by one value")
+	}
+	return e, nil
+}
+
+// call is implementation of bound function.
+func (e *endpoint) call(in []reflect.Value) []reflect.Value {
+	ctx := context.Background()
+	if e.hasContext {
+		if c, ok := in[0].Interface().(context.Context); ok && c != nil {
+			ctx = c
+		}
+		in = in[1:]
+	}
+
+	req := e.binder.client.Request().
+		Use(e.binder.group).
+		Method(e.method).
+		Path(e.path).
+		SetContext(ctx)
+	params := make(map[string]string)
+	for i, a := range e.args {
+		if a.kind == "path" {
+			params[a.name] = format(in[i])
+			continue
+		}
+		e.setArgument(req, a, in[i])
+	}
+	req.Use(pathParams(params))
+	req.Use(e.middlewares...)
+	if e.result != responseType {
+		req.Use(cwerrors.Errors())
+	}
+	resp, err := req.Send()
+	return e.results(resp, err)
+}
+
+func (e *endpoint) setArgument(req *gwc.Request, a argument, v reflect.Value) {
+	switch a.kind {
+	case "query":
+		for _, s := range formatAll(v) {
+			req.AddQuery(a.name, s)
+		}
+	case "header":
+		for _, s := range formatAll(v) {
+			req.AddHeader(a.name, s)
+		}
+	case "body":
+		req.BodyJSON(v.Interface())
+	}
+}
+
+// pathParams returns middleware that replaces parameters in request path
+// with provided values. Only whole path segments are replaced and values are
+// escaped, so they can not change other segments or other parts of URL.
+func pathParams(params map[string]string) cliware.Middleware {
+	return cliware.RequestProcessor(func(req *http.Request) error {
+		segments := strings.Split(req.URL.EscapedPath(), "/")
+		for i, s := range segments {
+			if v, ok := params[strings.TrimPrefix(s, ":")]; ok && strings.HasPrefix(s, ":") {
+				segments[i] = escapeSegment(v)
+			}
+		}
+		rawPath := strings.Join(segments, "/")
+		path, err := url.PathUnescape(rawPath)
+		if err != nil {
+			return err
+		}
+		req.URL.Path, req.URL.RawPath = path, rawPath
+		return nil
+	})
+}
+
+// escapeSegment escapes value used as path segment. Dot segments are escaped
+// too, so they are not treated as relative references.
+func escapeSegment(v string) string {
+	if v == "." || v == ".." {
+		return strings.Replace(v, ".", "%2E", -1)
+	}
+	return url.PathEscape(v)
+}
+
+// results converts response to return values of bound function.
+func (e *endpoint) results(resp *gwc.Response, err error) []reflect.Value {
+	errValue := func(err error) reflect.Value {
+		if err == nil {
+			return reflect.Zero(errorType)
+		}
+		return reflect.ValueOf(&err).Elem()
+	}
+
+	if e.result == nil {
+		if err == nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+		return []reflect.Value{errValue(err)}
+	}
+	if e.result == responseType {
+		return []reflect.Value{reflect.ValueOf(resp), errValue(err)}
+	}
+
+	out := reflect.New(e.result)
+	if err == nil {
+		err = resp.JSON(out.Interface())
+		if errors.Is(err, gwc.ErrEmptyBody) {
+			// empty body (like for 204 status) is decoded as zero value
+			err = nil
+		}
+	}
+	if err != nil {
+		return []reflect.Value{reflect.Zero(e.result), errValue(err)}
+	}
+	return []reflect.Value{out.Elem(), errValue(nil)}
+}
+
+// format returns string representation of argument value.
+func format(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// formatAll returns string representations of all values of slice argument,
+// or of argument itself if it is not a slice.
+func formatAll(v reflect.Value) []string {
+	if v.Kind() != reflect.Slice {
+		return []string{format(v)}
+	}
+	values := make([]string, v.Len())
+	for i := range values {
+		values[i] = format(v.Index(i))
+	}
+	return values
+}
@@ -0,0 +1,160 @@
+package declare_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/delicb/cliware-middlewares/errors"
+	"github.com/delicb/cliware-middlewares/headers"
+	"github.com/delicb/cliware-middlewares/url"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/declare"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userAPI struct {
+	Get    func(ctx context.Context, id string) (*user, error)                `gwc:"GET /users/:id" args:"path:id"`
+	Search func(ctx context.Context, q string, tags []string) ([]user, error) `gwc:"GET /users" args:"query:q,query:tag"`
+	Create func(ctx context.Context, token string, u *user) (*user, error)    `gwc:"POST /users" args:"header:Authorization,body"`
+	Delete func(id string) error                                              `gwc:"DELETE /users/:id" args:"path:id"`
+	Raw    func(ctx context.Context) (*gwc.Response, error)                   `gwc:"GET /raw"`
+	Helper string
+}
+
+func newAPI(t *testing.T) *userAPI {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "api.example.com" {
+			t.Errorf("Wrong host. Got: %s, expected: %s", r.Host, "api.example.com")
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/users/a b":
+			json.NewEncoder(w).Encode(user{ID: "a b", Name: r.Header.Get("X-Method")})
+		case r.Method == "GET" && r.URL.Path == "/users":
+			q := r.URL.Query()
+			json.NewEncoder(w).Encode([]user{{ID: q.Get("q"), Name: q["tag"][0] + q["tag"][1]}})
+		case r.Method == "POST" && r.URL.Path == "/users":
+			var u user
+			json.NewDecoder(r.Body).Decode(&u)
+			u.ID = r.Header.Get("Authorization")
+			json.NewEncoder(w).Encode(u)
+		case r.Method == "DELETE":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/raw":
+			w.WriteHeader(http.StatusTeapot)
+		}
+	})
+	client := gwc.NewForHandler(handler)
+	api := &userAPI{}
+	err := declare.New(client, url.BaseURL("http://api.example.com")).
+		Method("Get", headers.Set("X-Method", "get")).
+		Bind(api)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	return api
+}
+
+func TestBinder_Bind(t *testing.T) {
+	api := newAPI(t)
+	ctx := context.Background()
+
+	u, err := api.Get(ctx, "a b")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if u.ID != "a b" || u.Name != "get" {
+		t.Errorf("Wrong user. Got: %+v", u)
+	}
+
+	users, err := api.Search(ctx, "john", []string{"x", "y"})
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if len(users) != 1 || users[0].ID != "john" || users[0].Name != "xy" {
+		t.Errorf("Wrong users. Got: %+v", users)
+	}
+
+	u, err = api.Create(ctx, "token", &user{Name: "john"})
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if u.ID != "token" || u.Name != "john" {
+		t.Errorf("Wrong user. Got: %+v", u)
+	}
+
+	err = api.Delete("a")
+	httpErr, ok := err.(*errors.HTTPError)
+	if !ok || httpErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Wrong error. Got: %v, expected HTTPError with status 404", err)
+	}
+
+	resp, err := api.Raw(ctx)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("Wrong status code. Got: %d, expected: %d", resp.StatusCode, http.StatusTeapot)
+	}
+}
+
+func TestBinder_BindInvalid(t *testing.T) {
+	client := gwc.New(nil)
+	for _, api := range []interface{}{
+		userAPI{},
+		&struct {
+			F func(string) error `gwc:"GET /:id"`
+		}{},
+		&struct {
+			F func(string) error `gwc:"/:id" args:"path:id"`
+		}{},
+		&struct {
+			F func(string) error `gwc:"GET /:id" args:"cookie:id"`
+		}{},
+		&struct {
+			F func() string `gwc:"GET /"`
+		}{},
+		&struct {
+			F string `gwc:"GET /"`
+		}{},
+	} {
+		if err := declare.New(client).Bind(api); err == nil {
+			t.Errorf("Expected error for %T.", api)
+		}
+	}
+}
+
+func TestBinder_PathParams(t *testing.T) {
+	var api struct {
+		Get func(id, idx string) (*gwc.Response, error) `gwc:"GET /items/:idx/parts/:id" args:"path:id,path:idx"`
+	}
+	paths := make(chan string, 1)
+	client := gwc.NewForHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.EscapedPath()
+	}))
+	if err := declare.New(client, url.BaseURL("http://api.example.com")).Bind(&api); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for _, data := range []struct {
+		ID       string
+		Idx      string
+		Expected string
+	}{
+		{"1", "2", "/items/2/parts/1"},
+		{"../admin", "a?b#c", "/items/a%3Fb%23c/parts/..%2Fadmin"},
+		{"..", "a b", "/items/a%20b/parts/%2E%2E"},
+	} {
+		if _, err := api.Get(data.ID, data.Idx); err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if path := <-paths; path != data.Expected {
+			t.Errorf("Wrong path. Got: %s, expected: %s", path, data.Expected)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package declare
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	goformat "go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// declarePath is import path of this package, used by generated code.
+const declarePath = "github.com/delicb/gwc/declare"
+
+// Generate generates Go source that implements interface with provided
+// name, declared in provided Go source file. Generated code belongs to same
+// package as interface.
+//
+// Each method of interface is described by line of its doc comment that
+// has same form as tags of function fields bound by Bind:
+//
+//	type UserAPI interface {
+//		// Get returns user with provided ID.
+//		// gwc:"GET /users/:id" args:"path:id"
+//		Get(ctx context.Context, id string) (*User, error)
+//	}
+//
+// For interface UserAPI, generated code contains function
+//
+//	func NewUserAPI(b *declare.Binder) (UserAPI, error)
+//
+// that binds methods with provided binder (newUserAPI for unexported
+// interface userAPI). Middlewares for single method are set with
+// Binder.Method, using name of method.
+func Generate(src []byte, iface string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("declare: %v", err)
+	}
+	typ, err := findInterface(file, iface)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{fset: fset, file: file, used: make(map[string]bool)}
+	funcs := lowerFirst(iface) + "Funcs"
+	impl := lowerFirst(iface) + "Client"
+	constructor := "New" + iface
+	if !ast.IsExported(iface) {
+		constructor = "new" + upperFirst(iface)
+	}
+	var fields, methods bytes.Buffer
+	for _, m := range typ.Methods.List {
+		fn, ok := m.Type.(*ast.FuncType)
+		if !ok || len(m.Names) != 1 {
+			return nil, fmt.Errorf("declare: interface %s can only have methods", iface)
+		}
+		name := m.Names[0].Name
+		tag, err := methodTag(m.Doc)
+		if err != nil {
+			return nil, fmt.Errorf("declare: method %s: %v", name, err)
+		}
+		params, args, err := g.params(fn)
+		if err != nil {
+			return nil, fmt.Errorf("declare: method %s: %v", name, err)
+		}
+		results := g.expr(fn.Results)
+		if fn.Results != nil && (len(fn.Results.List) > 1 || len(fn.Results.List[0].Names) > 0) {
+			results = "(" + results + ")"
+		}
+		fmt.Fprintf(&fields, "\t%s func(%s) %s %s\n", name, params, results, "`"+tag+"`")
+		fmt.Fprintf(&methods, "\n// %s is implementation of %s.%s.\n", name, iface, name)
+		fmt.Fprintf(&methods, "func (%s *%s) %s(%s) %s {\n", receiver, impl, name, params, results)
+		call := fmt.Sprintf("%s.funcs.%s(%s)", receiver, name, strings.Join(args, ", "))
+		if fn.Results == nil {
+			fmt.Fprintf(&methods, "\t%s\n}\n", call)
+		} else {
+			fmt.Fprintf(&methods, "\treturn %s\n}\n", call)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gwc-declare. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", file.Name.Name)
+	g.writeImports(&out)
+	fmt.Fprintf(&out, "\n// %s holds functions bound to methods of %s.\n", funcs, iface)
+	fmt.Fprintf(&out, "type %s struct {\n%s}\n", funcs, fields.String())
+	fmt.Fprintf(&out, "\n// %s implements %s with functions bound by declare.Binder.\n", impl, iface)
+	fmt.Fprintf(&out, "type %s struct {\n\tfuncs %s\n}\n", impl, funcs)
+	fmt.Fprintf(&out, "\n// %s returns %s that sends requests with provided binder.\n", constructor, iface)
+	fmt.Fprintf(&out, "// Error is returned if any method is not described correctly.\n")
+	fmt.Fprintf(&out, "func %s(b *declare.Binder) (%s, error) {\n", constructor, iface)
+	fmt.Fprintf(&out, "\tc := &%s{}\n", impl)
+	fmt.Fprintf(&out, "\tif err := b.Bind(&c.funcs); err != nil {\n\t\treturn nil, err\n\t}\n")
+	fmt.Fprintf(&out, "\treturn c, nil\n}\n")
+	out.Write(methods.Bytes())
+
+	formatted, err := goformat.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("declare: generated invalid code: %v", err)
+	}
+	return formatted, nil
+}
+
+// findInterface returns interface type with provided name from file.
+func findInterface(file *ast.File, name string) (*ast.InterfaceType, error) {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if ts.Name.Name != name {
+				continue
+			}
+			typ, ok := ts.Type.(*ast.InterfaceType)
+			if !ok {
+				return nil, fmt.Errorf("declare: type %s is not interface", name)
+			}
+			return typ, nil
+		}
+	}
+	return nil, fmt.Errorf("declare: interface %s not found", name)
+}
+
+// methodTag returns tag from doc comment of method, which is line that
+// starts with gwc tag.
+func methodTag(doc *ast.CommentGroup) (string, error) {
+	if doc != nil {
+		for _, c := range doc.List {
+			line := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+			if !strings.HasPrefix(line, `gwc:"`) {
+				continue
+			}
+			if _, ok := reflect.StructTag(line).Lookup("gwc"); !ok || strings.Contains(line, "`") {
+				return "", fmt.Errorf("invalid tag %s", line)
+			}
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf(`doc comment has no line with "gwc" tag`)
+}
+
+// generator holds state of code generation for single interface.
+type generator struct {
+	fset *token.FileSet
+	file *ast.File
+	// used are names of packages referenced by generated code
+	used map[string]bool
+}
+
+// receiver is name of receiver of generated methods.
+const receiver = "c"
+
+// params returns parameters of provided function with names, generating
+// names for unnamed ones (and ones that would shadow receiver), and
+// arguments that pass them on.
+func (g *generator) params(fn *ast.FuncType) (string, []string, error) {
+	var params, args []string
+	for i, field := range fn.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return "", nil, fmt.Errorf("variadic parameters are not supported")
+		}
+		typ := g.expr(field.Type)
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{ast.NewIdent("p" + strconv.Itoa(i))}
+		}
+		for _, n := range names {
+			name := n.Name
+			if name == "_" || name == receiver {
+				name = "p" + strconv.Itoa(len(args))
+			}
+			params = append(params, name+" "+typ)
+			args = append(args, name)
+		}
+	}
+	return strings.Join(params, ", "), args, nil
+}
+
+// expr returns source of provided node and records packages it uses.
+func (g *generator) expr(node ast.Node) string {
+	if node == nil {
+		return ""
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				g.used[id.Name] = true
+			}
+		}
+		return true
+	})
+	var b bytes.Buffer
+	if list, ok := node.(*ast.FieldList); ok {
+		// results are printed without parentheses
+		for i, f := range list.List {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			for j, n := range f.Names {
+				if j > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString(n.Name)
+			}
+			if len(f.Names) > 0 {
+				b.WriteString(" ")
+			}
+			printer.Fprint(&b, g.fset, f.Type)
+		}
+		return b.String()
+	}
+	printer.Fprint(&b, g.fset, node)
+	return b.String()
+}
+
+// writeImports writes imports of source file that are used by generated
+// code, together with import of this package.
+func (g *generator) writeImports(out *bytes.Buffer) {
+	imports := map[string]string{declarePath: ""}
+	for _, spec := range g.file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(p)
+		alias := ""
+		if spec.Name != nil {
+			name, alias = spec.Name.Name, spec.Name.Name
+		}
+		if g.used[name] {
+			imports[p] = alias
+		}
+	}
+	// standard library packages are in separate group
+	var std, other []string
+	for p := range imports {
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			other = append(other, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	out.WriteString("import (\n")
+	for i, group := range [][]string{std, other} {
+		if i > 0 && len(std) > 0 {
+			out.WriteString("\n")
+		}
+		for _, p := range group {
+			if alias := imports[p]; alias != "" {
+				fmt.Fprintf(out, "\t%s %q\n", alias, p)
+			} else {
+				fmt.Fprintf(out, "\t%q\n", p)
+			}
+		}
+	}
+	out.WriteString(")\n")
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
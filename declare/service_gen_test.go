@@ -0,0 +1,53 @@
+// Code generated by gwc-declare. DO NOT EDIT.
+
+package declare_test
+
+import (
+	"context"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/declare"
+)
+
+// userServiceFuncs holds functions bound to methods of userService.
+type userServiceFuncs struct {
+	Get    func(ctx context.Context, id string) (*user, error)              `gwc:"GET /users/:id" args:"path:id"`
+	Search func(p0 context.Context, p1 string, p2 []string) ([]user, error) `gwc:"GET /users" args:"query:q,query:tag"`
+	Delete func(p0 string) error                                            `gwc:"DELETE /users/:id" args:"path:id"`
+	Raw    func(ctx context.Context) (resp *gwc.Response, err error)        `gwc:"GET /raw"`
+}
+
+// userServiceClient implements userService with functions bound by declare.Binder.
+type userServiceClient struct {
+	funcs userServiceFuncs
+}
+
+// newUserService returns userService that sends requests with provided binder.
+// Error is returned if any method is not described correctly.
+func newUserService(b *declare.Binder) (userService, error) {
+	c := &userServiceClient{}
+	if err := b.Bind(&c.funcs); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get is implementation of userService.Get.
+func (c *userServiceClient) Get(ctx context.Context, id string) (*user, error) {
+	return c.funcs.Get(ctx, id)
+}
+
+// Search is implementation of userService.Search.
+func (c *userServiceClient) Search(p0 context.Context, p1 string, p2 []string) ([]user, error) {
+	return c.funcs.Search(p0, p1, p2)
+}
+
+// Delete is implementation of userService.Delete.
+func (c *userServiceClient) Delete(p0 string) error {
+	return c.funcs.Delete(p0)
+}
+
+// Raw is implementation of userService.Raw.
+func (c *userServiceClient) Raw(ctx context.Context) (resp *gwc.Response, err error) {
+	return c.funcs.Raw(ctx)
+}
@@ -0,0 +1,109 @@
+package declare_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/delicb/cliware-middlewares/headers"
+	"github.com/delicb/cliware-middlewares/url"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/declare"
+)
+
+//go:generate go run ../cmd/gwc-declare -type userService -o service_gen_test.go
+
+// userService is API implemented by generated code.
+type userService interface {
+	// Get returns user with provided ID.
+	// gwc:"GET /users/:id" args:"path:id"
+	Get(ctx context.Context, id string) (*user, error)
+	// gwc:"GET /users" args:"query:q,query:tag"
+	Search(context.Context, string, []string) ([]user, error)
+	// gwc:"DELETE /users/:id" args:"path:id"
+	Delete(c string) error
+	// gwc:"GET /raw"
+	Raw(ctx context.Context) (resp *gwc.Response, err error)
+}
+
+func TestGenerate(t *testing.T) {
+	src, err := ioutil.ReadFile("service_test.go")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	generated, err := declare.Generate(src, "userService")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	expected, err := ioutil.ReadFile("service_gen_test.go")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if string(generated) != string(expected) {
+		t.Errorf("Generated code differs from service_gen_test.go, run go generate. Got:\n%s", generated)
+	}
+}
+
+func TestGenerate_Invalid(t *testing.T) {
+	for _, src := range []string{
+		`package api; type API struct{}`,
+		`package api; type Other interface{}`,
+		"package api\ntype API interface {\n// Get has no tag.\nGet() error\n}",
+		"package api\ntype API interface {\n// gwc:\"GET /\" args:\"query:q\"\nGet(q ...string) error\n}",
+		"package api\ntype API interface {\nfmt.Stringer\n}",
+	} {
+		if _, err := declare.Generate([]byte(src), "API"); err == nil {
+			t.Errorf("Expected error for source: %s", src)
+		}
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/users/a b":
+			w.Write([]byte(`{"id": "a b", "name": "` + r.Header.Get("X-Method") + `"}`))
+		case r.Method == "GET" && r.URL.Path == "/users":
+			q := r.URL.Query()
+			w.Write([]byte(`[{"id": "` + q.Get("q") + `", "name": "` + q["tag"][0] + q["tag"][1] + `"}]`))
+		case r.Method == "DELETE":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/raw":
+			w.WriteHeader(http.StatusTeapot)
+		}
+	})
+	binder := declare.New(gwc.NewForHandler(handler), url.BaseURL("http://api.example.com")).
+		Method("Get", headers.Set("X-Method", "get"))
+	api, err := newUserService(binder)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	ctx := context.Background()
+
+	u, err := api.Get(ctx, "a b")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if u.ID != "a b" || u.Name != "get" {
+		t.Errorf("Wrong user. Got: %+v", u)
+	}
+	users, err := api.Search(ctx, "john", []string{"x", "y"})
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if len(users) != 1 || users[0].ID != "john" || users[0].Name != "xy" {
+		t.Errorf("Wrong users. Got: %+v", users)
+	}
+	if err := api.Delete("a"); err == nil {
+		t.Error("Expected error for status 404.")
+	}
+	resp, err := api.Raw(ctx)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != http.StatusTeapot {
+		t.Errorf("Wrong status code. Got: %d, expected: %d", resp.StatusCode, http.StatusTeapot)
+	}
+}
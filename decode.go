@@ -0,0 +1,157 @@
+package gwc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/delicb/cliware"
+)
+
+// ErrEmptyBody is returned when JSON is decoded from empty response body.
+var ErrEmptyBody = errors.New("gwc: response body is empty")
+
+// BodyTooLargeError is returned when response body is larger than allowed.
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+// Error is implementation of error interface.
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("gwc: response body is larger than %d bytes", e.Limit)
+}
+
+// DecodeError is returned when response body can not be decoded. It holds
+// offset in body at which decoding failed and part of body around it.
+type DecodeError struct {
+	Offset  int64
+	Snippet string
+	Err     error
+}
+
+// Error is implementation of error interface.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("gwc: decoding JSON failed at offset %d, near %q: %v", e.Offset, e.Snippet, e.Err)
+}
+
+// Unwrap returns original decoding error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// snippetSize is number of bytes of body shown on each side of offset at
+// which decoding failed.
+const snippetSize = 20
+
+func newDecodeError(data []byte, offset int64, err error) *DecodeError {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+	start, end := offset-snippetSize, offset+snippetSize
+	if start < 0 {
+		start = 0
+	}
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return &DecodeError{
+		Offset:  offset,
+		Snippet: string(data[start:end]),
+		Err:     err,
+	}
+}
+
+// jsonOptions holds options for decoding JSON response bodies.
+type jsonOptions struct {
+	disallowUnknownFields bool
+	useNumber             bool
+	rejectTrailingData    bool
+	maxBodySize           int64
+}
+
+// JSONOption configures how Response.JSON decodes response body.
+type JSONOption func(*jsonOptions)
+
+// DisallowUnknownFields makes decoding fail if body contains object keys
+// that do not match any field of destination structure.
+func DisallowUnknownFields() JSONOption {
+	return func(o *jsonOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// UseNumber makes numbers decoded to interface{} values json.Number
+// instead of float64.
+func UseNumber() JSONOption {
+	return func(o *jsonOptions) {
+		o.useNumber = true
+	}
+}
+
+// RejectTrailingData makes decoding fail if body contains anything except
+// whitespace after JSON value.
+func RejectTrailingData() JSONOption {
+	return func(o *jsonOptions) {
+		o.rejectTrailingData = true
+	}
+}
+
+// MaxBodySize makes decoding fail with *BodyTooLargeError if body is larger
+// than provided number of bytes.
+func MaxBodySize(n int64) JSONOption {
+	return func(o *jsonOptions) {
+		o.maxBodySize = n
+	}
+}
+
+type jsonOptionsKeyType string
+
+var jsonOptionsKey jsonOptionsKeyType = "json-options"
+
+// JSONDecoding returns middleware that sets options used by Response.JSON
+// to decode response body. It can be used with Client, Group or single
+// Request. Options are added to ones set before, so request options are
+// applied after group and client options.
+func JSONDecoding(options ...JSONOption) cliware.Middleware {
+	return cliware.ContextProcessor(func(ctx context.Context) context.Context {
+		existing := jsonOptionsFromContext(ctx)
+		all := make([]JSONOption, 0, len(existing)+len(options))
+		all = append(append(all, existing...), options...)
+		return context.WithValue(ctx, jsonOptionsKey, all)
+	})
+}
+
+func jsonOptionsFromContext(ctx context.Context) []JSONOption {
+	options, _ := ctx.Value(jsonOptionsKey).([]JSONOption)
+	return options
+}
+
+// decodeJSON decodes data to provided value using provided options.
+func decodeJSON(data []byte, v interface{}, o *jsonOptions) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return ErrEmptyBody
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if o.useNumber {
+		decoder.UseNumber()
+	}
+	if o.disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(v); err != nil {
+		return newDecodeError(data, decoder.InputOffset(), err)
+	}
+	if o.rejectTrailingData {
+		offset := decoder.InputOffset()
+		if _, err := decoder.Token(); err != io.EOF {
+			return newDecodeError(data, offset, errors.New("trailing data after JSON value"))
+		}
+	}
+	return nil
+}
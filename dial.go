@@ -0,0 +1,208 @@
+package gwc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/delicb/cliware"
+
+	"github.com/delicb/gwc/internal/wrap"
+)
+
+// unixScheme is scheme of URLs of HTTP servers listening on Unix sockets,
+// like unix:///var/run/docker.sock:/v1.41/containers/json, where socket
+// path is followed by colon and URL path, which starts with slash.
+const unixScheme = "unix://"
+
+// unixHost is host set to URLs of requests sent over Unix sockets.
+const unixHost = "unix"
+
+// isUnixURL reports if provided URL has unix scheme.
+func isUnixURL(rawURL string) bool {
+	return strings.HasPrefix(rawURL, unixScheme)
+}
+
+// splitUnixURL splits URL with unix scheme to socket path and HTTP URL
+// that should be requested over it. Socket path ends at colon followed by
+// slash, so socket paths can contain other colons. If there are multiple
+// such colons, or socket path without URL path contains one, first of
+// possible socket paths that is existing socket is used, so it should be
+// called only when request is sent.
+func splitUnixURL(rawURL string) (socket, httpURL string) {
+	rest := strings.TrimPrefix(rawURL, unixScheme)
+	var sockets []string
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == ':' && (i+1 == len(rest) || rest[i+1] == '/') {
+			sockets = append(sockets, rest[:i])
+		}
+	}
+	sockets = append(sockets, rest)
+	socket = sockets[0]
+	if len(sockets) > 1 {
+		for _, s := range sockets {
+			if info, err := os.Stat(s); err == nil && info.Mode()&os.ModeSocket != 0 {
+				socket = s
+				break
+			}
+		}
+	}
+	path := strings.TrimPrefix(rest[len(socket):], ":")
+	if path == "" {
+		path = "/"
+	}
+	return socket, "http://" + unixHost + path
+}
+
+// unixURL returns middleware that sends request to Unix socket from
+// provided unix URL and sets HTTP URL requested over socket with middleware
+// that set returns for it (like url.URL). Socket path is resolved when
+// request is sent, since it depends on sockets that exist.
+func unixURL(rawURL string, set func(string) cliware.Middleware) cliware.Middleware {
+	return cliware.MiddlewareFunc(func(next cliware.Handler) cliware.Handler {
+		return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			socket, httpURL := splitUnixURL(rawURL)
+			return UnixSocket(socket).Exec(set(httpURL).Exec(next)).Handle(req)
+		})
+	})
+}
+
+type dialerKeyType string
+
+var dialerKey dialerKeyType = "dialer"
+
+// dialer is function that opens connections for requests. Key identifies
+// transport that is created for dialer, so that connections are reused.
+type dialer struct {
+	key  interface{}
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// DialContext returns middleware that makes requests open connections using
+// provided function, instead of dialer of transport of http.Client. Address
+// that function gets is host and port of request URL, so requests keep
+// normal HTTP semantics (like Host header and BaseURL and Path
+// middlewares), but can be sent anywhere. Requests are never sent through
+// proxy of transport, since function decides where they are sent.
+//
+// Transport of http.Client has to be *http.Transport or transport of client
+// created by trust or proxy package, whose *http.Transport is copied for
+// each middleware returned by this function. Custom dialers can not be used
+// with clients created by ssrf package, since they would bypass its checks
+// of connections. Middleware should be created
+// once and reused (for example, by setting it on Group), so that
+// connections are reused as well. Client keeps at most 64 copies and
+// closes idle connections of least recently used one when new one is
+// needed.
+func DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) cliware.Middleware {
+	d := &dialer{dial: dial}
+	d.key = d
+	return dialerMiddleware(d)
+}
+
+// UnixSocket returns middleware that sends requests to HTTP server that
+// listens on Unix socket with provided path. Scheme and host of request
+// URL are not used for connecting, but should still be set, for example to
+// "http://localhost". Requests to same socket share connections.
+func UnixSocket(path string) cliware.Middleware {
+	return dialerMiddleware(&dialer{
+		key: unixScheme + path,
+		dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	})
+}
+
+func dialerMiddleware(d *dialer) cliware.Middleware {
+	return cliware.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, dialerKey, d)
+	})
+}
+
+// maxDialTransports is number of transports for custom dialers that are
+// kept by client.
+const maxDialTransports = 64
+
+// dialTransport sends requests that have custom dialer using transport
+// created for that dialer and all other requests using next transport.
+type dialTransport struct {
+	next http.RoundTripper
+
+	mu         sync.Mutex
+	transports map[interface{}]http.RoundTripper
+	// keys of transports, from least to most recently used
+	keys []interface{}
+}
+
+func newDialTransport(next http.RoundTripper) *dialTransport {
+	return &dialTransport{
+		next:       next,
+		transports: make(map[interface{}]http.RoundTripper),
+	}
+}
+
+// RoundTrip is implementation of http.RoundTripper interface.
+func (t *dialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	d, ok := req.Context().Value(dialerKey).(*dialer)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	transport, err := t.transport(d)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return transport.RoundTrip(req)
+}
+
+// transport returns transport for provided dialer, creating it if needed.
+// It is copy of *http.Transport of next transport, wrapped in the same
+// wrappers (like the one of trust package).
+func (t *dialTransport) transport(d *dialer) (http.RoundTripper, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if transport, ok := t.transports[d.key]; ok {
+		t.touch(d.key)
+		return transport, nil
+	}
+	if wrap.Restricted(t.next) {
+		return nil, fmt.Errorf("gwc: custom dialer can not be used with transport of type %T, since it restricts connections", t.next)
+	}
+	base, rewrap, ok := wrap.Unwrap(t.next)
+	if !ok || base == nil {
+		return nil, fmt.Errorf("gwc: custom dialer can not be used with transport of type %T, *http.Transport is required", t.next)
+	}
+	configured := base.Clone()
+	configured.DialContext = d.dial
+	configured.DialTLSContext = nil
+	configured.DialTLS = nil
+	configured.Proxy = nil
+	transport := rewrap(configured)
+	if len(t.keys) == maxDialTransports {
+		oldest := t.keys[0]
+		t.keys = t.keys[1:]
+		wrap.CloseIdleConnections(t.transports[oldest])
+		delete(t.transports, oldest)
+	}
+	t.transports[d.key] = transport
+	t.keys = append(t.keys, d.key)
+	return transport, nil
+}
+
+// touch marks transport with provided key as most recently used.
+func (t *dialTransport) touch(key interface{}) {
+	for i, k := range t.keys {
+		if k == key {
+			copy(t.keys[i:], t.keys[i+1:])
+			t.keys[len(t.keys)-1] = key
+			return
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package gwc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/delicb/cliware-middlewares/url"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/ssrf"
+	"github.com/delicb/gwc/trust"
+)
+
+// newUnixServer starts HTTP server on Unix socket that responds with path
+// and host of requests.
+func newUnixServer(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gwc")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	// colon followed by slash in socket path has to be handled when parsing
+	// unix URLs
+	socket := filepath.Join(dir, "gwc:", "server.sock")
+	if err := os.Mkdir(filepath.Dir(socket), 0700); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Got unexpected error:", err)
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal("Got unexpected error:", err)
+	}
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host + r.URL.RequestURI()))
+	}))
+	return socket, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	socket, stop := newUnixServer(t)
+	defer stop()
+	client := gwc.New(nil).UnixURLs()
+	group := gwc.NewGroup(client).UnixSocket(socket)
+
+	for _, data := range []struct {
+		Name     string
+		Request  func() (*gwc.Response, error)
+		Expected string
+	}{
+		{
+			Name: "unix URL",
+			Request: func() (*gwc.Response, error) {
+				return client.Get().URL("unix://" + socket + ":/v1.41/containers/json?all=1").Send()
+			},
+			Expected: "unix/v1.41/containers/json?all=1",
+		},
+		{
+			Name: "unix URL without path",
+			Request: func() (*gwc.Response, error) {
+				return client.Get().URL("unix://" + socket).Send()
+			},
+			Expected: "unix/",
+		},
+		{
+			Name: "unix base URL",
+			Request: func() (*gwc.Response, error) {
+				return client.Get().BaseURL("unix://" + socket).Path("/info").Send()
+			},
+			Expected: "unix/info",
+		},
+		{
+			Name: "request option",
+			Request: func() (*gwc.Response, error) {
+				return client.Get().UnixSocket(socket).BaseURL("http://docker").Path("/version").Send()
+			},
+			Expected: "docker/version",
+		},
+		{
+			Name: "group option",
+			Request: func() (*gwc.Response, error) {
+				return group.Do(url.URL("http://localhost/ping"))
+			},
+			Expected: "localhost/ping",
+		},
+	} {
+		resp, err := data.Request()
+		if err != nil {
+			t.Fatalf("%s: Got unexpected error: %v", data.Name, err)
+		}
+		body, err := resp.String()
+		if err != nil {
+			t.Fatalf("%s: Got unexpected error: %v", data.Name, err)
+		}
+		if body != data.Expected {
+			t.Errorf("%s: Wrong body. Got: %s, expected: %s", data.Name, body, data.Expected)
+		}
+	}
+
+	if _, err := client.Get().BaseURL("unix://"+socket, "http://localhost").Send(); err == nil {
+		t.Error("Expected error for Unix socket base URL with fallbacks.")
+	}
+
+	// unix URLs have to be enabled
+	other := gwc.New(nil)
+	if _, err := other.Get().URL("unix://" + socket + ":/info").Send(); err == nil {
+		t.Error("Expected error for unix URL that is not enabled.")
+	}
+	if _, err := other.Get().BaseURL("unix://" + socket).Path("/info").Send(); err == nil {
+		t.Error("Expected error for unix base URL that is not enabled.")
+	}
+	if _, err := other.Get().UnixSocket(socket).URL("http://localhost/info").Send(); err != nil {
+		t.Error("Got unexpected error:", err)
+	}
+}
+
+func TestUnixSocket_ConfiguredClients(t *testing.T) {
+	socket, stop := newUnixServer(t)
+	defer stop()
+
+	trusted, err := trust.New().Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	resp, err := gwc.New(trusted).Get().UnixSocket(socket).URL("http://localhost/info").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body, _ := resp.String(); body != "localhost/info" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "localhost/info")
+	}
+
+	// custom dialer would bypass checks of guarded clients
+	guarded, err := ssrf.New().Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	trustedGuarded, err := trust.New().Client(guarded)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for _, client := range []*http.Client{guarded, trustedGuarded} {
+		_, err := gwc.New(client).Get().UnixSocket(socket).URL("http://example.com/").Send()
+		if err == nil || !strings.Contains(err.Error(), "restricts connections") {
+			t.Errorf("Wrong error for custom dialer with guarded client. Got: %v", err)
+		}
+	}
+}
+
+func TestGroup_DialContext(t *testing.T) {
+	server := httptest.NewServer(bodyHandler("ok"))
+	defer server.Close()
+	address := server.Listener.Addr().String()
+
+	var dials int32
+	// custom dialer is used instead of proxy
+	client := gwc.New(&http.Client{Transport: &http.Transport{
+		Proxy: http.ProxyURL(&neturl.URL{Scheme: "http", Host: "proxy.invalid:3128"}),
+	}})
+	group := gwc.NewGroup(client).DialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		if addr != "service.invalid:80" {
+			t.Errorf("Wrong address. Got: %s, expected: %s", addr, "service.invalid:80")
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	})
+	for i := 0; i < 3; i++ {
+		resp, err := group.Do(url.URL("http://service.invalid/"))
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if body, _ := resp.String(); body != "ok" {
+			t.Errorf("Wrong body. Got: %s, expected: %s", body, "ok")
+		}
+	}
+	if dials != 1 {
+		t.Errorf("Connection not reused. Got dials: %d, expected: %d", dials, 1)
+	}
+
+	// requests outside of group use regular dialer and proxy
+	if _, err := client.Get().URL(server.URL).Send(); err == nil {
+		t.Error("Expected error for request sent through invalid proxy.")
+	}
+	if dials != 1 {
+		t.Errorf("Custom dialer used outside of group. Got dials: %d", dials)
+	}
+
+	// custom dialers require *http.Transport
+	handlerClient := gwc.NewForHandler(bodyHandler("ok"))
+	if _, err := gwc.NewGroup(handlerClient).UnixSocket("/nonexistent.sock").Do(url.URL("http://localhost/")); err == nil {
+		t.Error("Expected error for transport that is not *http.Transport.")
+	}
+}
+
+func TestDialContext_TransportLimit(t *testing.T) {
+	server := httptest.NewServer(bodyHandler("ok"))
+	defer server.Close()
+	address := server.Listener.Addr().String()
+
+	client := gwc.New(nil)
+	dialers := make([]int32, 129)
+	send := func(i int) {
+		m := gwc.DialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dialers[i], 1)
+			var d net.Dialer
+			return d.DialContext(ctx, network, address)
+		})
+		resp, err := client.Get().Use(m).URL("http://service.invalid/").Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		resp.String()
+	}
+	first := gwc.DialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		atomic.AddInt32(&dialers[0], 1)
+		var d net.Dialer
+		return d.DialContext(ctx, network, address)
+	})
+	sendFirst := func() {
+		resp, err := client.Get().Use(first).URL("http://service.invalid/").Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		resp.String()
+	}
+
+	sendFirst()
+	for i := 1; i < 64; i++ {
+		send(i)
+	}
+	// transport of first dialer is most recently used, so it is kept
+	sendFirst()
+	send(64)
+	sendFirst()
+	if dialers[0] != 1 {
+		t.Errorf("Connection not reused. Got dials: %d, expected: %d", dialers[0], 1)
+	}
+	for i := 65; i < len(dialers); i++ {
+		send(i)
+	}
+	sendFirst()
+	if dialers[0] != 2 {
+		t.Errorf("Transport not removed. Got dials: %d, expected: %d", dialers[0], 2)
+	}
+}
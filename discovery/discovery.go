@@ -0,0 +1,244 @@
+// Package discovery contains service discovery for gwc clients.
+//
+// Requests are sent to logical service name instead of concrete host, using
+// URL like svc://billing/v1/invoices. Discovery middleware attaches itself
+// to request context and RoundTripper returned by NewTransport resolves
+// service name to endpoints when request is sent, picks one of them using
+// balancing strategy and replaces scheme and host of request URL. Clients
+// created with gwc.New already use this RoundTripper.
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/gwc/balance"
+)
+
+// Scheme is URL scheme used for requests to logical services.
+const Scheme = "svc"
+
+// DefaultTTL is duration for which resolved endpoints are cached, if not
+// configured otherwise.
+const DefaultTTL = 30 * time.Second
+
+// Resolver maps logical service name to URLs of its endpoints. Only scheme
+// and host of returned URLs are used.
+type Resolver interface {
+	Resolve(ctx context.Context, service string) ([]*url.URL, error)
+}
+
+// TargetResolver is Resolver that also resolves priorities and weights of
+// endpoints. Discovery uses them for balancing requests, if its resolver
+// implements this interface.
+type TargetResolver interface {
+	Resolver
+	ResolveTargets(ctx context.Context, service string) ([]balance.Target, error)
+}
+
+// ResolverFunc is adapter that allows usage of ordinary function as Resolver.
+type ResolverFunc func(ctx context.Context, service string) ([]*url.URL, error)
+
+// Resolve is implementation of Resolver interface.
+func (f ResolverFunc) Resolve(ctx context.Context, service string) ([]*url.URL, error) {
+	return f(ctx, service)
+}
+
+// service is cached resolution of single service.
+type service struct {
+	balancer *balance.Balancer
+	expires  time.Time
+}
+
+// Discovery resolves logical service names using resolver and caches
+// results.
+type Discovery struct {
+	resolver Resolver
+	ttl      time.Duration
+	strategy func() balance.Strategy
+
+	mu          sync.Mutex
+	services    map[string]*service
+	resolutions map[string]*resolution
+}
+
+// New creates and returns Discovery that uses provided resolver. Resolved
+// endpoints are cached for DefaultTTL and balanced using round robin.
+func New(resolver Resolver) *Discovery {
+	return &Discovery{
+		resolver:    resolver,
+		ttl:         DefaultTTL,
+		strategy:    balance.RoundRobin,
+		services:    make(map[string]*service),
+		resolutions: make(map[string]*resolution),
+	}
+}
+
+// TTL sets duration for which resolved endpoints are cached.
+func (d *Discovery) TTL(ttl time.Duration) *Discovery {
+	d.ttl = ttl
+	return d
+}
+
+// Strategy sets function that creates balancing strategy for each service.
+func (d *Discovery) Strategy(strategy func() balance.Strategy) *Discovery {
+	d.strategy = strategy
+	return d
+}
+
+// Exec is implementation of cliware.Middleware interface. It sets discovery
+// to request context.
+func (d *Discovery) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, discoveryKey, d)
+	}).Exec(next)
+}
+
+// Balancer returns balancer for provided service, resolving its endpoints
+// if they are not cached or cache expired. If resolving fails and there are
+// previously resolved endpoints, they are used. Only one resolution of
+// service is in progress at a time, other callers use previously resolved
+// endpoints or wait for resolution to finish.
+func (d *Discovery) Balancer(ctx context.Context, name string) (*balance.Balancer, error) {
+	d.mu.Lock()
+	s, ok := d.services[name]
+	if ok && time.Now().Before(s.expires) {
+		d.mu.Unlock()
+		return s.balancer, nil
+	}
+	c, inProgress := d.resolutions[name]
+	if !inProgress {
+		c = &resolution{done: make(chan struct{})}
+		d.resolutions[name] = c
+	}
+	d.mu.Unlock()
+
+	if inProgress {
+		if ok {
+			return s.balancer, nil
+		}
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if c.err != nil && ctx.Err() == nil && (errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded)) {
+			// resolution was canceled by context of other caller
+			return d.Balancer(ctx, name)
+		}
+		return c.balancer, c.err
+	}
+
+	b, err := d.resolve(ctx, name)
+	d.mu.Lock()
+	delete(d.resolutions, name)
+	d.mu.Unlock()
+	c.balancer, c.err = b, err
+	close(c.done)
+	return b, err
+}
+
+// resolution is resolution of service that is in progress.
+type resolution struct {
+	done     chan struct{}
+	balancer *balance.Balancer
+	err      error
+}
+
+// resolve resolves endpoints of provided service and updates its balancer.
+func (d *Discovery) resolve(ctx context.Context, name string) (*balance.Balancer, error) {
+	targets, err := d.targets(ctx, name)
+	if err == nil && len(targets) == 0 {
+		err = fmt.Errorf("discovery: no endpoints for service %q", name)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.services[name]
+	if err != nil {
+		if ok {
+			return s.balancer, nil
+		}
+		return nil, err
+	}
+	if !ok {
+		raw := make([]string, len(targets))
+		for i, t := range targets {
+			raw[i] = t.URL.String()
+		}
+		b, err := balance.New(d.strategy(), raw...)
+		if err != nil {
+			return nil, err
+		}
+		s = &service{balancer: b}
+		d.services[name] = s
+	}
+	s.balancer.SetTargets(targets)
+	s.expires = time.Now().Add(d.ttl)
+	return s.balancer, nil
+}
+
+// targets resolves endpoints of provided service, with priorities and
+// weights if resolver supports them.
+func (d *Discovery) targets(ctx context.Context, name string) ([]balance.Target, error) {
+	if r, ok := d.resolver.(TargetResolver); ok {
+		return r.ResolveTargets(ctx, name)
+	}
+	urls, err := d.resolver.Resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]balance.Target, len(urls))
+	for i, u := range urls {
+		targets[i] = balance.Target{URL: u}
+	}
+	return targets, nil
+}
+
+type discoveryKeyType string
+
+var discoveryKey discoveryKeyType = "discovery"
+
+// FromContext returns discovery set to provided context or nil if there is
+// none.
+func FromContext(ctx context.Context) *Discovery {
+	if d, ok := ctx.Value(discoveryKey).(*Discovery); ok {
+		return d
+	}
+	return nil
+}
+
+// NewTransport returns RoundTripper that resolves requests with svc scheme
+// using discovery from request context. All other requests are sent
+// unchanged. If next is nil, http.DefaultTransport is used.
+func NewTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != Scheme {
+		return t.next.RoundTrip(req)
+	}
+	d := FromContext(req.Context())
+	if d == nil {
+		return nil, fmt.Errorf("discovery: no discovery configured for %s", req.URL)
+	}
+	b, err := d.Balancer(req.Context(), req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	return b.Send(t.next, req)
+}
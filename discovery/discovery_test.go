@@ -0,0 +1,269 @@
+package discovery_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/discovery"
+)
+
+// urlRecorder is mock transport that records URLs of all requests.
+type urlRecorder struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (r *urlRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.urls = append(r.urls, req.URL.String())
+	return &http.Response{StatusCode: 200, Body: http.NoBody, Request: req}, nil
+}
+
+func (r *urlRecorder) last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.urls[len(r.urls)-1]
+}
+
+func TestStatic(t *testing.T) {
+	resolver, err := discovery.Static(map[string][]string{
+		"billing": {"http://10.0.0.1:8080", "http://10.0.0.2:8080"},
+	})
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	recorder := &urlRecorder{}
+	client := gwc.New(&http.Client{Transport: recorder}, discovery.New(resolver))
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get().URL("svc://billing/v1/invoices?page=2").Send(); err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+	}
+	expected := []string{
+		"http://10.0.0.1:8080/v1/invoices?page=2",
+		"http://10.0.0.2:8080/v1/invoices?page=2",
+	}
+	for i := range expected {
+		if recorder.urls[i] != expected[i] {
+			t.Errorf("Wrong URL. Got: %s, expected: %s", recorder.urls[i], expected[i])
+		}
+	}
+}
+
+func TestUnknownService(t *testing.T) {
+	resolver, _ := discovery.Static(map[string][]string{})
+	client := gwc.New(&http.Client{Transport: &urlRecorder{}}, discovery.New(resolver))
+	if _, err := client.Post().URL("svc://unknown/").Send(); err == nil {
+		t.Error("Expected error for unknown service.")
+	}
+}
+
+func TestCache(t *testing.T) {
+	calls := 0
+	fail := false
+	resolver := discovery.ResolverFunc(func(ctx context.Context, name string) ([]*url.URL, error) {
+		calls++
+		if fail {
+			return nil, errors.New("resolver down")
+		}
+		return []*url.URL{{Scheme: "http", Host: "a"}}, nil
+	})
+	d := discovery.New(resolver).TTL(time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, err := d.Balancer(context.Background(), "svc"); err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Wrong number of resolver calls. Got: %d, expected: 1", calls)
+	}
+
+	// stale results are used when resolver fails
+	d.TTL(0)
+	fail = true
+	if _, err := d.Balancer(context.Background(), "svc"); err != nil {
+		t.Error("Stale endpoints not used when resolver failed:", err)
+	}
+}
+
+func TestDNSSRV(t *testing.T) {
+	lookup := func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		if name != "_billing._tcp.example.com" {
+			return "", nil, errors.New("no such host")
+		}
+		return "", []*net.SRV{{Target: "host1.example.com.", Port: 8080}}, nil
+	}
+	urls, err := discovery.DNSSRV(lookup, "https").Resolve(context.Background(), "_billing._tcp.example.com")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if len(urls) != 1 || urls[0].String() != "https://host1.example.com:8080" {
+		t.Errorf("Wrong URLs: %v", urls)
+	}
+}
+
+func TestDNSSRV_PriorityAndWeight(t *testing.T) {
+	lookup := func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+		return "", []*net.SRV{
+			{Target: "backup.example.com.", Port: 80, Priority: 20, Weight: 100},
+			{Target: "light.example.com.", Port: 80, Priority: 10, Weight: 10},
+			{Target: "unused.example.com.", Port: 80, Priority: 10, Weight: 0},
+			{Target: "heavy.example.com.", Port: 80, Priority: 10, Weight: 90},
+		}, nil
+	}
+	resolver := discovery.DNSSRV(lookup, "http")
+	urls, err := resolver.Resolve(context.Background(), "_api._tcp.example.com")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	var hosts []string
+	for _, u := range urls {
+		hosts = append(hosts, u.Hostname())
+	}
+	expected := "heavy.example.com light.example.com unused.example.com backup.example.com"
+	if got := strings.Join(hosts, " "); got != expected {
+		t.Errorf("Wrong endpoints. Got: %s, expected: %s", got, expected)
+	}
+
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	failing := make(map[string]bool)
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		host := req.URL.Hostname()
+		counts[host]++
+		status := 200
+		if failing[host] {
+			status = 500
+		}
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+	})
+	d := discovery.New(resolver)
+	b, err := d.Balancer(context.Background(), "_api._tcp.example.com")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	b.OutlierEjection(1, time.Hour)
+	client := gwc.New(&http.Client{Transport: transport}, d)
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			resp, err := client.Get().URL("svc://_api._tcp.example.com/").Send()
+			if err != nil {
+				t.Fatal("Got unexpected error:", err)
+			}
+			resp.Body.Close()
+		}
+	}
+
+	// weights are honored among targets with lowest priority
+	send(100)
+	if counts["heavy.example.com"] != 90 || counts["light.example.com"] != 10 || len(counts) != 2 {
+		t.Errorf("Wrong distribution of requests: %v", counts)
+	}
+
+	// targets with zero weight and then targets with higher priority are
+	// used when preferred ones are not available
+	for _, data := range []struct {
+		Failing  []string
+		Expected string
+	}{
+		{[]string{"heavy.example.com", "light.example.com"}, "unused.example.com"},
+		{[]string{"unused.example.com"}, "backup.example.com"},
+	} {
+		mu.Lock()
+		for _, host := range data.Failing {
+			failing[host] = true
+		}
+		counts = make(map[string]int)
+		mu.Unlock()
+		send(20)
+		if counts[data.Expected] == 0 {
+			t.Errorf("Requests not sent to %s: %v", data.Expected, counts)
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCache_SingleResolution(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	resolver := discovery.ResolverFunc(func(ctx context.Context, name string) ([]*url.URL, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []*url.URL{{Scheme: "http", Host: "a"}}, nil
+	})
+	d := discovery.New(resolver).TTL(time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.Balancer(context.Background(), "svc"); err != nil {
+				t.Error("Got unexpected error:", err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Wrong number of resolver calls. Got: %d, expected: 1", calls)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+	if err := ioutil.WriteFile(path, []byte(`{"billing": ["http://a:80"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := discovery.File(path, time.Millisecond)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	defer resolver.Close()
+	recorder := &urlRecorder{}
+	client := gwc.New(&http.Client{Transport: recorder}, discovery.New(resolver).TTL(0))
+	client.Get().URL("svc://billing/").Send()
+	if got := recorder.last(); got != "http://a:80/" {
+		t.Errorf("Wrong URL. Got: %s, expected: http://a:80/", got)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"billing": ["http://b:8080"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		client.Get().URL("svc://billing/").Send()
+		if recorder.last() == "http://b:8080/" {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("File changes not picked up. Last URL: %s", recorder.last())
+}
@@ -0,0 +1,220 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/delicb/gwc/balance"
+)
+
+// Static returns resolver that resolves services from provided map of
+// service names to endpoint URLs.
+func Static(services map[string][]string) (Resolver, error) {
+	resolved, err := parseServices(services)
+	if err != nil {
+		return nil, err
+	}
+	return ResolverFunc(func(ctx context.Context, name string) ([]*url.URL, error) {
+		urls, ok := resolved[name]
+		if !ok {
+			return nil, fmt.Errorf("discovery: unknown service %q", name)
+		}
+		return urls, nil
+	}), nil
+}
+
+func parseServices(services map[string][]string) (map[string][]*url.URL, error) {
+	resolved := make(map[string][]*url.URL, len(services))
+	for name, rawURLs := range services {
+		for _, raw := range rawURLs {
+			u, err := url.Parse(raw)
+			if err != nil {
+				return nil, err
+			}
+			if u.Host == "" {
+				return nil, fmt.Errorf("discovery: endpoint %q of service %q has no host", raw, name)
+			}
+			resolved[name] = append(resolved[name], u)
+		}
+	}
+	return resolved, nil
+}
+
+// LookupSRVFunc is function that looks up DNS SRV records, with same
+// signature as LookupSRV method of net.Resolver.
+type LookupSRVFunc func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+// DNSSRV returns resolver that resolves service name by looking up DNS SRV
+// records with that name (for example, _billing._tcp.example.com) and uses
+// provided scheme for all endpoints. Usually, lookup is
+// net.DefaultResolver.LookupSRV.
+//
+// Returned resolver is TargetResolver, so Discovery balances requests
+// according to priorities and weights of records: targets with lowest
+// priority are used while any of them is available and requests are
+// distributed among them in proportion to their weights. Resolve returns
+// all targets, ordered by priority and weight.
+func DNSSRV(lookup LookupSRVFunc, scheme string) Resolver {
+	return &srvResolver{lookup: lookup, scheme: scheme}
+}
+
+type srvResolver struct {
+	lookup LookupSRVFunc
+	scheme string
+}
+
+// Resolve is implementation of Resolver interface.
+func (r *srvResolver) Resolve(ctx context.Context, name string) ([]*url.URL, error) {
+	targets, err := r.ResolveTargets(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		if targets[i].Priority != targets[j].Priority {
+			return targets[i].Priority < targets[j].Priority
+		}
+		return targets[i].Weight > targets[j].Weight
+	})
+	urls := make([]*url.URL, len(targets))
+	for i, t := range targets {
+		urls[i] = t.URL
+	}
+	return urls, nil
+}
+
+// ResolveTargets is implementation of TargetResolver interface.
+func (r *srvResolver) ResolveTargets(ctx context.Context, name string) ([]balance.Target, error) {
+	_, records, err := r.lookup(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]balance.Target, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		targets = append(targets, balance.Target{
+			URL: &url.URL{
+				Scheme: r.scheme,
+				Host:   net.JoinHostPort(host, strconv.Itoa(int(record.Port))),
+			},
+			Priority: int(record.Priority),
+			Weight:   int(record.Weight),
+		})
+	}
+	return targets, nil
+}
+
+// FileResolver is resolver that reads services from JSON file and reloads it
+// when it changes. File contains object that maps service names to lists of
+// endpoint URLs, for example:
+//
+//	{"billing": ["http://10.0.0.1:8080", "http://10.0.0.2:8080"]}
+type FileResolver struct {
+	path string
+	stop chan struct{}
+	once sync.Once
+
+	mu       sync.RWMutex
+	services map[string][]*url.URL
+	modTime  time.Time
+	size     int64
+	err      error
+}
+
+// File creates and returns resolver that reads services from file with
+// provided path and checks it for changes every interval. Returned resolver
+// should be closed when it is no longer used.
+func File(path string, interval time.Duration) (*FileResolver, error) {
+	r := &FileResolver{
+		path: path,
+		stop: make(chan struct{}),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	go r.watch(interval)
+	return r, nil
+}
+
+// Resolve is implementation of Resolver interface.
+func (r *FileResolver) Resolve(ctx context.Context, name string) ([]*url.URL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	urls, ok := r.services[name]
+	if !ok {
+		return nil, fmt.Errorf("discovery: unknown service %q", name)
+	}
+	return urls, nil
+}
+
+// Err returns error from last attempt to reload file or nil if it
+// succeeded. Services from last successful load are used if reload fails.
+func (r *FileResolver) Err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.err
+}
+
+// Close stops watching file for changes.
+func (r *FileResolver) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	return nil
+}
+
+func (r *FileResolver) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			err := r.load()
+			r.mu.Lock()
+			r.err = err
+			r.mu.Unlock()
+		}
+	}
+}
+
+// load reads file if it changed since last load.
+func (r *FileResolver) load() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	unchanged := r.services != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	raw := make(map[string][]string)
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("discovery: unable to parse %s: %v", r.path, err)
+	}
+	services, err := parseServices(raw)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.services = services
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+	r.mu.Unlock()
+	return nil
+}
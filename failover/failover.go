@@ -0,0 +1,181 @@
+// Package failover contains middleware that sends requests to base URLs in
+// order of priority, switching to next one when current one fails.
+//
+// Unlike load balancing, all requests go to first healthy base URL. Base URL
+// that failed is not used until its cooldown period expires, so secondary
+// base URLs only get traffic while primary is failing.
+package failover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+// DefaultCooldown is time for which failed base URL is not used, if not
+// configured otherwise.
+const DefaultCooldown = 30 * time.Second
+
+// target is single base URL with information about its last failure.
+type target struct {
+	url         *url.URL
+	failedUntil time.Time
+}
+
+// Failover is middleware that sets scheme and host of request to first
+// healthy base URL and tries next one if request fails.
+type Failover struct {
+	cooldown    time.Duration
+	statusCodes map[int]bool
+
+	mu      sync.Mutex
+	targets []*target
+}
+
+// New creates and returns new Failover for provided base URLs, in order of
+// priority. Only scheme and host are used from provided URLs. By default,
+// only connection errors are considered failures. Errors of middlewares
+// that stop request before it is sent do not change health of base URLs.
+func New(cooldown time.Duration, rawURLs ...string) (*Failover, error) {
+	if len(rawURLs) == 0 {
+		return nil, fmt.Errorf("failover: no base URLs provided")
+	}
+	f := &Failover{
+		cooldown:    cooldown,
+		statusCodes: make(map[int]bool),
+	}
+	for _, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host == "" {
+			return nil, fmt.Errorf("failover: base URL %q has no host", raw)
+		}
+		if u.Scheme == "" {
+			u.Scheme = "https"
+		}
+		f.targets = append(f.targets, &target{url: u})
+	}
+	return f, nil
+}
+
+// OnStatus sets response status codes that are considered failures, in
+// addition to connection errors.
+func (f *Failover) OnStatus(codes ...int) *Failover {
+	for _, c := range codes {
+		f.statusCodes[c] = true
+	}
+	return f
+}
+
+// Active returns base URL that next request will be sent to first.
+func (f *Failover) Active() *url.URL {
+	return f.order()[0].url
+}
+
+// order returns targets in order they should be tried. Targets in cooldown
+// are moved to the end, but are still tried as last resort.
+func (f *Failover) order() []*target {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	healthy := make([]*target, 0, len(f.targets))
+	var failed []*target
+	for _, t := range f.targets {
+		if now.Before(t.failedUntil) {
+			failed = append(failed, t)
+		} else {
+			healthy = append(healthy, t)
+		}
+	}
+	return append(healthy, failed...)
+}
+
+func (f *Failover) markFailed(t *target) {
+	f.mu.Lock()
+	t.failedUntil = time.Now().Add(f.cooldown)
+	f.mu.Unlock()
+}
+
+func (f *Failover) markHealthy(t *target) {
+	f.mu.Lock()
+	t.failedUntil = time.Time{}
+	f.mu.Unlock()
+}
+
+// failed returns true if request failed with connection error or got
+// response with one of configured status codes. Errors returned together
+// with response (for example, by middleware that converts status codes to
+// errors) are not considered connection errors.
+func (f *Failover) failed(resp *http.Response, err error) bool {
+	if resp == nil {
+		return connectionError(err)
+	}
+	return f.statusCodes[resp.StatusCode]
+}
+
+// connectionError returns true if provided error is returned by transport
+// of HTTP client, as opposed to errors of middlewares (like validation
+// errors or dry run of gwc.Request.Build) that stop request before it is
+// sent. Errors of http.Client are *url.Error, which is net.Error as well.
+func connectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (f *Failover) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		var body []byte
+		if req.Body != nil {
+			var err error
+			body, err = ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		targets := f.order()
+		var resp *http.Response
+		var err error
+		for i, t := range targets {
+			r := req.Clone(req.Context())
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			r.URL.Scheme = t.url.Scheme
+			r.URL.Host = t.url.Host
+			if r.Host == req.URL.Host {
+				// Host header that was set explicitly is preserved
+				r.Host = ""
+			}
+
+			resp, err = next.Handle(r)
+			if req.Context().Err() != nil {
+				return resp, err
+			}
+			if resp == nil && !connectionError(err) {
+				// request was not sent, so nothing is known about
+				// health of base URL
+				return resp, err
+			}
+			if !f.failed(resp, err) {
+				f.markHealthy(t)
+				return resp, err
+			}
+			f.markFailed(t)
+			if i < len(targets)-1 && resp != nil && resp.Body != nil {
+				resp.Body.Close()
+			}
+		}
+		return resp, err
+	})
+}
@@ -0,0 +1,176 @@
+package failover_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/failover"
+)
+
+// hostTransport is mock transport that records requested hosts and responds
+// with configured status code or connection error for each host.
+type hostTransport struct {
+	mu     sync.Mutex
+	hosts  []string
+	status map[string]int
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hosts = append(t.hosts, req.URL.Host)
+	status, ok := t.status[req.URL.Host]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+}
+
+func (t *hostTransport) sent() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hosts := t.hosts
+	t.hosts = nil
+	return hosts
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFailover_ConnectionError(t *testing.T) {
+	transport := &hostTransport{status: map[string]int{"secondary": 200}}
+	f, err := failover.New(time.Hour, "http://primary", "http://secondary")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	client := gwc.New(&http.Client{Transport: transport}, f)
+
+	resp, err := client.Post().Path("/orders").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.Request.URL.String() != "http://secondary/orders" {
+		t.Errorf("Wrong URL. Got: %s, expected: http://secondary/orders", resp.Request.URL)
+	}
+	if got := transport.sent(); !equal(got, []string{"primary", "secondary"}) {
+		t.Errorf("Wrong hosts. Got: %v, expected: [primary secondary]", got)
+	}
+
+	// primary is in cooldown, so it should not be tried first
+	if _, err := client.Post().Path("/orders").Send(); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if got := transport.sent(); !equal(got, []string{"secondary"}) {
+		t.Errorf("Wrong hosts. Got: %v, expected: [secondary]", got)
+	}
+	if f.Active().Host != "secondary" {
+		t.Errorf("Wrong active base URL. Got: %s, expected: secondary", f.Active().Host)
+	}
+}
+
+func TestFailover_CooldownExpires(t *testing.T) {
+	transport := &hostTransport{status: map[string]int{"secondary": 200}}
+	f, _ := failover.New(time.Millisecond, "http://primary", "http://secondary")
+	client := gwc.New(&http.Client{Transport: transport}, f)
+
+	client.Post().Send()
+	transport.sent()
+	time.Sleep(5 * time.Millisecond)
+	client.Post().Send()
+	if got := transport.sent(); !equal(got, []string{"primary", "secondary"}) {
+		t.Errorf("Primary not tried after cooldown. Got: %v", got)
+	}
+}
+
+func TestFailover_OnStatus(t *testing.T) {
+	transport := &hostTransport{status: map[string]int{"primary": 503, "secondary": 200}}
+	f, _ := failover.New(time.Hour, "http://primary", "http://secondary")
+	client := gwc.New(&http.Client{Transport: transport}, f.OnStatus(503))
+
+	resp, err := client.Post().Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("Wrong status code. Got: %d, expected: 200", resp.StatusCode)
+	}
+}
+
+func TestFailover_AllFail(t *testing.T) {
+	transport := &hostTransport{status: map[string]int{"primary": 503, "secondary": 502}}
+	f, _ := failover.New(time.Hour, "http://primary", "http://secondary")
+	client := gwc.New(&http.Client{Transport: transport}, f.OnStatus(502, 503))
+
+	resp, err := client.Post().Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != 502 {
+		t.Errorf("Wrong status code. Got: %d, expected: 502", resp.StatusCode)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := failover.New(time.Second); err == nil {
+		t.Error("Expected error for no base URLs.")
+	}
+	if _, err := failover.New(time.Second, "/no-host"); err == nil {
+		t.Error("Expected error for base URL without host.")
+	}
+}
+
+func TestFailover_NotSent(t *testing.T) {
+	transport := &hostTransport{status: map[string]int{"primary": 200}}
+	f, _ := failover.New(time.Hour, "http://primary", "http://secondary")
+	client := gwc.New(&http.Client{Transport: transport}, f)
+
+	req, err := client.Get().Path("/x").Build(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if req.URL.String() != "http://primary/x" {
+		t.Errorf("Wrong URL. Got: %s, expected: http://primary/x", req.URL)
+	}
+	rejected := errors.New("rejected")
+	client.Get().Use(cliware.RequestProcessor(func(*http.Request) error {
+		return rejected
+	})).Send()
+	if f.Active().Host != "primary" {
+		t.Errorf("Wrong active base URL. Got: %s, expected: primary", f.Active().Host)
+	}
+	if got := transport.sent(); len(got) != 0 {
+		t.Errorf("Requests sent: %v", got)
+	}
+}
+
+func TestFailover_Host(t *testing.T) {
+	transport := &hostTransport{status: map[string]int{"secondary": 200}}
+	f, _ := failover.New(time.Hour, "http://primary", "http://secondary")
+	client := gwc.New(&http.Client{Transport: transport}, f)
+
+	resp, err := client.Get().Use(cliware.RequestProcessor(func(req *http.Request) error {
+		req.Host = "api.example.com"
+		return nil
+	})).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.Request.Host != "api.example.com" {
+		t.Errorf("Wrong host. Got: %s, expected: api.example.com", resp.Request.Host)
+	}
+}
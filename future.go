@@ -0,0 +1,151 @@
+package gwc
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Future is handle to request that is being sent asynchronously.
+type Future struct {
+	done chan struct{}
+	resp *Response
+	err  error
+
+	mu       sync.Mutex
+	finished bool
+	cancel   context.CancelFunc
+}
+
+// SendAsync starts sending copy of request in background and returns future
+// for its response, so request itself is not modified and can be used
+// again. Provided context is used in addition to context already attached
+// to request with SetContext. If it is nil, only context of request is used.
+// Context of sent request is released when body of response is closed.
+func (r *Request) SendAsync(ctx context.Context) *Future {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	f := &Future{done: make(chan struct{})}
+	reqCtx, cancel := requestContext(ctx, r, f.done)
+	f.cancel = cancel
+	go func() {
+		resp, err := r.copy(reqCtx).Send()
+		if err == nil && resp.Body != nil {
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+		} else {
+			cancel()
+		}
+		f.mu.Lock()
+		f.resp, f.err = resp, err
+		f.finished = true
+		f.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// Done returns channel that is closed when request is done.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until request is done and returns its response and error.
+func (f *Future) Wait() (*Response, error) {
+	<-f.done
+	return f.resp, f.err
+}
+
+// Cancel cancels request if it is still in flight. It has no effect once
+// request is done, so body of received response can still be read.
+func (f *Future) Cancel() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.finished {
+		f.cancel()
+	}
+}
+
+// All waits for all provided futures and returns their responses in same
+// order as futures. As soon as any of them fails, remaining ones are
+// canceled and its error is returned. Bodies of responses that were
+// already received, or are received after failure, are closed.
+func All(futures ...*Future) ([]*Response, error) {
+	responses := make([]*Response, len(futures))
+	done := firstDone(futures)
+	for i := range done {
+		resp, err := futures[i].Wait()
+		if err != nil {
+			for _, f := range futures {
+				f.Cancel()
+			}
+			for _, r := range responses {
+				closeResponse(r)
+			}
+			go closeDone(futures, done)
+			return nil, err
+		}
+		responses[i] = resp
+	}
+	return responses, nil
+}
+
+// ErrNoFutures is returned by Any when it is called without futures.
+var ErrNoFutures = errors.New("gwc: no futures provided")
+
+// Any waits for first provided future that succeeds, cancels remaining ones
+// and returns its response. Bodies of responses of other futures that also
+// succeed are closed. If all of them fail, error of last one that failed is
+// returned.
+func Any(futures ...*Future) (*Response, error) {
+	err := ErrNoFutures
+	done := firstDone(futures)
+	for i := range done {
+		var resp *Response
+		resp, err = futures[i].Wait()
+		if err == nil {
+			for _, f := range futures {
+				f.Cancel()
+			}
+			go closeDone(futures, done)
+			return resp, nil
+		}
+	}
+	return nil, err
+}
+
+// closeDone closes bodies of responses of futures yielded by done channel.
+func closeDone(futures []*Future, done <-chan int) {
+	for i := range done {
+		if resp, err := futures[i].Wait(); err == nil {
+			closeResponse(resp)
+		}
+	}
+}
+
+// closeResponse closes body of provided response, if there is one.
+func closeResponse(resp *Response) {
+	if resp != nil && resp.Response != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+}
+
+// firstDone returns channel that yields indexes of provided futures in order
+// in which they are done. Channel is closed when all of them are done.
+func firstDone(futures []*Future) <-chan int {
+	out := make(chan int, len(futures))
+	var wg sync.WaitGroup
+	wg.Add(len(futures))
+	for i, f := range futures {
+		go func(i int, f *Future) {
+			defer wg.Done()
+			<-f.Done()
+			out <- i
+		}(i, f)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,228 @@
+package gwc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/cliware"
+
+	"github.com/delicb/gwc"
+)
+
+func TestRequest_SendAsync(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})
+	client := gwc.NewForHandler(handler)
+	f := client.Get().URL("http://service/async").SendAsync(context.Background())
+	select {
+	case <-f.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Future not done.")
+	}
+	resp, err := f.Wait()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	f.Cancel()
+	body, err := resp.String()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body != "/async" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "/async")
+	}
+}
+
+func TestRequest_SendAsyncNotModified(t *testing.T) {
+	client := gwc.NewForHandler(bodyHandler("ok"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	contexts := make(chan context.Context, 2)
+	req := client.Get().URL("http://service/").SetContext(ctx).Use(cliware.RequestProcessor(func(r *http.Request) error {
+		contexts <- r.Context()
+		return nil
+	}))
+
+	f := req.SendAsync(context.Background())
+	if req.Context() != ctx {
+		t.Error("Context of request changed by SendAsync.")
+	}
+	resp, err := f.Wait()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	sent := <-contexts
+	if body, _ := resp.String(); body != "ok" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "ok")
+	}
+	if sent.Err() == nil {
+		t.Error("Request context not released after body was closed.")
+	}
+
+	if _, err := req.Send(); err != nil {
+		t.Error("Got unexpected error sending request again:", err)
+	}
+	if err := (<-contexts).Err(); err != nil {
+		t.Error("Request sent again with canceled context:", err)
+	}
+}
+
+func TestFuture_Cancel(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	client := gwc.NewForHandler(handler)
+	f := client.Get().URL("http://service/").SendAsync(nil)
+	f.Cancel()
+	if _, err := f.Wait(); err == nil {
+		t.Error("Expected error for canceled request.")
+	}
+}
+
+func TestAll(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			panic("fail")
+		case "/slow":
+			<-r.Context().Done()
+		}
+		w.Write([]byte(r.URL.Path))
+	})
+	client := gwc.NewForHandler(handler)
+
+	responses, err := gwc.All(
+		client.Get().URL("http://service/a").SendAsync(nil),
+		client.Get().URL("http://service/b").SendAsync(nil),
+	)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for i, expected := range []string{"/a", "/b"} {
+		body, _ := responses[i].String()
+		if body != expected {
+			t.Errorf("Wrong body. Got: %s, expected: %s", body, expected)
+		}
+	}
+
+	slow := client.Get().URL("http://service/slow").SendAsync(nil)
+	_, err = gwc.All(slow, client.Get().URL("http://service/fail").SendAsync(nil))
+	if err == nil {
+		t.Error("Expected error from All.")
+	}
+	if _, err := slow.Wait(); err == nil {
+		t.Error("Slow request not canceled.")
+	}
+}
+
+func TestAny(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fail":
+			panic("fail")
+		case "/slow":
+			<-r.Context().Done()
+		}
+		w.Write([]byte(r.URL.Path))
+	})
+	client := gwc.NewForHandler(handler)
+
+	slow := client.Get().URL("http://service/slow").SendAsync(nil)
+	resp, err := gwc.Any(
+		slow,
+		client.Get().URL("http://service/fail").SendAsync(nil),
+		client.Get().URL("http://service/ok").SendAsync(nil),
+	)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body, _ := resp.String(); body != "/ok" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "/ok")
+	}
+	if _, err := slow.Wait(); err == nil {
+		t.Error("Slow request not canceled.")
+	}
+
+	if _, err := gwc.Any(client.Get().URL("http://service/fail").SendAsync(nil)); err == nil {
+		t.Error("Expected error when all futures fail.")
+	}
+	if _, err := gwc.Any(); err != gwc.ErrNoFutures {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, gwc.ErrNoFutures)
+	}
+}
+
+func TestAllAny_CloseBodies(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string]*closeRecorder)
+	// requests to these paths ignore cancellation and wait for release, so
+	// their responses are received after All or Any returns
+	started := map[string]chan struct{}{"/late": make(chan struct{}), "/other": make(chan struct{})}
+	release := map[string]chan struct{}{"/late": make(chan struct{}), "/other": make(chan struct{})}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/fail" {
+			return nil, errors.New("fail")
+		}
+		body := &closeRecorder{Reader: strings.NewReader("ok"), closed: make(chan struct{})}
+		mu.Lock()
+		bodies[req.URL.Path] = body
+		mu.Unlock()
+		if _, ok := release[req.URL.Path]; ok {
+			close(started[req.URL.Path])
+			<-release[req.URL.Path]
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: body, Request: req}, nil
+	})
+	client := gwc.New(&http.Client{Transport: transport})
+	send := func(path string) *gwc.Future {
+		f := client.Post().URL("http://service" + path).SendAsync(nil)
+		if _, ok := started[path]; ok {
+			<-started[path]
+		} else {
+			f.Wait()
+		}
+		return f
+	}
+	closed := func(path string) bool {
+		mu.Lock()
+		body := bodies[path]
+		mu.Unlock()
+		select {
+		case <-body.closed:
+			return true
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+
+	responses, err := gwc.All(send("/ok"), send("/late"), send("/fail"))
+	if err == nil {
+		t.Error("Expected error from All.")
+	}
+	if responses != nil {
+		t.Errorf("Wrong responses. Got: %v, expected: nil", responses)
+	}
+	close(release["/late"])
+	for _, path := range []string{"/ok", "/late"} {
+		if !closed(path) {
+			t.Errorf("Body of %s not closed by All.", path)
+		}
+	}
+
+	resp, err := gwc.Any(send("/other"), send("/first"))
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	close(release["/other"])
+	if !closed("/other") {
+		t.Error("Body of other successful future not closed by Any.")
+	}
+	if body, _ := resp.String(); body != "ok" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "ok")
+	}
+}
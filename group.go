@@ -2,6 +2,7 @@ package gwc
 
 import (
 	"context"
+	"net"
 
 	"github.com/delicb/cliware"
 )
@@ -32,6 +33,38 @@ func (s *Group) Use(middleware ...cliware.Middleware) *Group {
 	return s
 }
 
+// JSONDecoding sets options used by Response.JSON to decode response bodies
+// of requests sent through this group. See JSONDecoding middleware for
+// details.
+func (s *Group) JSONDecoding(options ...JSONOption) *Group {
+	return s.Use(JSONDecoding(options...))
+}
+
+// MaxResponseBytes limits size of response bodies read by requests sent
+// through this group. See MaxResponseBytes middleware for details.
+func (s *Group) MaxResponseBytes(n int64) *Group {
+	return s.Use(MaxResponseBytes(n))
+}
+
+// MaxCompressionRatio limits how much compressed response bodies of
+// requests sent through this group can expand. See MaxCompressionRatio
+// middleware for details.
+func (s *Group) MaxCompressionRatio(ratio float64) *Group {
+	return s.Use(MaxCompressionRatio(ratio))
+}
+
+// UnixSocket sends requests of this group to HTTP server listening on Unix
+// socket with provided path.
+func (s *Group) UnixSocket(path string) *Group {
+	return s.Use(UnixSocket(path))
+}
+
+// DialContext makes requests of this group open connections using provided
+// function. See DialContext middleware for details.
+func (s *Group) DialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *Group {
+	return s.Use(DialContext(dial))
+}
+
 // Do applies all middlewares from this layer and provided middlewares and
 // calls next Doer to do actual work.
 func (s *Group) Do(middlewares ...cliware.Middleware) (*Response, error) {
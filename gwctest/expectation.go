@@ -0,0 +1,269 @@
+package gwctest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Expectation describes request that is expected to be sent and responses
+// that should be returned for it.
+type Expectation struct {
+	mock      *Mock
+	method    string
+	path      string
+	query     map[string]string
+	headers   map[string]string
+	jsonBody  interface{}
+	hasJSON   bool
+	matchers  []func(*http.Request) bool
+	times     int
+	calls     int
+	responses []*Response
+}
+
+// Method sets HTTP method that request has to have.
+func (e *Expectation) Method(method string) *Expectation {
+	e.method = method
+	return e
+}
+
+// Path sets URL path that request has to have.
+func (e *Expectation) Path(path string) *Expectation {
+	e.path = path
+	return e
+}
+
+// Query sets query parameter that request has to have.
+func (e *Expectation) Query(key, value string) *Expectation {
+	if e.query == nil {
+		e.query = make(map[string]string)
+	}
+	e.query[key] = value
+	return e
+}
+
+// Header sets header value that request has to have.
+func (e *Expectation) Header(key, value string) *Expectation {
+	if e.headers == nil {
+		e.headers = make(map[string]string)
+	}
+	e.headers[key] = value
+	return e
+}
+
+// JSONBody sets value that request body has to be equal to, when decoded
+// from JSON. Provided value is encoded to JSON and decoded back, so both
+// structures and maps can be used.
+func (e *Expectation) JSONBody(data interface{}) *Expectation {
+	e.jsonBody = data
+	e.hasJSON = true
+	return e
+}
+
+// Match adds custom matcher function to this expectation.
+func (e *Expectation) Match(matcher func(*http.Request) bool) *Expectation {
+	e.matchers = append(e.matchers, matcher)
+	return e
+}
+
+// Times sets exact number of times request is expected to be sent.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// AnyTimes marks this expectation as optional and allows it to be matched
+// any number of times.
+func (e *Expectation) AnyTimes() *Expectation {
+	e.times = -1
+	return e
+}
+
+// Calls returns number of times this expectation was matched.
+func (e *Expectation) Calls() int {
+	e.mock.mu.Lock()
+	defer e.mock.mu.Unlock()
+	return e.calls
+}
+
+// Respond adds new response to this expectation and returns it for
+// configuration. If multiple responses are added, they are returned in
+// sequence and last one is repeated for all following calls.
+func (e *Expectation) Respond() *Response {
+	r := &Response{
+		expectation: e,
+		status:      http.StatusOK,
+		headers:     make(http.Header),
+	}
+	e.responses = append(e.responses, r)
+	return r
+}
+
+// String returns human readable description of expectation.
+func (e *Expectation) String() string {
+	method := e.method
+	if method == "" {
+		method = "*"
+	}
+	path := e.path
+	if path == "" {
+		path = "*"
+	}
+	return method + " " + path
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.times >= 0 && e.calls >= e.times
+}
+
+func (e *Expectation) matches(req *http.Request, body []byte) bool {
+	if e.method != "" && !strings.EqualFold(e.method, req.Method) {
+		return false
+	}
+	if e.path != "" && e.path != req.URL.Path {
+		return false
+	}
+	query := req.URL.Query()
+	for k, v := range e.query {
+		if query.Get(k) != v {
+			return false
+		}
+	}
+	for k, v := range e.headers {
+		if req.Header.Get(k) != v {
+			return false
+		}
+	}
+	if e.hasJSON && !jsonEqual(e.jsonBody, body) {
+		return false
+	}
+	for _, m := range e.matchers {
+		if !m(req) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) response(call int) *Response {
+	if len(e.responses) == 0 {
+		return e.Respond()
+	}
+	if call >= len(e.responses) {
+		call = len(e.responses) - 1
+	}
+	return e.responses[call]
+}
+
+func jsonEqual(expected interface{}, body []byte) bool {
+	raw, err := json.Marshal(expected)
+	if err != nil {
+		return false
+	}
+	var want, got interface{}
+	if err := json.Unmarshal(raw, &want); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+// Response describes response returned for matched request.
+type Response struct {
+	expectation *Expectation
+	status      int
+	headers     http.Header
+	body        []byte
+	delay       time.Duration
+	err         error
+}
+
+// Status sets HTTP status code of response.
+func (r *Response) Status(code int) *Response {
+	r.status = code
+	return r
+}
+
+// Header sets header on response.
+func (r *Response) Header(key, value string) *Response {
+	r.headers.Set(key, value)
+	return r
+}
+
+// Body sets raw response body.
+func (r *Response) Body(body string) *Response {
+	r.body = []byte(body)
+	return r
+}
+
+// JSON encodes provided data as JSON and sets it as response body. It also
+// sets Content-Type header to application/json.
+func (r *Response) JSON(data interface{}) *Response {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		panic(fmt.Sprintf("gwctest: unable to encode JSON response: %v", err))
+	}
+	r.body = raw
+	r.headers.Set("Content-Type", "application/json")
+	return r
+}
+
+// Delay sets duration to wait before response is returned. If request
+// context is done before that, context error is returned.
+func (r *Response) Delay(d time.Duration) *Response {
+	r.delay = d
+	return r
+}
+
+// Error sets error that is returned instead of response.
+func (r *Response) Error(err error) *Response {
+	r.err = err
+	return r
+}
+
+// Then adds next response to same expectation and returns it.
+func (r *Response) Then() *Response {
+	return r.expectation.Respond()
+}
+
+func (r *Response) build(req *http.Request) (*http.Response, error) {
+	if r.delay > 0 {
+		if err := sleep(req.Context(), r.delay); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.status, http.StatusText(r.status)),
+		StatusCode:    r.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.headers.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
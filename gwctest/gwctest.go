@@ -0,0 +1,148 @@
+// Package gwctest contains utilities for testing code that uses gwc client.
+//
+// Main type is Mock, which implements http.RoundTripper and can be used as
+// transport for http.Client provided to gwc.New. Expected requests are
+// defined with fluent API and all expectations are checked when test ends.
+//
+//	mock := gwctest.New(t)
+//	mock.Expect().Method("GET").Path("/users/42").
+//		Respond().Status(200).JSON(user)
+//	client := mock.Client()
+package gwctest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/retry"
+
+	"github.com/delicb/gwc"
+)
+
+// TB is subset of testing.TB interface used by Mock to report failures.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Mock is http.RoundTripper that responds to requests based on defined
+// expectations, without sending anything over network.
+type Mock struct {
+	t            TB
+	mu           sync.Mutex
+	expectations []*Expectation
+	unmatched    []string
+}
+
+// New creates and returns new instance of Mock. When test finishes, Mock
+// reports all requests that did not match any expectation and all
+// expectations that were not met.
+func New(t TB) *Mock {
+	m := &Mock{t: t}
+	t.Cleanup(m.AssertExpectations)
+	return m
+}
+
+// HTTPClient returns new http.Client that uses this mock as transport.
+// Note that gwc clients retry failed GET requests by default, so GET
+// request that matches no expectation is recorded once for every attempt.
+// Use Client to get gwc client without retries.
+func (m *Mock) HTTPClient() *http.Client {
+	return &http.Client{Transport: m}
+}
+
+// Client returns new gwc client that uses this mock as transport and
+// provided middlewares. Retries are disabled, so that every request is
+// matched against expectations exactly once.
+func (m *Mock) Client(middlewares ...cliware.Middleware) *gwc.Client {
+	noRetry := retry.SetClassifier(func(*http.Response, error) bool {
+		return false
+	})
+	return gwc.New(m.HTTPClient(), append([]cliware.Middleware{noRetry}, middlewares...)...)
+}
+
+// Expect creates and returns new expectation. By default, expectation
+// matches any request exactly once and responds with 200 OK and empty body.
+func (m *Mock) Expect() *Expectation {
+	e := &Expectation{
+		mock:  m,
+		times: 1,
+	}
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+	return e
+}
+
+// RoundTrip is implementation of http.RoundTripper interface. It finds first
+// expectation that matches provided request and responds with its response.
+// If there is no such expectation, error is returned and test is marked as
+// failed at cleanup. Provided request is not modified, expectations and
+// responses get its copy with body that can be read again.
+func (m *Mock) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	if body != nil {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	m.mu.Lock()
+	var resp *Response
+	for _, e := range m.expectations {
+		if e.exhausted() || !e.matches(req, body) {
+			continue
+		}
+		resp = e.response(e.calls)
+		e.calls++
+		break
+	}
+	if resp == nil {
+		m.unmatched = append(m.unmatched, describe(req))
+	}
+	m.mu.Unlock()
+
+	if resp == nil {
+		return nil, fmt.Errorf("gwctest: no expectation matched request %s", describe(req))
+	}
+	return resp.build(req)
+}
+
+// AssertExpectations reports unmatched requests and expectations that were
+// not called expected number of times. It is called automatically at test
+// cleanup, but it can be called manually as well.
+func (m *Mock) AssertExpectations() {
+	m.t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.unmatched {
+		m.t.Errorf("gwctest: unexpected request %s", r)
+	}
+	for _, e := range m.expectations {
+		if e.times >= 0 && e.calls != e.times {
+			m.t.Errorf("gwctest: expectation %s called %d times, expected %d", e, e.calls, e.times)
+		}
+	}
+	m.unmatched = nil
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	return body, err
+}
+
+func describe(req *http.Request) string {
+	return strings.TrimSpace(req.Method + " " + req.URL.String())
+}
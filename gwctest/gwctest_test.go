@@ -0,0 +1,183 @@
+package gwctest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/gwctest"
+)
+
+// recorder is implementation of gwctest.TB that records failures instead of
+// failing the test.
+type recorder struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recorder) finish() {
+	for _, f := range r.cleanups {
+		f()
+	}
+}
+
+func TestMock_Match(t *testing.T) {
+	mock := gwctest.New(t)
+	mock.Expect().
+		Method("POST").
+		Path("/users").
+		Query("dry", "true").
+		Header("X-Test", "value").
+		JSONBody(map[string]interface{}{"name": "john"}).
+		Respond().Status(201).Header("X-Resp", "resp").Body("created")
+
+	client := gwc.New(mock.HTTPClient())
+	resp, err := client.Post().
+		URL("http://example.com/users").
+		SetQuery("dry", "true").
+		SetHeader("X-Test", "value").
+		BodyJSON(struct {
+			Name string `json:"name"`
+		}{"john"}).
+		Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != 201 {
+		t.Errorf("Wrong status code. Got: %d, expected: 201", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Resp"); got != "resp" {
+		t.Errorf("Wrong header. Got: %s, expected: resp", got)
+	}
+	body, err := resp.String()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body != "created" {
+		t.Errorf("Wrong body. Got: %s, expected: created", body)
+	}
+}
+
+func TestMock_Sequence(t *testing.T) {
+	mock := gwctest.New(t)
+	exp := mock.Expect().Path("/").Times(3)
+	exp.Respond().Status(500).Then().Status(200)
+
+	client := gwc.New(mock.HTTPClient())
+	for i, expected := range []int{500, 200, 200} {
+		resp, err := client.Get().URL("http://example.com/").Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if resp.StatusCode != expected {
+			t.Errorf("Wrong status code for call %d. Got: %d, expected: %d", i, resp.StatusCode, expected)
+		}
+	}
+	if exp.Calls() != 3 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 3", exp.Calls())
+	}
+}
+
+func TestMock_Error(t *testing.T) {
+	mock := gwctest.New(t)
+	expected := errors.New("connection refused")
+	mock.Expect().Respond().Error(expected)
+
+	client := mock.Client()
+	_, err := client.Get().URL("http://example.com/").Send()
+	if !errors.Is(err, expected) {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, expected)
+	}
+}
+
+func TestMock_DelayRespectsContext(t *testing.T) {
+	mock := gwctest.New(t)
+	mock.Expect().Respond().Delay(time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	client := mock.Client()
+	_, err := client.Get().URL("http://example.com/").SetContext(ctx).Send()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestMock_Unmatched(t *testing.T) {
+	rec := &recorder{}
+	mock := gwctest.New(rec)
+	mock.Expect().Method("GET").Path("/expected")
+
+	client := mock.Client()
+	_, err := client.Get().URL("http://example.com/other").Send()
+	if err == nil {
+		t.Error("Expected error for unmatched request.")
+	}
+	rec.finish()
+	if len(rec.errors) != 2 {
+		t.Errorf("Expected unmatched request and unmet expectation to be reported, got: %v", rec.errors)
+	}
+}
+
+func TestMock_UnmatchedRetried(t *testing.T) {
+	rec := &recorder{}
+	mock := gwctest.New(rec)
+
+	// gwc clients retry failed GET requests, so every attempt is recorded
+	client := gwc.New(mock.HTTPClient())
+	if _, err := client.Get().URL("http://example.com/").Send(); err == nil {
+		t.Error("Expected error for unmatched request.")
+	}
+	rec.finish()
+	if len(rec.errors) != 2 {
+		t.Errorf("Expected both attempts to be reported, got: %v", rec.errors)
+	}
+}
+
+func TestMock_RequestNotModified(t *testing.T) {
+	mock := gwctest.New(t)
+	mock.Expect().JSONBody(map[string]interface{}{"a": 1.0})
+
+	body := ioutil.NopCloser(strings.NewReader(`{"a": 1}`))
+	req, _ := http.NewRequest("POST", "http://example.com/", body)
+	req.Body = body
+	resp, err := mock.RoundTrip(req)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if req.Body != body {
+		t.Error("Body of request modified.")
+	}
+	if resp.Request == req {
+		t.Error("Response references original request instead of its copy.")
+	}
+	if data, _ := ioutil.ReadAll(resp.Request.Body); string(data) != `{"a": 1}` {
+		t.Errorf("Wrong body of recorded request. Got: %s", data)
+	}
+}
+
+func TestMock_AnyTimes(t *testing.T) {
+	rec := &recorder{}
+	mock := gwctest.New(rec)
+	mock.Expect().AnyTimes()
+	rec.finish()
+	if len(rec.errors) != 0 {
+		t.Errorf("Got unexpected failures: %v", rec.errors)
+	}
+}
@@ -0,0 +1,230 @@
+package gwc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/delicb/cliware"
+)
+
+// NewForHandler creates and returns client that dispatches all requests
+// directly to provided http.Handler, in the same process and without
+// opening any network connections. Provided middlewares are used for each
+// request, same as with New.
+func NewForHandler(handler http.Handler, middlewares ...cliware.Middleware) *Client {
+	return New(&http.Client{Transport: NewHandlerTransport(handler)}, middlewares...)
+}
+
+// NewHandlerTransport returns http.RoundTripper that serves requests by
+// calling provided http.Handler. Response body is streamed from handler as
+// it is written, trailers set by handler are available after body is read
+// and cancellation of request context is propagated to handler.
+func NewHandlerTransport(handler http.Handler) http.RoundTripper {
+	return &handlerTransport{handler: handler}
+}
+
+type handlerTransport struct {
+	handler http.Handler
+}
+
+// handlerResult is either response or error produced by handler, whichever
+// happens first.
+type handlerResult struct {
+	resp *http.Response
+	err  error
+}
+
+func (t *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	pr, pw := io.Pipe()
+	rw := &handlerResponseWriter{
+		req:    req,
+		header: make(http.Header),
+		pw:     pw,
+		result: make(chan handlerResult, 1),
+	}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer func() {
+			// transport has to close request body, same as http.Transport
+			if req.Body != nil {
+				req.Body.Close()
+			}
+		}()
+		defer func() {
+			if p := recover(); p != nil {
+				rw.fail(fmt.Errorf("gwc: handler panic: %v", p))
+				return
+			}
+			rw.finish()
+		}()
+		t.handler.ServeHTTP(rw, serverRequest(ctx, req))
+	}()
+
+	// propagate cancellation of request context to response body reader
+	go func() {
+		select {
+		case <-ctx.Done():
+			pr.CloseWithError(req.Context().Err())
+		case <-done:
+		}
+	}()
+
+	select {
+	case res := <-rw.result:
+		if res.err != nil {
+			cancel()
+			return nil, res.err
+		}
+		// handler may respond right after request is canceled
+		if err := req.Context().Err(); err != nil {
+			cancel()
+			return nil, err
+		}
+		res.resp.Body = &handlerBody{PipeReader: pr, cancel: cancel}
+		return res.resp, nil
+	case <-req.Context().Done():
+		cancel()
+		return nil, req.Context().Err()
+	}
+}
+
+// serverRequest converts client request to request as handler would get it
+// from http.Server.
+func serverRequest(ctx context.Context, req *http.Request) *http.Request {
+	sreq := req.Clone(ctx)
+	sreq.RequestURI = req.URL.RequestURI()
+	sreq.RemoteAddr = "127.0.0.1:0"
+	if sreq.Host == "" {
+		sreq.Host = req.URL.Host
+	}
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+	return sreq
+}
+
+// handlerBody is response body that cancels handler context when closed.
+type handlerBody struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (b *handlerBody) Close() error {
+	b.cancel()
+	return b.PipeReader.Close()
+}
+
+// handlerResponseWriter is http.ResponseWriter that converts everything
+// handler writes to http.Response.
+type handlerResponseWriter struct {
+	req         *http.Request
+	header      http.Header
+	pw          *io.PipeWriter
+	result      chan handlerResult
+	resp        *http.Response
+	wroteHeader bool
+}
+
+func (w *handlerResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *handlerResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	header := make(http.Header, len(w.header))
+	for k, v := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		header[k] = append([]string(nil), v...)
+	}
+	trailer := make(http.Header)
+	for _, declared := range header.Values("Trailer") {
+		for _, k := range strings.Split(declared, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				trailer[http.CanonicalHeaderKey(k)] = nil
+			}
+		}
+	}
+	header.Del("Trailer")
+
+	contentLength := int64(-1)
+	if cl := header.Get("Content-Length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil {
+			contentLength = n
+		}
+	}
+
+	w.resp = &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Trailer:       trailer,
+		ContentLength: contentLength,
+		Request:       w.req,
+	}
+	w.result <- handlerResult{resp: w.resp}
+}
+
+func (w *handlerResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.header.Get("Content-Type") == "" && w.header.Get("Content-Encoding") == "" {
+			w.header.Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.req.Method == "HEAD" {
+		return len(p), nil
+	}
+	return w.pw.Write(p)
+}
+
+// Flush is implementation of http.Flusher interface. Since body is not
+// buffered, it only makes sure that response headers are sent.
+func (w *handlerResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// finish is called when handler returns. It sends response if handler did
+// not write anything, fills trailers and closes response body.
+func (w *handlerResponseWriter) finish() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	for k, v := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			w.resp.Trailer[http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = v
+			continue
+		}
+		if _, declared := w.resp.Trailer[k]; declared {
+			w.resp.Trailer[k] = v
+		}
+	}
+	w.pw.Close()
+}
+
+// fail reports error produced by handler, either as result of RoundTrip or
+// as error when reading response body.
+func (w *handlerResponseWriter) fail(err error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.result <- handlerResult{err: err}
+	}
+	w.pw.CloseWithError(err)
+}
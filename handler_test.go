@@ -0,0 +1,153 @@
+package gwc_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc"
+)
+
+func TestNewForHandler(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users/42" {
+			t.Errorf("Wrong path. Got: %s, expected: /users/42", r.URL.Path)
+		}
+		if got := r.Header.Get("X-Test"); got != "value" {
+			t.Errorf("Wrong header. Got: %s, expected: value", got)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+	client := gwc.NewForHandler(handler)
+	resp, err := client.Post().URL("http://service/users/42").SetHeader("X-Test", "value").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Wrong status code. Got: %d, expected: %d", resp.StatusCode, http.StatusCreated)
+	}
+	body, err := resp.String()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body != "created" {
+		t.Errorf("Wrong body. Got: %s, expected: created", body)
+	}
+}
+
+func TestHandlerTransport_Trailers(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("data"))
+		w.Header().Set("X-Checksum", "abc")
+		w.Header().Set(http.TrailerPrefix+"X-Undeclared", "def")
+	})
+	client := gwc.NewForHandler(handler)
+	resp, err := client.Get().URL("http://service/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if _, err := resp.Bytes(); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "abc" {
+		t.Errorf("Wrong trailer. Got: %s, expected: abc", got)
+	}
+	if got := resp.Trailer.Get("X-Undeclared"); got != "def" {
+		t.Errorf("Wrong trailer. Got: %s, expected: def", got)
+	}
+}
+
+func TestHandlerTransport_Streaming(t *testing.T) {
+	next := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-next
+		w.Write([]byte("second\n"))
+	})
+	client := gwc.NewForHandler(handler)
+	resp, err := client.Get().URL("http://service/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "first\n" {
+		t.Fatalf("Wrong first line. Got: %q, error: %v", line, err)
+	}
+	close(next)
+	rest, err := ioutil.ReadAll(reader)
+	if err != nil || string(rest) != "second\n" {
+		t.Errorf("Wrong rest of body. Got: %q, error: %v", rest, err)
+	}
+}
+
+func TestHandlerTransport_Cancel(t *testing.T) {
+	handlerDone := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		handlerDone <- r.Context().Err()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	client := gwc.NewForHandler(handler)
+	_, err := client.Post().URL("http://service/").SetContext(ctx).Send()
+	if err == nil {
+		t.Error("Expected error for canceled request.")
+	}
+	select {
+	case <-handlerDone:
+	case <-time.After(time.Second):
+		t.Error("Handler context not canceled.")
+	}
+}
+
+func TestHandlerTransport_Panic(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	client := gwc.NewForHandler(handler)
+	_, err := client.Post().URL("http://service/").Send()
+	if err == nil {
+		t.Error("Expected error for panicking handler.")
+	}
+}
+
+// closeRecorder is request body that records whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (c *closeRecorder) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestHandlerTransport_ClosesRequestBody(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	body := &closeRecorder{Reader: strings.NewReader("data"), closed: make(chan struct{})}
+	req, _ := http.NewRequest("POST", "http://service/", body)
+	resp, err := gwc.NewHandlerTransport(handler).RoundTrip(req)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	select {
+	case <-body.closed:
+	case <-time.After(time.Second):
+		t.Error("Request body not closed.")
+	}
+}
@@ -0,0 +1,285 @@
+// Package hedge contains middleware that sends hedged requests in order to
+// reduce tail latency.
+//
+// If response for idempotent request does not arrive within hedging delay,
+// another copy of same request is sent. First successful response is
+// returned, while all other requests are canceled and their responses
+// drained. Failed requests do not make additional ones be sent sooner, so
+// request whose copies all fail waits for hedging delay before next copy is
+// sent.
+//
+// Since hedging depends on HTTP method, Hedger has to see final request. On
+// gwc.Client it should be added with UsePost and on single request it should
+// be added after method is set.
+package hedge
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+// Stats contains counters of requests handled by Hedger.
+type Stats struct {
+	// Requests is number of requests that hedging was applied to.
+	Requests uint64
+	// Hedges is number of additional requests sent.
+	Hedges uint64
+	// HedgeWins is number of times response for additional request was
+	// returned instead of response for original one.
+	HedgeWins uint64
+}
+
+// Hedger is middleware that sends hedged requests.
+type Hedger struct {
+	// counters are first in struct to be 64-bit aligned for atomic access
+	requests  uint64
+	hedges    uint64
+	hedgeWins uint64
+
+	delay      time.Duration
+	maxHedges  int
+	percentile float64
+	methods    []string
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// maxSamples is number of latest latencies kept for calculating percentiles.
+const maxSamples = 1000
+
+// minSamples is number of latencies needed before percentile is used as
+// hedging delay.
+const minSamples = 20
+
+// New creates and returns Hedger that sends up to maxHedges additional
+// requests, each one after fixed delay since previous one.
+func New(delay time.Duration, maxHedges int) *Hedger {
+	return &Hedger{
+		delay:     delay,
+		maxHedges: maxHedges,
+		methods:   []string{"GET", "HEAD", "OPTIONS"},
+	}
+}
+
+// NewAdaptive creates and returns Hedger whose delay is provided percentile
+// (between 0 and 1) of latencies of previous successful requests. Until
+// enough latencies are observed, fallback delay is used.
+func NewAdaptive(percentile float64, fallback time.Duration, maxHedges int) *Hedger {
+	h := New(fallback, maxHedges)
+	h.percentile = percentile
+	return h
+}
+
+// Methods sets HTTP methods that hedging is applied to. By default, only
+// GET, HEAD and OPTIONS requests are hedged, since it is only safe to hedge
+// idempotent requests.
+func (h *Hedger) Methods(methods ...string) *Hedger {
+	h.methods = methods
+	return h
+}
+
+// Stats returns current values of counters.
+func (h *Hedger) Stats() Stats {
+	return Stats{
+		Requests:  atomic.LoadUint64(&h.requests),
+		Hedges:    atomic.LoadUint64(&h.hedges),
+		HedgeWins: atomic.LoadUint64(&h.hedgeWins),
+	}
+}
+
+// Delay returns current hedging delay.
+func (h *Hedger) Delay() time.Duration {
+	if h.percentile <= 0 {
+		return h.delay
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < minSamples {
+		return h.delay
+	}
+	sorted := make([]time.Duration, len(h.samples))
+	copy(sorted, h.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(h.percentile * float64(len(sorted)-1))
+	return sorted[idx]
+}
+
+func (h *Hedger) observe(d time.Duration) {
+	if h.percentile <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < maxSamples {
+		h.samples = append(h.samples, d)
+		return
+	}
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % maxSamples
+}
+
+func (h *Hedger) hedged(method string) bool {
+	if h.maxHedges < 1 {
+		return false
+	}
+	for _, m := range h.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// attempt holds result of single sent request.
+type attempt struct {
+	index    int
+	resp     *http.Response
+	err      error
+	duration time.Duration
+}
+
+func (a *attempt) successful() bool {
+	return a.err == nil && a.resp != nil && a.resp.StatusCode < 500
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (h *Hedger) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		if !h.hedged(req.Method) {
+			return next.Handle(req)
+		}
+		return h.handle(next, req)
+	})
+}
+
+func (h *Hedger) handle(next cliware.Handler, req *http.Request) (*http.Response, error) {
+	atomic.AddUint64(&h.requests, 1)
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := req.Context()
+	results := make(chan *attempt, h.maxHedges+1)
+	var cancels []context.CancelFunc
+
+	launch := func() {
+		index := len(cancels)
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		r := req.Clone(attemptCtx)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		go func() {
+			start := time.Now()
+			resp, err := next.Handle(r)
+			results <- &attempt{index: index, resp: resp, err: err, duration: time.Since(start)}
+		}()
+	}
+
+	// finish cancels all requests except winning one and drains responses
+	// of requests that are still in flight
+	finish := func(winner int, inFlight int) {
+		for i, cancel := range cancels {
+			if i != winner {
+				cancel()
+			}
+		}
+		go func() {
+			for ; inFlight > 0; inFlight-- {
+				discard(<-results)
+			}
+		}()
+	}
+
+	launch()
+	inFlight := 1
+	timer := time.NewTimer(h.Delay())
+	defer timer.Stop()
+	var last *attempt
+
+	for {
+		select {
+		case a := <-results:
+			inFlight--
+			if a.successful() {
+				h.observe(a.duration)
+				if a.index > 0 {
+					atomic.AddUint64(&h.hedgeWins, 1)
+				}
+				if last != nil {
+					discard(last)
+				}
+				finish(a.index, inFlight)
+				a.resp.Body = &cancelBody{ReadCloser: a.resp.Body, cancel: cancels[a.index]}
+				return a.resp, nil
+			}
+			if last != nil {
+				discard(last)
+				cancels[last.index]()
+			}
+			last = a
+			if inFlight > 0 || len(cancels) <= h.maxHedges {
+				// even if all sent requests failed, next one is sent
+				// only after hedging delay, so hedging does not retry
+				continue
+			}
+			if a.resp == nil {
+				finish(-1, 0)
+				return nil, a.err
+			}
+			finish(a.index, 0)
+			a.resp.Body = &cancelBody{ReadCloser: a.resp.Body, cancel: cancels[a.index]}
+			return a.resp, a.err
+		case <-timer.C:
+			if len(cancels) <= h.maxHedges {
+				atomic.AddUint64(&h.hedges, 1)
+				launch()
+				inFlight++
+				timer.Reset(h.Delay())
+			}
+		case <-ctx.Done():
+			if last != nil {
+				discard(last)
+			}
+			finish(-1, inFlight)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// discard drains and closes response body of provided attempt.
+func discard(a *attempt) {
+	if a.resp != nil && a.resp.Body != nil {
+		io.Copy(ioutil.Discard, a.resp.Body)
+		a.resp.Body.Close()
+	}
+}
+
+// cancelBody is response body that cancels request context when closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,161 @@
+package hedge_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/hedge"
+)
+
+// slowFirstHandler blocks first request until it is canceled and responds
+// immediately to all others.
+func slowFirstHandler(calls *int32, canceled chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) == 1 {
+			<-r.Context().Done()
+			close(canceled)
+			return
+		}
+		w.Write([]byte("fast"))
+	})
+}
+
+func TestHedger(t *testing.T) {
+	var calls int32
+	canceled := make(chan struct{})
+	hedger := hedge.New(10*time.Millisecond, 1)
+	client := gwc.NewForHandler(slowFirstHandler(&calls, canceled))
+	client.UsePost(hedger)
+
+	resp, err := client.Get().URL("http://service/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	body, err := resp.String()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body != "fast" {
+		t.Errorf("Wrong body. Got: %s, expected: fast", body)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("Slow request not canceled.")
+	}
+	stats := hedger.Stats()
+	if stats.Requests != 1 || stats.Hedges != 1 || stats.HedgeWins != 1 {
+		t.Errorf("Wrong stats: %+v", stats)
+	}
+}
+
+func TestHedger_NoHedgeForFastResponse(t *testing.T) {
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	})
+	hedger := hedge.New(time.Second, 2)
+	client := gwc.NewForHandler(handler)
+	client.UsePost(hedger)
+	if _, err := client.Get().URL("http://service/").Send(); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1", got)
+	}
+	if stats := hedger.Stats(); stats.Hedges != 0 {
+		t.Errorf("Wrong number of hedges. Got: %d, expected: 0", stats.Hedges)
+	}
+}
+
+func TestHedger_UnsafeMethod(t *testing.T) {
+	var calls int32
+	canceled := make(chan struct{})
+	hedger := hedge.New(time.Millisecond, 1)
+	client := gwc.NewForHandler(slowFirstHandler(&calls, canceled))
+	client.UsePost(hedger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := client.Post().URL("http://service/").SetContext(ctx)
+	go req.Send()
+	time.Sleep(20 * time.Millisecond)
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("Wrong number of calls for POST. Got: %d, expected: 1", got)
+	}
+	if stats := hedger.Stats(); stats.Requests != 0 {
+		t.Errorf("POST request hedged: %+v", stats)
+	}
+}
+
+func TestHedger_AdaptiveDelay(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	hedger := hedge.NewAdaptive(0.9, time.Hour, 1)
+	client := gwc.NewForHandler(handler)
+	client.UsePost(hedger)
+	if hedger.Delay() != time.Hour {
+		t.Errorf("Wrong fallback delay. Got: %s, expected: %s", hedger.Delay(), time.Hour)
+	}
+	for i := 0; i < 30; i++ {
+		if _, err := client.Get().URL("http://service/").Send(); err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+	}
+	if hedger.Delay() >= time.Hour {
+		t.Errorf("Delay not adapted to observed latencies: %s", hedger.Delay())
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// closeRecorder is response body that records if it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed int32
+}
+
+func (r *closeRecorder) Close() error {
+	atomic.StoreInt32(&r.closed, 1)
+	return nil
+}
+
+func TestHedger_FailedAttempt(t *testing.T) {
+	var calls int32
+	failed := &closeRecorder{Reader: strings.NewReader("failed")}
+	start := time.Now()
+	var hedgedAfter time.Duration
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return &http.Response{StatusCode: http.StatusInternalServerError, Body: failed, Request: req}, nil
+		}
+		hedgedAfter = time.Since(start)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("ok")), Request: req}, nil
+	})
+	hedger := hedge.New(50*time.Millisecond, 1)
+	client := gwc.New(&http.Client{Transport: transport})
+	client.UsePost(hedger)
+
+	resp, err := client.Get().URL("http://service/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body, _ := resp.String(); body != "ok" {
+		t.Errorf("Wrong body. Got: %s, expected: ok", body)
+	}
+	if hedgedAfter < 50*time.Millisecond {
+		t.Errorf("Request hedged before delay, after: %s", hedgedAfter)
+	}
+	if atomic.LoadInt32(&failed.closed) != 1 {
+		t.Error("Body of failed response not closed.")
+	}
+}
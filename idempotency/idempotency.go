@@ -0,0 +1,180 @@
+// Package idempotency contains middlewares for managing Idempotency-Key
+// header for requests with unsafe methods (like POST and PATCH).
+//
+// Key is set once per sent request, before retry logic, so all retries of
+// same request use same key. Since server can use key to detect repeated
+// requests, requests with key are marked as safe to retry regardless of
+// their method, by RoundTripper returned by NewTransport. Clients created
+// with gwc.New already use this RoundTripper.
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/delicb/cliware"
+	"github.com/delicb/cliware-middlewares/retry"
+)
+
+// Header is name of HTTP header that holds idempotency key.
+const Header = "Idempotency-Key"
+
+// Generator generates new idempotency key.
+type Generator func() (string, error)
+
+// UUID is generator that returns random (version 4) UUID.
+func UUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// Store persists idempotency keys of operations, so that operation can be
+// resumed with same key (for example, after process restart).
+type Store interface {
+	// Load returns key for provided operation. If there is no key for it,
+	// empty string is returned.
+	Load(operation string) (string, error)
+	// Save stores key for provided operation.
+	Save(operation, key string) error
+	// Delete removes key for provided operation.
+	Delete(operation string) error
+}
+
+// MemoryStore is Store that keeps keys in memory.
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+// NewMemoryStore creates and returns empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]string)}
+}
+
+// Load is implementation of Store interface.
+func (s *MemoryStore) Load(operation string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[operation], nil
+}
+
+// Save is implementation of Store interface.
+func (s *MemoryStore) Save(operation, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[operation] = key
+	return nil
+}
+
+// Delete is implementation of Store interface.
+func (s *MemoryStore) Delete(operation string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, operation)
+	return nil
+}
+
+type retryableKeyType string
+
+var retryableKey retryableKeyType = "retryable"
+
+// keyMiddleware sets idempotency key returned by provided function to
+// request, unless request already has one, and marks request as safe to
+// retry.
+func keyMiddleware(key func() (string, error)) cliware.Middleware {
+	return cliware.MiddlewareFunc(func(next cliware.Handler) cliware.Handler {
+		return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(Header) == "" {
+				k, err := key()
+				if err != nil {
+					return nil, err
+				}
+				req.Header.Set(Header, k)
+			}
+			return next.Handle(req.WithContext(context.WithValue(req.Context(), retryableKey, true)))
+		})
+	})
+}
+
+// NewTransport returns RoundTripper that allows retries of requests with
+// idempotency key set by middlewares from this package, whatever their
+// method is. It has to wrap RoundTripper that retries requests. If next is
+// nil, http.DefaultTransport is used.
+func NewTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retryable, _ := req.Context().Value(retryableKey).(bool)
+	if !retryable || req.Header.Get(Header) == "" {
+		return t.next.RoundTrip(req)
+	}
+	// final method is known only here, since middlewares that set it can
+	// run after ones from this package, and methods allowed for retries
+	// matter only for method of this request
+	return retry.Methods(req.Method).Exec(cliware.HandlerFunc(t.next.RoundTrip)).Handle(req)
+}
+
+// Key returns middleware that sets provided idempotency key to request.
+func Key(key string) cliware.Middleware {
+	return keyMiddleware(func() (string, error) {
+		return key, nil
+	})
+}
+
+// Generate returns middleware that sets new key from provided generator to
+// each sent request. If generator is nil, UUID is used.
+func Generate(generator Generator) cliware.Middleware {
+	if generator == nil {
+		generator = UUID
+	}
+	return keyMiddleware(generator)
+}
+
+// Operation returns middleware that uses key of provided operation from
+// store, generating and saving new one if there is none. Key is deleted
+// from store when request gets successful (2xx) response, so failed
+// operations can be resumed with same key. If generator is nil, UUID is
+// used.
+func Operation(store Store, generator Generator, operation string) cliware.Middleware {
+	if generator == nil {
+		generator = UUID
+	}
+	setKey := keyMiddleware(func() (string, error) {
+		key, err := store.Load(operation)
+		if err != nil || key != "" {
+			return key, err
+		}
+		key, err = generator()
+		if err != nil {
+			return "", err
+		}
+		return key, store.Save(operation, key)
+	})
+	return cliware.MiddlewareFunc(func(next cliware.Handler) cliware.Handler {
+		return setKey.Exec(cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Handle(req)
+			if err == nil && resp != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				if delErr := store.Delete(operation); delErr != nil {
+					return resp, delErr
+				}
+			}
+			return resp, err
+		}))
+	})
+}
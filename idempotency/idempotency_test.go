@@ -0,0 +1,141 @@
+package idempotency_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/delicb/cliware-middlewares/retry"
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/idempotency"
+)
+
+// keyRecorder is mock transport that records idempotency keys of all
+// requests and fails first failures requests with connection error.
+type keyRecorder struct {
+	keys     []string
+	failures int
+	status   int
+}
+
+func (r *keyRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.keys = append(r.keys, req.Header.Get(idempotency.Header))
+	if len(r.keys) <= r.failures {
+		return nil, errors.New("connection reset")
+	}
+	status := r.status
+	if status == 0 {
+		status = 200
+	}
+	return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+}
+
+func newClient(recorder *keyRecorder) *gwc.Client {
+	return gwc.New(&http.Client{Transport: recorder},
+		retry.Times(3),
+		retry.SetBackoffStrategy(retry.ConstantBackoff(0)),
+	)
+}
+
+func TestGenerate_PreservedAcrossRetries(t *testing.T) {
+	recorder := &keyRecorder{failures: 2}
+	client := newClient(recorder)
+	_, err := client.Post().Use(idempotency.Generate(nil)).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if len(recorder.keys) != 3 {
+		t.Fatalf("POST request not retried. Attempts: %d", len(recorder.keys))
+	}
+	for _, k := range recorder.keys {
+		if k == "" || k != recorder.keys[0] {
+			t.Fatalf("Key not preserved across retries: %v", recorder.keys)
+		}
+	}
+}
+
+func TestIdempotentBeforeMethod(t *testing.T) {
+	recorder := &keyRecorder{failures: 2}
+	client := newClient(recorder)
+	// method is set after idempotency key middleware
+	_, err := client.Request().Idempotent().Method("POST").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if len(recorder.keys) != 3 {
+		t.Errorf("POST request not retried. Attempts: %d", len(recorder.keys))
+	}
+}
+
+func TestGenerate_GETStillRetried(t *testing.T) {
+	recorder := &keyRecorder{failures: 1}
+	client := newClient(recorder)
+	if _, err := client.Get().Idempotent().Send(); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if len(recorder.keys) != 2 {
+		t.Errorf("GET request not retried. Attempts: %d", len(recorder.keys))
+	}
+}
+
+func TestGenerate_NewKeyPerRequest(t *testing.T) {
+	recorder := &keyRecorder{}
+	client := newClient(recorder)
+	client.Post().Use(idempotency.Generate(nil)).Send()
+	client.Post().Use(idempotency.Generate(nil)).Send()
+	if recorder.keys[0] == recorder.keys[1] {
+		t.Errorf("Same key used for different requests: %v", recorder.keys)
+	}
+}
+
+func TestWithoutKeyNotRetried(t *testing.T) {
+	recorder := &keyRecorder{failures: 1}
+	client := newClient(recorder)
+	if _, err := client.Post().Send(); err == nil {
+		t.Error("Expected error for POST without idempotency key.")
+	}
+	if len(recorder.keys) != 1 {
+		t.Errorf("POST without idempotency key retried. Attempts: %d", len(recorder.keys))
+	}
+}
+
+func TestKey(t *testing.T) {
+	recorder := &keyRecorder{}
+	client := newClient(recorder)
+	client.Post().Use(idempotency.Key("my-key")).Send()
+	if recorder.keys[0] != "my-key" {
+		t.Errorf("Wrong key. Got: %s, expected: my-key", recorder.keys[0])
+	}
+}
+
+func TestOperation(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+	recorder := &keyRecorder{status: 503}
+	client := newClient(recorder)
+
+	client.Post().Use(idempotency.Operation(store, nil, "order-1")).Send()
+	saved, _ := store.Load("order-1")
+	if saved == "" || saved != recorder.keys[0] {
+		t.Fatalf("Key not saved for failed operation. Saved: %q, sent: %q", saved, recorder.keys[0])
+	}
+
+	// resumed operation uses same key and removes it on success
+	recorder.status = 201
+	client.Post().Use(idempotency.Operation(store, nil, "order-1")).Send()
+	if recorder.keys[1] != saved {
+		t.Errorf("Resumed operation used different key. Got: %s, expected: %s", recorder.keys[1], saved)
+	}
+	if key, _ := store.Load("order-1"); key != "" {
+		t.Errorf("Key not deleted after successful operation: %s", key)
+	}
+}
+
+func TestUUID(t *testing.T) {
+	key, err := idempotency.UUID()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if len(key) != 36 || key[14] != '4' {
+		t.Errorf("Invalid UUID: %s", key)
+	}
+}
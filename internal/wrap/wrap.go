@@ -0,0 +1,79 @@
+// Package wrap lets packages of this module that configure *http.Transport
+// of client configure clients created by each other.
+//
+// Clients created by these packages wrap configured *http.Transport with
+// their own round tripper. Such round trippers implement Wrapper, so other
+// package can configure transport they wrap and wrap it again in the same
+// way.
+package wrap
+
+import "net/http"
+
+// Wrapper is round tripper that wraps other round tripper.
+type Wrapper interface {
+	http.RoundTripper
+	// Unwrap returns wrapped round tripper.
+	Unwrap() http.RoundTripper
+	// Wrap returns copy of wrapper that wraps provided round tripper.
+	Wrap(next http.RoundTripper) http.RoundTripper
+}
+
+// Restrictor is wrapper that restricts connections opened by transport it
+// wraps (like the one of ssrf package). Transport it wraps must not be
+// configured to open connections in other way, since that would bypass
+// the restriction.
+type Restrictor interface {
+	Wrapper
+	// RestrictsConnections marks wrapper as Restrictor.
+	RestrictsConnections()
+}
+
+// Restricted reports if provided round tripper or any round tripper it
+// wraps is Restrictor.
+func Restricted(rt http.RoundTripper) bool {
+	for {
+		if _, ok := rt.(Restrictor); ok {
+			return true
+		}
+		w, ok := rt.(Wrapper)
+		if !ok {
+			return false
+		}
+		rt = w.Unwrap()
+	}
+}
+
+// Unwrap returns *http.Transport that is provided round tripper or that is
+// wrapped by it, through any number of wrappers, and function that wraps
+// provided round tripper in the same wrappers. If round tripper is nil,
+// returned transport is nil. If it is neither *http.Transport nor wrapper
+// of one, ok is false.
+func Unwrap(rt http.RoundTripper) (t *http.Transport, wrap func(http.RoundTripper) http.RoundTripper, ok bool) {
+	wrap = func(next http.RoundTripper) http.RoundTripper {
+		return next
+	}
+	for {
+		switch v := rt.(type) {
+		case nil:
+			return nil, wrap, true
+		case *http.Transport:
+			return v, wrap, true
+		case Wrapper:
+			outer := wrap
+			wrap = func(next http.RoundTripper) http.RoundTripper {
+				return outer(v.Wrap(next))
+			}
+			rt = v.Unwrap()
+		default:
+			return nil, nil, false
+		}
+	}
+}
+
+// CloseIdleConnections closes idle connections of provided round tripper,
+// if it supports it.
+func CloseIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,263 @@
+package jar
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is format of files cookies are saved to.
+type Format int
+
+const (
+	// JSON format is JSON array of cookies, with all their attributes.
+	JSON Format = iota
+	// Netscape format is cookie file format used by curl, wget and
+	// browser extensions. It does not have creation time and SameSite
+	// attribute of cookies.
+	Netscape
+)
+
+// String returns name of format.
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "JSON"
+	case Netscape:
+		return "Netscape"
+	}
+	return "Format(" + strconv.Itoa(int(f)) + ")"
+}
+
+// Save writes all cookies in jar that have not expired, including session
+// cookies, to w in provided format.
+func (j *Jar) Save(w io.Writer, format Format) error {
+	cookies := j.All()
+	switch format {
+	case JSON:
+		return saveJSON(w, cookies)
+	case Netscape:
+		return saveNetscape(w, cookies)
+	}
+	return fmt.Errorf("jar: unsupported format %s", format)
+}
+
+// Load reads cookies in provided format from r and adds them to jar.
+// Cookies replace cookies in jar with same name, domain and path. Expired
+// cookies are skipped and domain cookies for public suffixes are added as
+// host only cookies.
+func (j *Jar) Load(r io.Reader, format Format) error {
+	var cookies []Cookie
+	var err error
+	switch format {
+	case JSON:
+		cookies, err = loadJSON(r)
+	case Netscape:
+		cookies, err = loadNetscape(r)
+	default:
+		err = fmt.Errorf("jar: unsupported format %s", format)
+	}
+	if err != nil {
+		return err
+	}
+	j.add(cookies)
+	return nil
+}
+
+// SaveFile saves cookies to file with provided path. File is replaced
+// atomically and, since cookies are usually credentials, it is readable
+// only by its owner.
+func (j *Jar) SaveFile(path string, format Format) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("jar: saving cookies: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if err := j.Save(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("jar: saving cookies: %v", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("jar: saving cookies: %v", err)
+	}
+	return nil
+}
+
+// LoadFile loads cookies from file with provided path. Error returned when
+// file does not exist satisfies os.IsNotExist, so programs can start with
+// empty jar when cookies were never saved.
+func (j *Jar) LoadFile(path string, format Format) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return j.Load(f, format)
+}
+
+// jsonCookie is cookie as saved in JSON format.
+type jsonCookie struct {
+	Name     string     `json:"name"`
+	Value    string     `json:"value"`
+	Domain   string     `json:"domain"`
+	Path     string     `json:"path"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	Secure   bool       `json:"secure,omitempty"`
+	HttpOnly bool       `json:"httpOnly,omitempty"`
+	HostOnly bool       `json:"hostOnly,omitempty"`
+	SameSite string     `json:"sameSite,omitempty"`
+	Created  time.Time  `json:"created"`
+}
+
+// sameSiteNames maps SameSite attributes to their names in JSON format.
+var sameSiteNames = map[http.SameSite]string{
+	http.SameSiteLaxMode:    "Lax",
+	http.SameSiteStrictMode: "Strict",
+	http.SameSiteNoneMode:   "None",
+}
+
+func saveJSON(w io.Writer, cookies []Cookie) error {
+	saved := make([]jsonCookie, len(cookies))
+	for i, c := range cookies {
+		saved[i] = jsonCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			HostOnly: c.HostOnly,
+			SameSite: sameSiteNames[c.SameSite],
+			Created:  c.Created,
+		}
+		if !c.Expires.IsZero() {
+			expires := c.Expires
+			saved[i].Expires = &expires
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(saved); err != nil {
+		return fmt.Errorf("jar: saving cookies: %v", err)
+	}
+	return nil
+}
+
+func loadJSON(r io.Reader) ([]Cookie, error) {
+	var saved []jsonCookie
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("jar: invalid JSON cookie file: %v", err)
+	}
+	cookies := make([]Cookie, len(saved))
+	for i, c := range saved {
+		cookies[i] = Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			HostOnly: c.HostOnly,
+			Created:  c.Created,
+		}
+		if c.Expires != nil {
+			cookies[i].Expires = *c.Expires
+		}
+		for mode, name := range sameSiteNames {
+			if strings.EqualFold(c.SameSite, name) {
+				cookies[i].SameSite = mode
+			}
+		}
+	}
+	return cookies, nil
+}
+
+const (
+	netscapeHeader = "# Netscape HTTP Cookie File"
+	// httpOnlyPrefix marks lines of HttpOnly cookies, same as in curl.
+	httpOnlyPrefix = "#HttpOnly_"
+)
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func saveNetscape(w io.Writer, cookies []Cookie) error {
+	b := bufio.NewWriter(w)
+	b.WriteString(netscapeHeader + "\n\n")
+	for _, c := range cookies {
+		domain := c.Domain
+		if !c.HostOnly {
+			domain = "." + domain
+		}
+		if c.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expires int64
+		if !c.Expires.IsZero() {
+			expires = c.Expires.Unix()
+		}
+		fmt.Fprintf(b, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(!c.HostOnly), c.Path, netscapeBool(c.Secure), expires, c.Name, c.Value)
+	}
+	if err := b.Flush(); err != nil {
+		return fmt.Errorf("jar: saving cookies: %v", err)
+	}
+	return nil
+}
+
+func loadNetscape(r io.Reader) ([]Cookie, error) {
+	var cookies []Cookie
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(text, httpOnlyPrefix)
+		text = strings.TrimPrefix(text, httpOnlyPrefix)
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) == 6 {
+			// cookie with empty value
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("jar: invalid Netscape cookie file: line %d has %d fields, expected 7", line, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("jar: invalid Netscape cookie file: line %d has invalid expiration time %q", line, fields[4])
+		}
+		c := Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+		}
+		if expires > 0 {
+			c.Expires = time.Unix(expires, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("jar: reading cookies: %v", err)
+	}
+	return cookies, nil
+}
@@ -0,0 +1,191 @@
+package jar_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/jar"
+)
+
+func TestJar_SaveLoad(t *testing.T) {
+	j := jar.New(nil)
+	j.SetCookies(mustParse(t, "https://api.example.com/v1/login"), []*http.Cookie{
+		{Name: "session", Value: "abc", Path: "/", Secure: true, HttpOnly: true, SameSite: http.SameSiteLaxMode},
+		{Name: "prefs", Value: "dark", Domain: "example.com", MaxAge: 3600},
+		{Name: "empty", Value: ""},
+	})
+	expected := j.All()
+
+	for _, format := range []jar.Format{jar.JSON, jar.Netscape} {
+		var buf bytes.Buffer
+		if err := j.Save(&buf, format); err != nil {
+			t.Fatalf("%s: Got unexpected error: %v", format, err)
+		}
+		loaded := jar.New(nil)
+		if err := loaded.Load(&buf, format); err != nil {
+			t.Fatalf("%s: Got unexpected error: %v", format, err)
+		}
+		got := loaded.All()
+		if len(got) != len(expected) {
+			t.Fatalf("%s: Wrong number of cookies. Got: %d, expected: %d", format, len(got), len(expected))
+		}
+		for i := range got {
+			e := expected[i]
+			if format == jar.Netscape {
+				// Netscape format does not have these attributes
+				got[i].Created, e.Created = time.Time{}, time.Time{}
+				e.SameSite = 0
+				e.Expires = e.Expires.Truncate(time.Second)
+			}
+			if !got[i].Expires.Equal(e.Expires) {
+				t.Errorf("%s: Wrong expiration. Got: %s, expected: %s", format, got[i].Expires, e.Expires)
+			}
+			got[i].Expires, e.Expires = time.Time{}, time.Time{}
+			if !got[i].Created.Equal(e.Created) {
+				t.Errorf("%s: Wrong creation time. Got: %s, expected: %s", format, got[i].Created, e.Created)
+			}
+			got[i].Created, e.Created = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got[i], e) {
+				t.Errorf("%s: Wrong cookie. Got: %+v, expected: %+v", format, got[i], e)
+			}
+		}
+		// cookies created at same time are ordered by domain and name
+		if names := cookieNames(t, loaded, "https://api.example.com/v1/users"); names != "empty prefs session" {
+			t.Errorf("%s: Wrong cookies. Got: %q", format, names)
+		}
+	}
+}
+
+func TestJar_LoadNetscape(t *testing.T) {
+	file := "# Netscape HTTP Cookie File\r\n" +
+		"# https://curl.se/docs/http-cookies.html\r\n" +
+		"\r\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tsession\tabc\r\n" +
+		"#HttpOnly_api.example.com\tFALSE\t/v1\tTRUE\t4102444800\ttoken\txyz\r\n" +
+		"example.com\tFALSE\t/\tFALSE\t946684800\texpired\told\r\n"
+	j := jar.New(nil)
+	if err := j.Load(strings.NewReader(file), jar.Netscape); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	all := j.All()
+	if len(all) != 2 {
+		t.Fatalf("Wrong number of cookies. Got: %d, expected: %d", len(all), 2)
+	}
+	token := all[0]
+	if token.Name != "token" || !token.HttpOnly || !token.HostOnly || !token.Secure || token.Path != "/v1" || token.Expires.Unix() != 4102444800 {
+		t.Errorf("Wrong cookie. Got: %+v", token)
+	}
+	if session := all[1]; session.Domain != "example.com" || session.HostOnly || !session.Expires.IsZero() {
+		t.Errorf("Wrong cookie. Got: %+v", session)
+	}
+
+	for _, invalid := range []string{
+		"example.com\tFALSE\t/\n",
+		"example.com\tFALSE\t/\tFALSE\tnever\tname\tvalue\n",
+	} {
+		if err := jar.New(nil).Load(strings.NewReader(invalid), jar.Netscape); err == nil {
+			t.Errorf("Expected error for file: %q", invalid)
+		}
+	}
+	if err := jar.New(nil).Load(strings.NewReader("{}"), jar.JSON); err == nil {
+		t.Error("Expected error for invalid JSON file.")
+	}
+}
+
+func TestJar_Client(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret", HttpOnly: true})
+			http.Redirect(w, r, "/me", http.StatusFound)
+		case "/me":
+			if c, err := r.Cookie("session"); err != nil || c.Value != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("logged in"))
+		}
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "jar")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cookies.json")
+
+	// first run logs in and saves cookies
+	j := jar.New(nil)
+	if err := j.LoadFile(path, jar.JSON); !os.IsNotExist(err) {
+		t.Error("Expected not exist error. Got:", err)
+	}
+	resp, err := gwc.New(nil).CookieJar(j).Get().URL(server.URL + "/login").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body, _ := resp.String(); body != "logged in" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "logged in")
+	}
+	if err := j.SaveFile(path, jar.JSON); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Wrong permissions of cookie file. Got: %v, expected: %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	// second run stays logged in
+	j = jar.New(nil)
+	if err := j.LoadFile(path, jar.JSON); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	resp, err = gwc.New(nil).CookieJar(j).Get().URL(server.URL + "/me").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Wrong status code. Got: %d, expected: %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestJar_LoadPublicSuffix(t *testing.T) {
+	file := `[
+		{"name": "super", "value": "1", "domain": "com", "path": "/"},
+		{"name": "shared", "value": "2", "domain": "co.uk", "path": "/"},
+		{"name": "site", "value": "3", "domain": "example.com", "path": "/"}
+	]`
+	j := jar.New(nil)
+	if err := j.Load(strings.NewReader(file), jar.JSON); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for _, data := range []struct {
+		URL      string
+		Expected string
+	}{
+		{"http://www.example.com/", "site=3"},
+		{"http://example.co.uk/", ""},
+		{"http://com/", "super=1"},
+	} {
+		u, _ := url.Parse(data.URL)
+		var got []string
+		for _, c := range j.Cookies(u) {
+			got = append(got, c.Name+"="+c.Value)
+		}
+		if strings.Join(got, "; ") != data.Expected {
+			t.Errorf("Wrong cookies for %s. Got: %v, expected: %s", data.URL, got, data.Expected)
+		}
+	}
+}
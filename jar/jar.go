@@ -0,0 +1,412 @@
+// Package jar implements cookie jar that follows RFC 6265 and can be saved
+// to and loaded from files, so that clients stay logged in to APIs that use
+// session cookies across runs of a program.
+//
+// Cookies can not be set for public suffixes (like "co.uk" or
+// "github.io"), so that one site can not set cookies for other sites. This
+// applies to cookies loaded from files as well.
+//
+// Jar uses built-in list of most common public suffixes by default, which
+// is INCOMPLETE: sites under public suffixes that are not in it (like
+// private suffixes of hosting providers) can set cookies for each other.
+// Programs that talk to such sites should use complete list, either with
+// ParsePublicSuffixList and current list from
+// https://publicsuffix.org/list/public_suffix_list.dat, or
+// publicsuffix.List from golang.org/x/net/publicsuffix.
+//
+//	j := jar.New(nil)
+//	if err := j.LoadFile(path, jar.JSON); err != nil && !os.IsNotExist(err) {
+//		// handle error
+//	}
+//	c := gwc.New(nil).CookieJar(j)
+//	// send requests
+//	if err := j.SaveFile(path, jar.JSON); err != nil {
+//		// handle error
+//	}
+package jar
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie is cookie stored in jar.
+type Cookie struct {
+	Name   string
+	Value  string
+	Domain string
+	Path   string
+	// Expires is zero for session cookies, which are kept until jar is
+	// cleared.
+	Expires  time.Time
+	Secure   bool
+	HttpOnly bool
+	// HostOnly cookies are sent only to Domain and not to its subdomains.
+	HostOnly bool
+	SameSite http.SameSite
+	Created  time.Time
+}
+
+// expired returns true if cookie expired before provided time.
+func (c *Cookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// id identifies cookie in jar. Cookie set with same name, domain and path
+// replaces existing one.
+func (c *Cookie) id() string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+// entry is cookie stored in jar with its sequence number, which orders
+// cookies created at same time.
+type entry struct {
+	Cookie
+	seq uint64
+}
+
+// Jar is cookie jar that implements http.CookieJar interface. Jar is safe
+// for concurrent use.
+type Jar struct {
+	psl PublicSuffixList
+
+	mu sync.Mutex
+	// entries are cookies by domain and id
+	entries map[string]map[string]*entry
+	seq     uint64
+}
+
+// New creates and returns empty jar that uses provided public suffix list.
+// If psl is nil, DefaultPublicSuffixList is used, which is incomplete list
+// of common public suffixes.
+func New(psl PublicSuffixList) *Jar {
+	if psl == nil {
+		psl = DefaultPublicSuffixList
+	}
+	return &Jar{
+		psl:     psl,
+		entries: make(map[string]map[string]*entry),
+	}
+}
+
+// canonicalHost returns lower case host of provided URL, without port and
+// trailing dot.
+func canonicalHost(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// isSecure returns true if cookies with Secure attribute can be sent to
+// provided URL.
+func isSecure(u *url.URL) bool {
+	return u.Scheme == "https" || u.Scheme == "wss"
+}
+
+// SetCookies is implementation of http.CookieJar interface. Cookies that
+// provided URL can not set are ignored.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return
+	}
+	host := canonicalHost(u)
+	if host == "" {
+		return
+	}
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range cookies {
+		cookie, ok := j.newCookie(c, u, host, now)
+		if !ok {
+			continue
+		}
+		id := cookie.id()
+		existing, found := j.entries[cookie.Domain][id]
+		if cookie.expired(now) {
+			if found {
+				j.remove(cookie.Domain, id)
+			}
+			continue
+		}
+		e := &entry{Cookie: cookie}
+		if found {
+			// replaced cookie keeps its creation time and order
+			e.Created = existing.Created
+			e.seq = existing.seq
+		} else {
+			j.seq++
+			e.seq = j.seq
+		}
+		if j.entries[cookie.Domain] == nil {
+			j.entries[cookie.Domain] = make(map[string]*entry)
+		}
+		j.entries[cookie.Domain][id] = e
+	}
+}
+
+// newCookie validates provided cookie set by response from u, as described
+// by section 5.3 of RFC 6265, and returns cookie that should be stored.
+func (j *Jar) newCookie(c *http.Cookie, u *url.URL, host string, now time.Time) (Cookie, bool) {
+	if c.Name == "" {
+		return Cookie{}, false
+	}
+	if c.Secure && !isSecure(u) {
+		return Cookie{}, false
+	}
+	domain, hostOnly, ok := j.domain(host, c.Domain)
+	if !ok {
+		return Cookie{}, false
+	}
+	path := c.Path
+	if path == "" || path[0] != '/' {
+		path = defaultPath(u.Path)
+	}
+	cookie := Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   domain,
+		Path:     path,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+		HostOnly: hostOnly,
+		SameSite: c.SameSite,
+		Created:  now,
+	}
+	switch {
+	case c.MaxAge < 0:
+		cookie.Expires = now
+	case c.MaxAge > 0:
+		cookie.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	case !c.Expires.IsZero():
+		cookie.Expires = c.Expires
+	}
+	return cookie, true
+}
+
+// domain returns domain cookie with provided Domain attribute, set by
+// response from host, is stored for and whether cookie is host only.
+func (j *Jar) domain(host, attribute string) (string, bool, bool) {
+	domain := normalizeDomain(attribute)
+	if domain == "" {
+		return host, true, true
+	}
+	if net.ParseIP(host) != nil {
+		// IP addresses have no subdomains
+		return host, true, domain == host
+	}
+	if j.psl.PublicSuffix(domain) == domain {
+		// public suffix can set cookie only for itself
+		return host, true, domain == host
+	}
+	return domain, false, domainMatch(host, domain)
+}
+
+// defaultPath returns default path of cookies set by response to request
+// with provided path, as described by section 5.1.4 of RFC 6265.
+func defaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// domainMatch returns true if host is domain or its subdomain.
+func domainMatch(host, domain string) bool {
+	return host == domain || (strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil)
+}
+
+// pathMatch returns true if cookie with provided path should be sent to
+// request with provided path, as described by section 5.1.4 of RFC 6265.
+func pathMatch(requestPath, cookiePath string) bool {
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	if requestPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+// Cookies is implementation of http.CookieJar interface. Cookies are
+// ordered by path length, longer first, and then by creation time.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	host := canonicalHost(u)
+	if host == "" {
+		return nil
+	}
+	now := time.Now()
+	secure := isSecure(u)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var selected []*entry
+	for _, domain := range candidateDomains(host) {
+		for id, e := range j.entries[domain] {
+			if e.expired(now) {
+				j.remove(domain, id)
+				continue
+			}
+			if e.HostOnly && e.Domain != host {
+				continue
+			}
+			if (e.Secure && !secure) || !pathMatch(u.Path, e.Path) {
+				continue
+			}
+			selected = append(selected, e)
+		}
+	}
+	sort.Slice(selected, func(i, k int) bool {
+		if len(selected[i].Path) != len(selected[k].Path) {
+			return len(selected[i].Path) > len(selected[k].Path)
+		}
+		return selected[i].seq < selected[k].seq
+	})
+	cookies := make([]*http.Cookie, len(selected))
+	for i, e := range selected {
+		cookies[i] = &http.Cookie{Name: e.Name, Value: e.Value}
+	}
+	return cookies
+}
+
+// candidateDomains returns host and all its parent domains, since cookies
+// of any of them can be sent to host.
+func candidateDomains(host string) []string {
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+	domains := []string{host}
+	for i := strings.Index(host, "."); i >= 0; i = strings.Index(host, ".") {
+		host = host[i+1:]
+		domains = append(domains, host)
+	}
+	return domains
+}
+
+// remove removes cookie with provided domain and id. Caller has to hold
+// lock of jar.
+func (j *Jar) remove(domain, id string) {
+	delete(j.entries[domain], id)
+	if len(j.entries[domain]) == 0 {
+		delete(j.entries, domain)
+	}
+}
+
+// normalizeDomain returns domain in form cookies are stored with.
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(domain), "."), ".")
+}
+
+// All returns all cookies in jar that have not expired, ordered by domain,
+// path and name.
+func (j *Jar) All() []Cookie {
+	return j.Domain("")
+}
+
+// Domain returns cookies of provided domain and its subdomains that have
+// not expired, ordered by domain, path and name. If domain is empty, all
+// cookies are returned.
+func (j *Jar) Domain(domain string) []Cookie {
+	domain = normalizeDomain(domain)
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var cookies []Cookie
+	for d, entries := range j.entries {
+		if domain != "" && !domainMatch(d, domain) {
+			continue
+		}
+		for _, e := range entries {
+			if !e.expired(now) {
+				cookies = append(cookies, e.Cookie)
+			}
+		}
+	}
+	sortCookies(cookies)
+	return cookies
+}
+
+// sortCookies sorts cookies by domain, path and name.
+func sortCookies(cookies []Cookie) {
+	sort.Slice(cookies, func(i, k int) bool {
+		return cookies[i].id() < cookies[k].id()
+	})
+}
+
+// Domains returns domains that have cookies in jar, in alphabetical order.
+func (j *Jar) Domains() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	domains := make([]string, 0, len(j.entries))
+	for d := range j.entries {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// Clear removes cookies of provided domain and its subdomains. If domain
+// is empty, all cookies are removed.
+func (j *Jar) Clear(domain string) {
+	domain = normalizeDomain(domain)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if domain == "" {
+		j.entries = make(map[string]map[string]*entry)
+		return
+	}
+	for d := range j.entries {
+		if domainMatch(d, domain) {
+			delete(j.entries, d)
+		}
+	}
+}
+
+// add adds provided cookies to jar, replacing existing cookies with same
+// name, domain and path. Expired cookies are skipped. Domain cookies are
+// checked against public suffix list like cookies set by responses, so
+// cookie for public suffix is added only as host only cookie.
+func (j *Jar) add(cookies []Cookie) {
+	// sequence numbers of added cookies follow their creation time
+	sorted := make([]Cookie, len(cookies))
+	copy(sorted, cookies)
+	sort.SliceStable(sorted, func(i, k int) bool {
+		return sorted[i].Created.Before(sorted[k].Created)
+	})
+	now := time.Now()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, c := range sorted {
+		c.Domain = normalizeDomain(c.Domain)
+		if c.Name == "" || c.Domain == "" || c.expired(now) {
+			continue
+		}
+		if !c.HostOnly {
+			c.Domain, c.HostOnly, _ = j.domain(c.Domain, c.Domain)
+		}
+		if c.Path == "" || c.Path[0] != '/' {
+			c.Path = "/"
+		}
+		if c.Created.IsZero() {
+			c.Created = now
+		}
+		j.seq++
+		if j.entries[c.Domain] == nil {
+			j.entries[c.Domain] = make(map[string]*entry)
+		}
+		j.entries[c.Domain][c.id()] = &entry{Cookie: c, seq: j.seq}
+	}
+}
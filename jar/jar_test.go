@@ -0,0 +1,184 @@
+package jar_test
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc/jar"
+)
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	return u
+}
+
+// cookieNames returns names of cookies jar sends to provided URL.
+func cookieNames(t *testing.T, j *jar.Jar, rawURL string) string {
+	var names []string
+	for _, c := range j.Cookies(mustParse(t, rawURL)) {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestJar_Rules(t *testing.T) {
+	j := jar.New(nil)
+	set := func(rawURL string, cookies ...*http.Cookie) {
+		j.SetCookies(mustParse(t, rawURL), cookies)
+	}
+	set("http://www.example.com/app/login",
+		&http.Cookie{Name: "host", Value: "1"},
+		&http.Cookie{Name: "domain", Value: "1", Domain: ".example.com", Path: "/"},
+		&http.Cookie{Name: "path", Value: "1", Path: "/app/admin"},
+		&http.Cookie{Name: "other", Value: "1", Domain: "other.com"},
+		&http.Cookie{Name: "insecure", Value: "1", Secure: true},
+	)
+	set("https://www.example.com/", &http.Cookie{Name: "secure", Value: "1", Secure: true})
+	set("http://www.example.co.uk/",
+		&http.Cookie{Name: "suffix", Value: "1", Domain: "co.uk"},
+		&http.Cookie{Name: "site", Value: "1", Domain: "example.co.uk"},
+	)
+	set("http://user.github.io/", &http.Cookie{Name: "suffix", Value: "1", Domain: "github.io"})
+	set("http://github.io/", &http.Cookie{Name: "own", Value: "1", Domain: "github.io"})
+	set("http://127.0.0.1:8080/",
+		&http.Cookie{Name: "ip", Value: "1"},
+		&http.Cookie{Name: "parent", Value: "1", Domain: "0.0.1"},
+	)
+	set("ftp://www.example.com/", &http.Cookie{Name: "ftp", Value: "1"})
+
+	for _, data := range []struct {
+		URL      string
+		Expected string
+	}{
+		// default path of cookies set from /app/login is /app
+		{"http://www.example.com/app/list", "host domain"},
+		{"http://www.example.com/app/admin/users", "path host domain"},
+		{"http://www.example.com/application", "domain"},
+		{"https://www.example.com/", "domain secure"},
+		{"http://WWW.EXAMPLE.COM./app", "host domain"},
+		{"http://api.example.com/app", "domain"},
+		{"http://example.com/", "domain"},
+		{"http://other.com/", ""},
+		{"http://example.co.uk/", "site"},
+		{"http://another.co.uk/", ""},
+		{"http://other.github.io/", ""},
+		{"http://github.io/", "own"},
+		{"http://sub.github.io/", ""},
+		{"http://127.0.0.1/", "ip"},
+		{"ftp://www.example.com/", ""},
+	} {
+		if got := cookieNames(t, j, data.URL); got != data.Expected {
+			t.Errorf("Wrong cookies for %s. Got: %q, expected: %q", data.URL, got, data.Expected)
+		}
+	}
+}
+
+func TestJar_Expiration(t *testing.T) {
+	j := jar.New(nil)
+	u := mustParse(t, "http://example.com/")
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "1"},
+		{Name: "persistent", Value: "1", MaxAge: 3600},
+		{Name: "expires", Value: "1", Expires: time.Now().Add(time.Hour)},
+		{Name: "expired", Value: "1", Expires: time.Now().Add(-time.Hour)},
+	})
+	if got := cookieNames(t, j, "http://example.com/"); got != "session persistent expires" {
+		t.Errorf("Wrong cookies. Got: %q", got)
+	}
+
+	// replacing cookie keeps its order, deleting removes it
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "session", Value: "2"},
+		{Name: "persistent", MaxAge: -1},
+		{Name: "expires", Expires: time.Unix(1, 0)},
+	})
+	cookies := j.Cookies(u)
+	if len(cookies) != 1 || cookies[0].Name != "session" || cookies[0].Value != "2" {
+		t.Errorf("Wrong cookies after update. Got: %v", cookies)
+	}
+}
+
+func TestJar_DomainAndClear(t *testing.T) {
+	j := jar.New(nil)
+	j.SetCookies(mustParse(t, "https://api.example.com/"), []*http.Cookie{
+		{Name: "a", Value: "1", Secure: true, HttpOnly: true, SameSite: http.SameSiteStrictMode},
+		{Name: "b", Value: "2", Domain: "example.com"},
+	})
+	j.SetCookies(mustParse(t, "https://example.org/"), []*http.Cookie{{Name: "c", Value: "3"}})
+
+	if domains := j.Domains(); !reflect.DeepEqual(domains, []string{"api.example.com", "example.com", "example.org"}) {
+		t.Errorf("Wrong domains. Got: %v", domains)
+	}
+	cookies := j.Domain("EXAMPLE.com")
+	if len(cookies) != 2 {
+		t.Fatalf("Wrong number of cookies. Got: %d, expected: %d", len(cookies), 2)
+	}
+	a := cookies[0]
+	if a.Name != "a" || a.Domain != "api.example.com" || !a.HostOnly || !a.Secure || !a.HttpOnly || a.SameSite != http.SameSiteStrictMode || a.Path != "/" {
+		t.Errorf("Wrong cookie. Got: %+v", a)
+	}
+	if cookies[1].Name != "b" || cookies[1].HostOnly {
+		t.Errorf("Wrong cookie. Got: %+v", cookies[1])
+	}
+	if len(j.Domain("api.example.com")) != 1 {
+		t.Error("Cookies of parent domain returned for subdomain.")
+	}
+
+	j.Clear(".example.com")
+	if all := j.All(); len(all) != 1 || all[0].Name != "c" {
+		t.Errorf("Wrong cookies after clear. Got: %v", all)
+	}
+	j.Clear("")
+	if all := j.All(); len(all) != 0 {
+		t.Errorf("Cookies not cleared. Got: %v", all)
+	}
+}
+
+func TestParsePublicSuffixList(t *testing.T) {
+	psl, err := jar.ParsePublicSuffixList(strings.NewReader(`
+// comment
+com
+co.uk
+*.ck
+!www.ck
+*.kawasaki.jp
+!city.kawasaki.jp
+`), "test")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if psl.String() != "test" {
+		t.Errorf("Wrong source. Got: %s, expected: %s", psl.String(), "test")
+	}
+	for domain, expected := range map[string]string{
+		"example.com":              "com",
+		"www.example.co.uk":        "co.uk",
+		"co.uk":                    "co.uk",
+		"example.org":              "org",
+		"org":                      "org",
+		"a.b.ck":                   "b.ck",
+		"www.ck":                   "ck",
+		"example.www.ck":           "ck",
+		"city.kawasaki.jp":         "kawasaki.jp",
+		"www.example.kawasaki.jp":  "example.kawasaki.jp",
+		"www.city.kawasaki.jp":     "kawasaki.jp",
+		"WWW.EXAMPLE.KAWASAKI.JP":  "example.kawasaki.jp",
+		"deep.sub.example.co.uk":   "co.uk",
+		"example.notlisted.domain": "domain",
+	} {
+		if got := psl.PublicSuffix(domain); got != expected {
+			t.Errorf("Wrong public suffix for %s. Got: %s, expected: %s", domain, got, expected)
+		}
+	}
+
+	if _, err := jar.ParsePublicSuffixList(strings.NewReader("example.*.com"), "invalid"); err == nil {
+		t.Error("Expected error for invalid rule.")
+	}
+}
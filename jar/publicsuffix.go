@@ -0,0 +1,238 @@
+package jar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PublicSuffixList returns public suffix of domains. It is same as
+// cookiejar.PublicSuffixList from standard library, so publicsuffix.List
+// from golang.org/x/net/publicsuffix can be used as well.
+type PublicSuffixList interface {
+	// PublicSuffix returns public suffix of domain, like "com" for
+	// "example.com" or "co.uk" for "www.example.co.uk".
+	PublicSuffix(domain string) string
+	// String returns description of source of this list.
+	String() string
+}
+
+// suffixList is public suffix list with rules in format of
+// https://publicsuffix.org/list/.
+type suffixList struct {
+	source     string
+	rules      map[string]bool
+	wildcards  map[string]bool
+	exceptions map[string]bool
+}
+
+// ParsePublicSuffixList parses public suffix list in format of
+// https://publicsuffix.org/list/public_suffix_list.dat. Domains have to be
+// in ASCII (punycode) form, same as domains of URLs checked against list.
+func ParsePublicSuffixList(r io.Reader, source string) (PublicSuffixList, error) {
+	l := &suffixList{
+		source:     source,
+		rules:      make(map[string]bool),
+		wildcards:  make(map[string]bool),
+		exceptions: make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		rule := strings.ToLower(fields[0])
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			l.exceptions[rule[1:]] = true
+		case strings.HasPrefix(rule, "*."):
+			l.wildcards[rule[2:]] = true
+		case strings.Contains(rule, "*") || strings.HasPrefix(rule, ".") || strings.HasSuffix(rule, "."):
+			return nil, fmt.Errorf("jar: invalid public suffix rule %q on line %d", rule, line)
+		default:
+			l.rules[rule] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("jar: reading public suffix list: %v", err)
+	}
+	return l, nil
+}
+
+// PublicSuffix is implementation of PublicSuffixList interface. Domains
+// that match no rule have their last label as public suffix.
+func (l *suffixList) PublicSuffix(domain string) string {
+	domain = strings.ToLower(domain)
+	// rules are checked from longest suffix, since longest matching rule
+	// wins, except for exceptions, which are always longer than wildcard
+	// they are exception of
+	for suffix := domain; ; {
+		if l.exceptions[suffix] {
+			return suffix[strings.Index(suffix, ".")+1:]
+		}
+		if l.rules[suffix] {
+			return suffix
+		}
+		i := strings.Index(suffix, ".")
+		if i < 0 {
+			return suffix
+		}
+		if l.wildcards[suffix[i+1:]] {
+			return suffix
+		}
+		suffix = suffix[i+1:]
+	}
+}
+
+// String is implementation of PublicSuffixList interface.
+func (l *suffixList) String() string {
+	return l.source
+}
+
+// DefaultPublicSuffixList is built-in list of most common public suffixes
+// that have more than one label. Other domains have last label as public
+// suffix, so all top level domains are covered. It is not complete list,
+// see package documentation.
+var DefaultPublicSuffixList PublicSuffixList
+
+func init() {
+	l, err := ParsePublicSuffixList(strings.NewReader(defaultRules), "gwc built-in public suffix list")
+	if err != nil {
+		panic(err)
+	}
+	DefaultPublicSuffixList = l
+}
+
+// defaultRules are rules of DefaultPublicSuffixList.
+const defaultRules = `
+// country code second level domains
+ac.uk
+co.uk
+gov.uk
+ltd.uk
+me.uk
+net.uk
+nhs.uk
+org.uk
+plc.uk
+police.uk
+*.sch.uk
+com.au
+edu.au
+gov.au
+net.au
+org.au
+id.au
+co.nz
+net.nz
+org.nz
+govt.nz
+ac.nz
+ac.jp
+co.jp
+go.jp
+ne.jp
+or.jp
+*.kawasaki.jp
+*.kitakyushu.jp
+*.kobe.jp
+*.nagoya.jp
+*.sapporo.jp
+*.sendai.jp
+*.yokohama.jp
+!city.kawasaki.jp
+!city.kitakyushu.jp
+!city.kobe.jp
+!city.nagoya.jp
+!city.sapporo.jp
+!city.sendai.jp
+!city.yokohama.jp
+ac.kr
+co.kr
+go.kr
+or.kr
+com.cn
+edu.cn
+gov.cn
+net.cn
+org.cn
+com.hk
+edu.hk
+gov.hk
+org.hk
+com.tw
+org.tw
+co.in
+firm.in
+gen.in
+gov.in
+net.in
+org.in
+com.sg
+edu.sg
+gov.sg
+com.my
+co.id
+co.th
+com.ph
+com.vn
+com.br
+gov.br
+net.br
+org.br
+com.ar
+com.mx
+gob.mx
+com.co
+com.pe
+co.za
+gov.za
+org.za
+com.ng
+co.ke
+com.eg
+co.il
+org.il
+com.tr
+gov.tr
+com.ua
+com.pl
+net.pl
+org.pl
+co.at
+or.at
+com.es
+co.it
+com.gr
+com.ru
+*.ck
+!www.ck
+*.bd
+*.np
+// hosting and cloud providers
+github.io
+githubusercontent.com
+gitlab.io
+herokuapp.com
+appspot.com
+blogspot.com
+firebaseapp.com
+web.app
+netlify.app
+vercel.app
+pages.dev
+workers.dev
+fly.dev
+onrender.com
+azurewebsites.net
+cloudapp.net
+azurestaticapps.net
+cloudfront.net
+elasticbeanstalk.com
+s3.amazonaws.com
+*.compute.amazonaws.com
+ngrok.io
+ngrok-free.app
+`
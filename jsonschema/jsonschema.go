@@ -0,0 +1,340 @@
+// Package jsonschema validates JSON values against JSON Schema (draft
+// 2020-12).
+//
+// All validation keywords are supported, except unevaluatedItems and
+// unevaluatedProperties. References can point only to locations within
+// same document, either as JSON pointers (like "#/$defs/name") or as
+// anchors. Schemas that refer to themselves while validating same value
+// (like {"$ref": "#"}) are rejected. Known formats (date-time, date, time,
+// email, hostname, ipv4, ipv6, uri and uuid) are validated, others are
+// ignored. Keywords of OpenAPI 3.0 schemas (nullable and boolean
+// exclusiveMinimum and exclusiveMaximum) are supported as well, so schemas
+// from both OpenAPI 3.0 and 3.1 documents can be used.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is compiled JSON Schema. It is safe for concurrent use.
+type Schema struct {
+	root    interface{}
+	schema  interface{}
+	regexps map[string]*regexp.Regexp
+}
+
+// Compile parses and compiles JSON Schema.
+func Compile(data []byte) (*Schema, error) {
+	v, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("jsonschema: %v", err)
+	}
+	return CompileIn(v, v)
+}
+
+// MustCompile is like Compile, but panics if schema can not be compiled.
+func MustCompile(data []byte) *Schema {
+	s, err := Compile(data)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// CompileIn compiles schema that is part of larger JSON document (for
+// example, schema in OpenAPI document). Both document and schema have to be
+// decoded JSON values and references in schema are resolved against
+// document.
+func CompileIn(root, schema interface{}) (*Schema, error) {
+	s := &Schema{
+		root:    root,
+		schema:  schema,
+		regexps: make(map[string]*regexp.Regexp),
+	}
+	refs := make(map[string]bool)
+	if err := s.compile(schema, refs); err != nil {
+		return nil, fmt.Errorf("jsonschema: %v", err)
+	}
+	checked := make(map[string]bool)
+	for ref := range refs {
+		if err := s.checkCycle(ref, make(map[string]bool), checked); err != nil {
+			return nil, fmt.Errorf("jsonschema: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// decode decodes JSON keeping numbers as json.Number, so that large
+// integers are not changed.
+func decode(data []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// compile checks that all references in schema can be resolved and
+// compiles all regular expressions in it.
+func (s *Schema) compile(node interface{}, refs map[string]bool) error {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, v := range n {
+			if err := s.compile(v, refs); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if p, ok := n["pattern"].(string); ok {
+			if err := s.addRegexp(p); err != nil {
+				return err
+			}
+		}
+		if pp, ok := n["patternProperties"].(map[string]interface{}); ok {
+			for p := range pp {
+				if err := s.addRegexp(p); err != nil {
+					return err
+				}
+			}
+		}
+		if ref, ok := n["$ref"].(string); ok && !refs[ref] {
+			refs[ref] = true
+			target, err := s.resolve(ref)
+			if err != nil {
+				return err
+			}
+			if err := s.compile(target, refs); err != nil {
+				return err
+			}
+		}
+		for k, v := range n {
+			// values of these keywords are instances, not schemas
+			if k == "enum" || k == "const" || k == "default" || k == "examples" {
+				continue
+			}
+			if err := s.compile(v, refs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkCycle returns error if schema that provided reference points to
+// refers back to itself while validating same value, since validation with
+// such schema would never end. References in schemas of properties or
+// items are not cycles, as they validate other values. Resolved references
+// that are not part of a cycle are added to checked.
+func (s *Schema) checkCycle(ref string, active, checked map[string]bool) error {
+	if checked[ref] {
+		return nil
+	}
+	if active[ref] {
+		return fmt.Errorf("reference %q refers to itself", ref)
+	}
+	active[ref] = true
+	// references are resolved when schema is compiled
+	target, _ := s.resolve(ref)
+	for _, r := range inPlaceRefs(target) {
+		if err := s.checkCycle(r, active, checked); err != nil {
+			return err
+		}
+	}
+	checked[ref] = true
+	return nil
+}
+
+// inPlaceRefs returns references used to validate same value as provided
+// schema, directly or through keywords like allOf.
+func inPlaceRefs(node interface{}) []string {
+	n, ok := node.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var refs []string
+	if ref, ok := n["$ref"].(string); ok {
+		refs = append(refs, ref)
+	}
+	var subs []interface{}
+	for _, k := range []string{"allOf", "anyOf", "oneOf"} {
+		if l, ok := n[k].([]interface{}); ok {
+			subs = append(subs, l...)
+		}
+	}
+	for _, k := range []string{"not", "if", "then", "else"} {
+		if sub, ok := n[k]; ok {
+			subs = append(subs, sub)
+		}
+	}
+	if deps, ok := n["dependentSchemas"].(map[string]interface{}); ok {
+		for _, sub := range deps {
+			subs = append(subs, sub)
+		}
+	}
+	for _, sub := range subs {
+		refs = append(refs, inPlaceRefs(sub)...)
+	}
+	return refs
+}
+
+func (s *Schema) addRegexp(pattern string) error {
+	if _, ok := s.regexps[pattern]; ok {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	s.regexps[pattern] = re
+	return nil
+}
+
+// resolve returns schema that reference points to.
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %q, only references within document are supported", ref)
+	}
+	fragment, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference %q: %v", ref, err)
+	}
+	if fragment != "" && !strings.HasPrefix(fragment, "/") {
+		if target := findAnchor(s.root, fragment); target != nil {
+			return target, nil
+		}
+		return nil, fmt.Errorf("anchor of reference %q not found", ref)
+	}
+	target, ok := Pointer(s.root, fragment)
+	if !ok {
+		return nil, fmt.Errorf("target of reference %q not found", ref)
+	}
+	return target, nil
+}
+
+// findAnchor returns schema with provided $anchor.
+func findAnchor(node interface{}, anchor string) interface{} {
+	switch n := node.(type) {
+	case []interface{}:
+		for _, v := range n {
+			if found := findAnchor(v, anchor); found != nil {
+				return found
+			}
+		}
+	case map[string]interface{}:
+		if a, ok := n["$anchor"].(string); ok && a == anchor {
+			return n
+		}
+		for _, v := range n {
+			if found := findAnchor(v, anchor); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// Pointer returns value that JSON pointer points to in provided document.
+func Pointer(document interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return document, true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+	node := document
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[token]
+			if !ok {
+				return nil, false
+			}
+			node = v
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			node = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// Escape escapes token of JSON pointer.
+func Escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// Error is single validation error.
+type Error struct {
+	// InstanceLocation is JSON pointer to invalid value.
+	InstanceLocation string
+	// KeywordLocation is JSON pointer to schema keyword that value does not
+	// satisfy.
+	KeywordLocation string
+	Message         string
+}
+
+// Error is implementation of error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%q: %s", e.InstanceLocation, e.Message)
+}
+
+// ValidationError holds all errors found during validation.
+type ValidationError struct {
+	Errors []*Error
+}
+
+// Error is implementation of error interface.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "jsonschema: validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Validate validates decoded JSON value against schema. If value is not
+// valid, returned error is *ValidationError.
+func (s *Schema) Validate(instance interface{}) error {
+	v := &validator{schema: s}
+	v.validate(s.schema, instance, "", "")
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// ValidateJSON decodes provided JSON and validates it against schema.
+// Error is returned if data is not valid JSON or if it is not valid
+// according to schema, in which case it is *ValidationError.
+func (s *Schema) ValidateJSON(data []byte) error {
+	v, err := decode(data)
+	if err != nil {
+		return fmt.Errorf("jsonschema: %v", err)
+	}
+	return s.Validate(v)
+}
+
+// sortedKeys returns sorted keys of provided object.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,152 @@
+package jsonschema_test
+
+import (
+	"testing"
+
+	"github.com/delicb/gwc/jsonschema"
+)
+
+func TestCompile_Invalid(t *testing.T) {
+	for _, schema := range []string{
+		`not json`,
+		`{"pattern": "("}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$ref": "other.json#/a"}`,
+		`{"$ref": "#missing"}`,
+		`{"$ref": "#"}`,
+		`{"$ref": "#/$defs/a", "$defs": {"a": {"$ref": "#/$defs/a"}}}`,
+		`{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}, "items": {"$ref": "#/$defs/a"}}`,
+		`{"anyOf": [{"type": "string"}, {"not": {"$ref": "#"}}]}`,
+	} {
+		if _, err := jsonschema.Compile([]byte(schema)); err == nil {
+			t.Errorf("Expected error for schema %s.", schema)
+		}
+	}
+}
+
+func TestSchema_ValidateJSON(t *testing.T) {
+	for _, data := range []struct {
+		Schema   string
+		Instance string
+		Valid    bool
+	}{
+		{`true`, `1`, true},
+		{`false`, `1`, false},
+		{`{"type": "integer"}`, `1`, true},
+		{`{"type": "integer"}`, `1.0`, true},
+		{`{"type": "integer"}`, `1.5`, false},
+		{`{"type": "number"}`, `1`, true},
+		{`{"type": ["string", "null"]}`, `null`, true},
+		{`{"type": "string", "nullable": true}`, `null`, true},
+		{`{"type": "string"}`, `null`, false},
+		{`{"enum": [1, "a"]}`, `1.0`, true},
+		{`{"enum": [1, "a"]}`, `"b"`, false},
+		{`{"const": {"a": [1]}}`, `{"a": [1]}`, true},
+		{`{"minimum": 1, "maximum": 3}`, `3`, true},
+		{`{"minimum": 1, "maximum": 3}`, `4`, false},
+		{`{"exclusiveMaximum": 3}`, `3`, false},
+		{`{"maximum": 3, "exclusiveMaximum": true}`, `3`, false},
+		{`{"multipleOf": 0.1}`, `0.3`, true},
+		{`{"multipleOf": 2}`, `3`, false},
+		{`{"minLength": 2, "maxLength": 3}`, `"ab"`, true},
+		{`{"maxLength": 2}`, `"ćao"`, false},
+		{`{"pattern": "^a+$"}`, `"aaa"`, true},
+		{`{"pattern": "^a+$"}`, `"ab"`, false},
+		{`{"format": "date-time"}`, `"2020-01-02T03:04:05Z"`, true},
+		{`{"format": "date-time"}`, `"yesterday"`, false},
+		{`{"format": "uuid"}`, `"123e4567-e89b-12d3-a456-426614174000"`, true},
+		{`{"format": "email"}`, `"not an email"`, false},
+		{`{"format": "ipv4"}`, `"::1"`, false},
+		{`{"format": "unknown"}`, `"anything"`, true},
+		{`{"items": {"type": "integer"}}`, `[1, 2]`, true},
+		{`{"items": {"type": "integer"}}`, `[1, "a"]`, false},
+		{`{"prefixItems": [{"type": "string"}], "items": false}`, `["a"]`, true},
+		{`{"prefixItems": [{"type": "string"}], "items": false}`, `["a", 1]`, false},
+		{`{"minItems": 1, "maxItems": 2, "uniqueItems": true}`, `[1, 1]`, false},
+		{`{"contains": {"type": "string"}, "maxContains": 1}`, `[1, "a"]`, true},
+		{`{"contains": {"type": "string"}}`, `[1, 2]`, false},
+		{`{"required": ["a"], "properties": {"a": {"type": "string"}}}`, `{"a": "b"}`, true},
+		{`{"required": ["a"]}`, `{}`, false},
+		{`{"properties": {"a": {"type": "string"}}, "additionalProperties": false}`, `{"b": 1}`, false},
+		{`{"patternProperties": {"^x-": {"type": "string"}}, "additionalProperties": false}`, `{"x-a": "b"}`, true},
+		{`{"propertyNames": {"maxLength": 1}}`, `{"ab": 1}`, false},
+		{`{"minProperties": 1, "maxProperties": 1}`, `{"a": 1, "b": 2}`, false},
+		{`{"dependentRequired": {"a": ["b"]}}`, `{"a": 1}`, false},
+		{`{"dependentSchemas": {"a": {"required": ["b"]}}}`, `{"a": 1, "b": 2}`, true},
+		{`{"allOf": [{"type": "integer"}, {"minimum": 2}]}`, `1`, false},
+		{`{"anyOf": [{"type": "integer"}, {"type": "string"}]}`, `"a"`, true},
+		{`{"anyOf": [{"type": "integer"}, {"type": "string"}]}`, `true`, false},
+		{`{"oneOf": [{"type": "integer"}, {"type": "number"}]}`, `1`, false},
+		{`{"oneOf": [{"type": "integer"}, {"type": "number"}]}`, `1.5`, true},
+		{`{"not": {"type": "string"}}`, `"a"`, false},
+		{`{"if": {"type": "string"}, "then": {"minLength": 2}, "else": {"minimum": 2}}`, `"a"`, false},
+		{`{"if": {"type": "string"}, "then": {"minLength": 2}, "else": {"minimum": 2}}`, `3`, true},
+		{`{"$defs": {"pos": {"minimum": 0}}, "items": {"$ref": "#/$defs/pos"}}`, `[1, -1]`, false},
+		{`{"$defs": {"pos": {"$anchor": "pos", "minimum": 0}}, "$ref": "#pos"}`, `1`, true},
+		{`{"$defs": {"node": {"properties": {"next": {"$ref": "#/$defs/node"}, "v": {"type": "integer"}}}}, "$ref": "#/$defs/node"}`, `{"v": 1, "next": {"v": "a"}}`, false},
+		{`{"items": {"$ref": "#"}, "type": "array"}`, `[[], [[]]]`, true},
+		{`{"type": "string", "default": {"pattern": "("}, "examples": [{"$ref": "#/missing"}]}`, `"a"`, true},
+	} {
+		schema, err := jsonschema.Compile([]byte(data.Schema))
+		if err != nil {
+			t.Errorf("Got unexpected error for schema %s: %v", data.Schema, err)
+			continue
+		}
+		err = schema.ValidateJSON([]byte(data.Instance))
+		if data.Valid && err != nil {
+			t.Errorf("Expected %s to be valid against %s, got: %v", data.Instance, data.Schema, err)
+		}
+		if !data.Valid && err == nil {
+			t.Errorf("Expected %s to be invalid against %s.", data.Instance, data.Schema)
+		}
+	}
+}
+
+func TestValidationError_Locations(t *testing.T) {
+	schema := jsonschema.MustCompile([]byte(`{
+		"type": "object",
+		"properties": {
+			"users": {"type": "array", "items": {"$ref": "#/$defs/user"}}
+		},
+		"$defs": {
+			"user": {"type": "object", "required": ["id"], "properties": {"a/b": {"type": "integer"}}}
+		}
+	}`))
+	err := schema.ValidateJSON([]byte(`{"users": [{"id": 1}, {"a/b": "x"}]}`))
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		t.Fatalf("Expected ValidationError, got: %v", err)
+	}
+	if len(verr.Errors) != 2 {
+		t.Fatalf("Wrong number of errors. Got: %d, expected: 2 (%v)", len(verr.Errors), err)
+	}
+	for i, expected := range []struct {
+		instance, keyword string
+	}{
+		{"/users/1", "/properties/users/items/$ref/required"},
+		{"/users/1/a~1b", "/properties/users/items/$ref/properties/a~1b/type"},
+	} {
+		e := verr.Errors[i]
+		if e.InstanceLocation != expected.instance {
+			t.Errorf("Wrong instance location. Got: %s, expected: %s", e.InstanceLocation, expected.instance)
+		}
+		if e.KeywordLocation != expected.keyword {
+			t.Errorf("Wrong keyword location. Got: %s, expected: %s", e.KeywordLocation, expected.keyword)
+		}
+	}
+}
+
+func TestPointer(t *testing.T) {
+	doc := map[string]interface{}{
+		"a/b": []interface{}{"x", map[string]interface{}{"~c": 1}},
+	}
+	v, ok := jsonschema.Pointer(doc, "/a~1b/1/~0c")
+	if !ok || v != 1 {
+		t.Errorf("Wrong value. Got: %v, expected: 1", v)
+	}
+	for _, p := range []string{"/missing", "/a~1b/2", "/a~1b/x", "no-slash"} {
+		if _, ok := jsonschema.Pointer(doc, p); ok {
+			t.Errorf("Expected pointer %s not to be found.", p)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// validator collects errors of single validation.
+type validator struct {
+	schema *Schema
+	errors []*Error
+}
+
+func (v *validator) fail(instLoc, kwLoc, format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{
+		InstanceLocation: instLoc,
+		KeywordLocation:  kwLoc,
+		Message:          fmt.Sprintf(format, args...),
+	})
+}
+
+// matches reports if instance is valid against schema, without recording
+// errors.
+func (v *validator) matches(schema, instance interface{}) bool {
+	sub := &validator{schema: v.schema}
+	sub.validate(schema, instance, "", "")
+	return len(sub.errors) == 0
+}
+
+func (v *validator) validate(schema, instance interface{}, instLoc, kwLoc string) {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			v.fail(instLoc, kwLoc, "no value is allowed")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(s, instance, instLoc, kwLoc)
+	}
+}
+
+func (v *validator) validateObjectSchema(s map[string]interface{}, instance interface{}, instLoc, kwLoc string) {
+	if instance == nil && s["nullable"] == true {
+		return
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		// references are checked when schema is compiled
+		target, _ := v.schema.resolve(ref)
+		v.validate(target, instance, instLoc, kwLoc+"/$ref")
+	}
+
+	if t, ok := s["type"]; ok {
+		v.validateType(t, instance, instLoc, kwLoc+"/type")
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if equal(e, instance) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(instLoc, kwLoc+"/enum", "value is not one of allowed values")
+		}
+	}
+	if c, ok := s["const"]; ok && !equal(c, instance) {
+		v.fail(instLoc, kwLoc+"/const", "value is not equal to constant")
+	}
+
+	switch i := instance.(type) {
+	case string:
+		v.validateString(s, i, instLoc, kwLoc)
+	case []interface{}:
+		v.validateArray(s, i, instLoc, kwLoc)
+	case map[string]interface{}:
+		v.validateObject(s, i, instLoc, kwLoc)
+	default:
+		if n, ok := number(instance); ok {
+			v.validateNumber(s, n, instLoc, kwLoc)
+		}
+	}
+
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for i, sub := range all {
+			v.validate(sub, instance, instLoc, fmt.Sprintf("%s/allOf/%d", kwLoc, i))
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if v.matches(sub, instance) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(instLoc, kwLoc+"/anyOf", "value does not match any schema")
+		}
+	}
+	if one, ok := s["oneOf"].([]interface{}); ok {
+		count := 0
+		for _, sub := range one {
+			if v.matches(sub, instance) {
+				count++
+			}
+		}
+		if count != 1 {
+			v.fail(instLoc, kwLoc+"/oneOf", "value matches %d schemas, expected exactly one", count)
+		}
+	}
+	if not, ok := s["not"]; ok && v.matches(not, instance) {
+		v.fail(instLoc, kwLoc+"/not", "value matches schema it must not match")
+	}
+	if cond, ok := s["if"]; ok {
+		if v.matches(cond, instance) {
+			if then, ok := s["then"]; ok {
+				v.validate(then, instance, instLoc, kwLoc+"/then")
+			}
+		} else if els, ok := s["else"]; ok {
+			v.validate(els, instance, instLoc, kwLoc+"/else")
+		}
+	}
+}
+
+// typeOf returns JSON type of instance.
+func typeOf(instance interface{}) string {
+	switch i := instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		if n, ok := number(i); ok {
+			if n == math.Trunc(n) {
+				return "integer"
+			}
+			return "number"
+		}
+	}
+	return fmt.Sprintf("%T", instance)
+}
+
+func (v *validator) validateType(t, instance interface{}, instLoc, kwLoc string) {
+	var types []string
+	switch t := t.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	actual := typeOf(instance)
+	for _, expected := range types {
+		if expected == actual || (expected == "number" && actual == "integer") {
+			return
+		}
+	}
+	v.fail(instLoc, kwLoc, "expected %s, got %s", strings.Join(types, " or "), actual)
+}
+
+func (v *validator) validateNumber(s map[string]interface{}, n float64, instLoc, kwLoc string) {
+	if m, ok := number(s["multipleOf"]); ok && m > 0 {
+		q := n / m
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			v.fail(instLoc, kwLoc+"/multipleOf", "%v is not multiple of %v", n, m)
+		}
+	}
+	if max, ok := number(s["maximum"]); ok {
+		if s["exclusiveMaximum"] == true && n >= max {
+			v.fail(instLoc, kwLoc+"/exclusiveMaximum", "%v is not less than %v", n, max)
+		} else if n > max {
+			v.fail(instLoc, kwLoc+"/maximum", "%v is greater than %v", n, max)
+		}
+	}
+	if max, ok := number(s["exclusiveMaximum"]); ok && n >= max {
+		v.fail(instLoc, kwLoc+"/exclusiveMaximum", "%v is not less than %v", n, max)
+	}
+	if min, ok := number(s["minimum"]); ok {
+		if s["exclusiveMinimum"] == true && n <= min {
+			v.fail(instLoc, kwLoc+"/exclusiveMinimum", "%v is not greater than %v", n, min)
+		} else if n < min {
+			v.fail(instLoc, kwLoc+"/minimum", "%v is less than %v", n, min)
+		}
+	}
+	if min, ok := number(s["exclusiveMinimum"]); ok && n <= min {
+		v.fail(instLoc, kwLoc+"/exclusiveMinimum", "%v is not greater than %v", n, min)
+	}
+}
+
+func (v *validator) validateString(s map[string]interface{}, str, instLoc, kwLoc string) {
+	length := utf8.RuneCountInString(str)
+	if max, ok := number(s["maxLength"]); ok && float64(length) > max {
+		v.fail(instLoc, kwLoc+"/maxLength", "length %d is greater than %v", length, max)
+	}
+	if min, ok := number(s["minLength"]); ok && float64(length) < min {
+		v.fail(instLoc, kwLoc+"/minLength", "length %d is less than %v", length, min)
+	}
+	if p, ok := s["pattern"].(string); ok && !v.schema.regexps[p].MatchString(str) {
+		v.fail(instLoc, kwLoc+"/pattern", "value does not match pattern %q", p)
+	}
+	if f, ok := s["format"].(string); ok && !validFormat(f, str) {
+		v.fail(instLoc, kwLoc+"/format", "value is not valid %s", f)
+	}
+}
+
+func (v *validator) validateArray(s map[string]interface{}, arr []interface{}, instLoc, kwLoc string) {
+	if max, ok := number(s["maxItems"]); ok && float64(len(arr)) > max {
+		v.fail(instLoc, kwLoc+"/maxItems", "array has %d items, more than %v", len(arr), max)
+	}
+	if min, ok := number(s["minItems"]); ok && float64(len(arr)) < min {
+		v.fail(instLoc, kwLoc+"/minItems", "array has %d items, less than %v", len(arr), min)
+	}
+	if s["uniqueItems"] == true {
+		for i := range arr {
+			for j := i + 1; j < len(arr); j++ {
+				if equal(arr[i], arr[j]) {
+					v.fail(instLoc, kwLoc+"/uniqueItems", "items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+
+	// older drafts used items array instead of prefixItems
+	prefix, _ := s["prefixItems"].([]interface{})
+	prefixKw := "/prefixItems"
+	items, hasItems := s["items"]
+	if list, ok := items.([]interface{}); ok {
+		prefix, prefixKw = list, "/items"
+		items, hasItems = s["additionalItems"]
+	}
+	for i, item := range arr {
+		loc := fmt.Sprintf("%s/%d", instLoc, i)
+		switch {
+		case i < len(prefix):
+			v.validate(prefix[i], item, loc, fmt.Sprintf("%s%s/%d", kwLoc, prefixKw, i))
+		case hasItems:
+			v.validate(items, item, loc, kwLoc+"/items")
+		}
+	}
+
+	if contains, ok := s["contains"]; ok {
+		count := 0
+		for _, item := range arr {
+			if v.matches(contains, item) {
+				count++
+			}
+		}
+		min := 1.0
+		if m, ok := number(s["minContains"]); ok {
+			min = m
+		}
+		if float64(count) < min {
+			v.fail(instLoc, kwLoc+"/contains", "array contains %d matching items, less than %v", count, min)
+		}
+		if max, ok := number(s["maxContains"]); ok && float64(count) > max {
+			v.fail(instLoc, kwLoc+"/maxContains", "array contains %d matching items, more than %v", count, max)
+		}
+	}
+}
+
+func (v *validator) validateObject(s map[string]interface{}, obj map[string]interface{}, instLoc, kwLoc string) {
+	if max, ok := number(s["maxProperties"]); ok && float64(len(obj)) > max {
+		v.fail(instLoc, kwLoc+"/maxProperties", "object has %d properties, more than %v", len(obj), max)
+	}
+	if min, ok := number(s["minProperties"]); ok && float64(len(obj)) < min {
+		v.fail(instLoc, kwLoc+"/minProperties", "object has %d properties, less than %v", len(obj), min)
+	}
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, ok := obj[name]; !ok {
+					v.fail(instLoc, kwLoc+"/required", "missing required property %q", name)
+				}
+			}
+		}
+	}
+	if deps, ok := s["dependentRequired"].(map[string]interface{}); ok {
+		for _, name := range sortedKeys(deps) {
+			if _, ok := obj[name]; !ok {
+				continue
+			}
+			required, _ := deps[name].([]interface{})
+			for _, r := range required {
+				if rn, ok := r.(string); ok {
+					if _, ok := obj[rn]; !ok {
+						v.fail(instLoc, kwLoc+"/dependentRequired/"+Escape(name), "property %q is required when %q is present", rn, name)
+					}
+				}
+			}
+		}
+	}
+	if deps, ok := s["dependentSchemas"].(map[string]interface{}); ok {
+		for _, name := range sortedKeys(deps) {
+			if _, ok := obj[name]; ok {
+				v.validate(deps[name], obj, instLoc, kwLoc+"/dependentSchemas/"+Escape(name))
+			}
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patterns, _ := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	names, hasNames := s["propertyNames"]
+	for _, name := range sortedKeys(obj) {
+		value := obj[name]
+		loc := instLoc + "/" + Escape(name)
+		if hasNames && !v.matches(names, name) {
+			v.fail(loc, kwLoc+"/propertyNames", "property name %q is not valid", name)
+		}
+		matched := false
+		if ps, ok := properties[name]; ok {
+			matched = true
+			v.validate(ps, value, loc, kwLoc+"/properties/"+Escape(name))
+		}
+		for _, p := range sortedKeys(patterns) {
+			if v.schema.regexps[p].MatchString(name) {
+				matched = true
+				v.validate(patterns[p], value, loc, kwLoc+"/patternProperties/"+Escape(p))
+			}
+		}
+		if !matched && hasAdditional {
+			if additional == false {
+				v.fail(loc, kwLoc+"/additionalProperties", "additional property %q is not allowed", name)
+			} else {
+				v.validate(additional, value, loc, kwLoc+"/additionalProperties")
+			}
+		}
+	}
+}
+
+// number returns value of provided numeric instance as float64.
+func number(instance interface{}) (float64, bool) {
+	switch n := instance.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// equal reports if two JSON values are equal. Numbers are compared by
+// value, regardless of their representation.
+func equal(a, b interface{}) bool {
+	if na, ok := number(a); ok {
+		nb, ok := number(b)
+		return ok && na == nb
+	}
+	switch a := a.(type) {
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, va := range a {
+			vb, ok := b[k]
+			if !ok || !equal(va, vb) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+var (
+	uuidRegexp     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+)
+
+// validFormat reports if value is valid for provided format. Unknown
+// formats are considered valid.
+func validFormat(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", value)
+		if err != nil {
+			_, err = time.Parse("15:04:05.999999999Z07:00", value)
+		}
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "hostname":
+		return len(value) <= 253 && hostnameRegexp.MatchString(value)
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ".") && !strings.Contains(value, ":")
+	case "ipv6":
+		return net.ParseIP(value) != nil && strings.Contains(value, ":")
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.IsAbs()
+	case "uuid":
+		return uuidRegexp.MatchString(value)
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package limit
+
+import "time"
+
+// aimd adjusts limit using additive increase, multiplicative decrease
+// algorithm.
+type aimd struct {
+	min, max  int
+	threshold time.Duration
+	backoff   float64
+	successes int
+}
+
+// update returns new limit based on result of request that just finished.
+// Limit is decreased when request failed or took longer than threshold and
+// increased by one after limit consecutive successful requests.
+func (a *aimd) update(limit int, failed bool, latency time.Duration) int {
+	if failed || latency > a.threshold {
+		a.successes = 0
+		limit = int(float64(limit) * a.backoff)
+		if limit < a.min {
+			limit = a.min
+		}
+		return limit
+	}
+	a.successes++
+	if a.successes >= limit && limit < a.max {
+		a.successes = 0
+		limit++
+	}
+	return limit
+}
+
+// NewAdaptive creates and returns limiter whose limit starts at initial and
+// adapts to latency of requests, between min and max. Limit is decreased by
+// 10% when request fails or takes longer than latency threshold and
+// increased by one after limit consecutive successful requests.
+func NewAdaptive(initial, min, max, maxQueue int, threshold time.Duration) *Limiter {
+	if min < 1 {
+		min = 1
+	}
+	l := New(initial, maxQueue)
+	l.adaptive = &aimd{
+		min:       min,
+		max:       max,
+		threshold: threshold,
+		backoff:   0.9,
+	}
+	return l
+}
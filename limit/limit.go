@@ -0,0 +1,256 @@
+// Package limit contains middlewares that limit number of concurrent
+// requests (bulkheads).
+//
+// Limiter can be added to gwc.Client or gwc.Group to cap number of requests
+// in flight sent through them. Request is in flight until its response body
+// is closed or read to the end. Requests over the limit wait in bounded
+// queue, ordered by priority, until slot is freed or their context is done.
+// When queue is full, request fails immediately with *QueueFullError.
+package limit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/delicb/cliware"
+)
+
+// QueueFullError is returned when request can not be sent because limit of
+// requests in flight is reached and wait queue is full.
+type QueueFullError struct {
+	Limit int
+	Queue int
+}
+
+// Error is implementation of error interface.
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("limit: %d requests in flight and %d waiting, queue is full", e.Limit, e.Queue)
+}
+
+// waiter is request waiting for free slot.
+type waiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+}
+
+// Limiter limits number of requests in flight.
+type Limiter struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	maxQueue int
+	queue    []*waiter
+	seq      uint64
+	adaptive *aimd
+}
+
+// New creates and returns limiter that allows up to limit requests in flight
+// and up to maxQueue requests waiting for free slot.
+func New(limit, maxQueue int) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		maxQueue: maxQueue,
+	}
+}
+
+// Limit returns current limit of requests in flight.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// InFlight returns number of requests currently in flight.
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Waiting returns number of requests waiting for free slot.
+func (l *Limiter) Waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queue)
+}
+
+// Acquire waits for free slot and returns function that has to be called
+// to free it, with information if request failed (or was too slow). Higher
+// priority requests get free slots first.
+func (l *Limiter) Acquire(ctx context.Context, priority int) (func(failed bool), error) {
+	l.mu.Lock()
+	if l.inFlight < l.limit && len(l.queue) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.releaser(), nil
+	}
+	if len(l.queue) >= l.maxQueue {
+		err := &QueueFullError{Limit: l.limit, Queue: len(l.queue)}
+		l.mu.Unlock()
+		return nil, err
+	}
+	l.seq++
+	w := &waiter{priority: priority, seq: l.seq, ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.releaser(), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-w.ready:
+			// slot was granted while context was being canceled
+			l.inFlight--
+			l.grant()
+		default:
+			l.remove(w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// releaser returns function that frees slot, at most once.
+func (l *Limiter) releaser() func(failed bool) {
+	start := time.Now()
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.inFlight--
+			if l.adaptive != nil {
+				l.limit = l.adaptive.update(l.limit, failed, time.Since(start))
+			}
+			l.grant()
+		})
+	}
+}
+
+// grant gives free slots to waiting requests with highest priority. It has
+// to be called with lock held.
+func (l *Limiter) grant() {
+	for l.inFlight < l.limit && len(l.queue) > 0 {
+		best := 0
+		for i, w := range l.queue {
+			b := l.queue[best]
+			if w.priority > b.priority || (w.priority == b.priority && w.seq < b.seq) {
+				best = i
+			}
+		}
+		w := l.queue[best]
+		l.queue = append(l.queue[:best], l.queue[best+1:]...)
+		l.inFlight++
+		close(w.ready)
+	}
+}
+
+func (l *Limiter) remove(w *waiter) {
+	for i, q := range l.queue {
+		if q == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (l *Limiter) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		release, err := l.Acquire(req.Context(), priorityFromContext(req.Context()))
+		if err != nil {
+			return nil, err
+		}
+		resp, err := next.Handle(req)
+		failed := err != nil || resp == nil || resp.StatusCode >= 500
+		if resp == nil || resp.Body == nil {
+			release(failed)
+			return resp, err
+		}
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { release(failed) }}
+		return resp, err
+	})
+}
+
+// releaseBody is response body that frees slot when it is closed or read to
+// the end.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+type priorityKeyType string
+
+var priorityKey priorityKeyType = "priority"
+
+func priorityFromContext(ctx context.Context) int {
+	p, _ := ctx.Value(priorityKey).(int)
+	return p
+}
+
+// Priority returns middleware that sets priority of request. Requests with
+// higher priority get free slots first. Default priority is 0.
+func Priority(priority int) cliware.Middleware {
+	return cliware.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, priorityKey, priority)
+	})
+}
+
+// PerHost is middleware that limits requests in flight separately for each
+// host. Since it depends on request URL, it should be added to gwc.Client
+// with UsePost.
+type PerHost struct {
+	newLimiter func() *Limiter
+
+	mu       sync.Mutex
+	limiters map[string]*Limiter
+}
+
+// NewPerHost creates and returns PerHost middleware that uses provided
+// function to create limiter for each host.
+func NewPerHost(newLimiter func() *Limiter) *PerHost {
+	return &PerHost{
+		newLimiter: newLimiter,
+		limiters:   make(map[string]*Limiter),
+	}
+}
+
+// Limiter returns limiter for provided host.
+func (p *PerHost) Limiter(host string) *Limiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l, ok := p.limiters[host]
+	if !ok {
+		l = p.newLimiter()
+		p.limiters[host] = l
+	}
+	return l
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (p *PerHost) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return p.Limiter(req.URL.Host).Exec(next).Handle(req)
+	})
+}
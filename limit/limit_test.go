@@ -0,0 +1,144 @@
+package limit_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/limit"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met in time.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiter_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	limiter := limit.New(1, 1)
+	client := gwc.NewForHandler(handler, limiter)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Post().URL("http://service/").Send()
+			if err != nil {
+				t.Error("Got unexpected error:", err)
+				return
+			}
+			resp.Bytes()
+		}()
+	}
+	waitFor(t, func() bool { return limiter.InFlight() == 1 && limiter.Waiting() == 1 })
+
+	_, err := client.Post().URL("http://service/").Send()
+	if _, ok := err.(*limit.QueueFullError); !ok {
+		t.Errorf("Expected QueueFullError, got: %v", err)
+	}
+	close(release)
+	wg.Wait()
+	if limiter.InFlight() != 0 {
+		t.Errorf("Slots not released. In flight: %d", limiter.InFlight())
+	}
+}
+
+func TestLimiter_Priority(t *testing.T) {
+	limiter := limit.New(1, 10)
+	ctx := context.Background()
+	release, err := limiter.Acquire(ctx, 0)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i, p := range []int{1, 5, 3} {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			r, err := limiter.Acquire(ctx, p)
+			if err != nil {
+				t.Error("Got unexpected error:", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, p)
+			mu.Unlock()
+			r(false)
+		}(p)
+		waitFor(t, func() bool { return limiter.Waiting() == i+1 })
+	}
+	release(false)
+	wg.Wait()
+	expected := []int{5, 3, 1}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("Wrong order. Got: %v, expected: %v", order, expected)
+		}
+	}
+}
+
+func TestLimiter_ContextCanceled(t *testing.T) {
+	limiter := limit.New(1, 10)
+	release, _ := limiter.Acquire(context.Background(), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, 0); err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, context.DeadlineExceeded)
+	}
+	if limiter.Waiting() != 0 {
+		t.Error("Canceled request still waiting.")
+	}
+	release(false)
+	if limiter.InFlight() != 0 {
+		t.Errorf("Wrong number of requests in flight: %d", limiter.InFlight())
+	}
+}
+
+func TestPerHost(t *testing.T) {
+	perHost := limit.NewPerHost(func() *limit.Limiter { return limit.New(1, 0) })
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	client := gwc.NewForHandler(handler)
+	client.UsePost(perHost)
+
+	// response body not closed, so slot for host a stays taken
+	if _, err := client.Post().URL("http://a/").Send(); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if _, err := client.Post().URL("http://b/").Send(); err != nil {
+		t.Error("Limit of one host applied to other host:", err)
+	}
+	if _, err := client.Post().URL("http://a/").Send(); err == nil {
+		t.Error("Expected error when host limit is reached.")
+	}
+}
+
+func TestAdaptive(t *testing.T) {
+	limiter := limit.NewAdaptive(10, 2, 20, 0, time.Hour)
+	release, _ := limiter.Acquire(context.Background(), 0)
+	release(true)
+	if limiter.Limit() != 9 {
+		t.Errorf("Limit not decreased on failure. Got: %d, expected: 9", limiter.Limit())
+	}
+	for i := 0; i < 9; i++ {
+		release, _ := limiter.Acquire(context.Background(), 0)
+		release(false)
+	}
+	if limiter.Limit() != 10 {
+		t.Errorf("Limit not increased on success. Got: %d, expected: 10", limiter.Limit())
+	}
+}
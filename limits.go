@@ -0,0 +1,147 @@
+package gwc
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/delicb/cliware"
+)
+
+// CompressionRatioError is returned when compressed response body expands
+// more than allowed, which is common sign of decompression bomb.
+type CompressionRatioError struct {
+	Ratio float64
+}
+
+// Error is implementation of error interface.
+func (e *CompressionRatioError) Error() string {
+	return fmt.Sprintf("gwc: compressed response body expands more than %g times", e.Ratio)
+}
+
+type maxResponseBytesKeyType string
+
+var maxResponseBytesKey maxResponseBytesKeyType = "max-response-bytes"
+
+// MaxResponseBytes returns middleware that limits how many bytes of response
+// body Response.Bytes, Response.String, Response.JSON, Response.XML and
+// Response.SaveToFile read. If body is larger, they return
+// *BodyTooLargeError. It can be used with Client, Group or single Request
+// and last one set wins. Zero or negative value removes the limit.
+func MaxResponseBytes(n int64) cliware.Middleware {
+	return cliware.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, maxResponseBytesKey, n)
+	})
+}
+
+func maxResponseBytesFromContext(ctx context.Context) int64 {
+	n, _ := ctx.Value(maxResponseBytesKey).(int64)
+	return n
+}
+
+type compressionRatioKeyType string
+
+var compressionRatioKey compressionRatioKeyType = "compression-ratio"
+
+// compressionRatioThreshold is number of decompressed bytes after which
+// compression ratio is checked. Small bodies can have high ratio (like
+// JSON with repeated values) without being dangerous.
+const compressionRatioThreshold = 64 << 10
+
+// MaxCompressionRatio returns middleware that limits how much gzip
+// compressed response body can expand. Reading body that is decompressed to
+// more than ratio times its compressed size fails with
+// *CompressionRatioError. Ratio is checked only after first 64KB of body.
+//
+// When limit is set, gwc requests and decompresses gzip content itself,
+// instead of leaving it to http.Transport. Requests that set
+// Accept-Encoding header explicitly are not affected. It can be used with
+// Client, Group or single Request and last one set wins. Zero or negative
+// value removes the limit.
+func MaxCompressionRatio(ratio float64) cliware.Middleware {
+	return cliware.ContextProcessor(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, compressionRatioKey, ratio)
+	})
+}
+
+func compressionRatioFromContext(ctx context.Context) float64 {
+	ratio, _ := ctx.Value(compressionRatioKey).(float64)
+	return ratio
+}
+
+// roundTripGzip sends request asking for gzip content and decompresses
+// response body, failing if it expands more than provided ratio.
+func roundTripGzip(next http.RoundTripper, req *http.Request, ratio float64) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := next.RoundTrip(req)
+	if err != nil || resp.Header.Get("Content-Encoding") != "gzip" {
+		return resp, err
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	resp.Body = &gzipBody{
+		body:  resp.Body,
+		raw:   &countingReader{r: resp.Body},
+		ratio: ratio,
+	}
+	return resp, nil
+}
+
+// wantsGzip returns true if gwc should handle gzip compression of response
+// for provided request, same as http.Transport would.
+func wantsGzip(req *http.Request) bool {
+	return req.Header.Get("Accept-Encoding") == "" &&
+		req.Header.Get("Range") == "" &&
+		req.Method != "HEAD"
+}
+
+// countingReader counts bytes read from underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// gzipBody decompresses response body lazily, on first read, and checks
+// compression ratio while reading.
+type gzipBody struct {
+	body  io.ReadCloser
+	raw   *countingReader
+	ratio float64
+	zr    *gzip.Reader
+	n     int64
+	err   error
+}
+
+func (g *gzipBody) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	if g.zr == nil {
+		g.zr, g.err = gzip.NewReader(g.raw)
+		if g.err != nil {
+			return 0, g.err
+		}
+	}
+	n, err := g.zr.Read(p)
+	g.n += int64(n)
+	if g.n > compressionRatioThreshold && float64(g.n) > g.ratio*float64(g.raw.n) {
+		g.err = &CompressionRatioError{Ratio: g.ratio}
+		return 0, g.err
+	}
+	return n, err
+}
+
+func (g *gzipBody) Close() error {
+	return g.body.Close()
+}
@@ -0,0 +1,199 @@
+package gwc_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/delicb/cliware-middlewares/url"
+
+	"github.com/delicb/gwc"
+)
+
+func bodyHandler(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	body := strings.Repeat("a", 100)
+	client := gwc.NewForHandler(bodyHandler(body))
+	limited := gwc.NewForHandler(bodyHandler(body)).MaxResponseBytes(50)
+
+	for _, data := range []struct {
+		Name  string
+		Req   *gwc.Request
+		Valid bool
+	}{
+		{"no limit", client.Get(), true},
+		{"request limit", client.Get().MaxResponseBytes(50), false},
+		{"request limit equal to size", client.Get().MaxResponseBytes(100), true},
+		{"client limit", limited.Get(), false},
+		{"request overrides client", limited.Get().MaxResponseBytes(200), true},
+	} {
+		resp, err := data.Req.URL("http://service/").Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		got, err := resp.String()
+		if data.Valid {
+			if err != nil {
+				t.Errorf("%s: Got unexpected error: %v", data.Name, err)
+			}
+			if got != body {
+				t.Errorf("%s: Wrong body. Got: %s, expected: %s", data.Name, got, body)
+			}
+			continue
+		}
+		tooLarge, ok := err.(*gwc.BodyTooLargeError)
+		if !ok {
+			t.Errorf("%s: Expected BodyTooLargeError, got: %v", data.Name, err)
+			continue
+		}
+		if tooLarge.Limit != 50 {
+			t.Errorf("%s: Wrong limit. Got: %d, expected: %d", data.Name, tooLarge.Limit, 50)
+		}
+	}
+}
+
+func TestGroup_MaxResponseBytes(t *testing.T) {
+	client := gwc.NewForHandler(bodyHandler(`{"id": 1, "name": "john"}`))
+	group := gwc.NewGroup(client).MaxResponseBytes(10)
+
+	resp, err := group.Do(url.URL("http://service/"))
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	var u schemaUser
+	if _, ok := resp.JSON(&u).(*gwc.BodyTooLargeError); !ok {
+		t.Error("Expected BodyTooLargeError.")
+	}
+}
+
+func TestMaxResponseBytes_XML(t *testing.T) {
+	client := gwc.NewForHandler(bodyHandler(`<user><name>john</name></user>`))
+	var u struct {
+		Name string `xml:"name"`
+	}
+
+	resp, err := client.Get().URL("http://service/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if err := resp.XML(&u); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if u.Name != "john" {
+		t.Errorf("Wrong name. Got: %s, expected: %s", u.Name, "john")
+	}
+
+	resp, err = client.Get().URL("http://service/").MaxResponseBytes(10).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if _, ok := resp.XML(&u).(*gwc.BodyTooLargeError); !ok {
+		t.Error("Expected BodyTooLargeError.")
+	}
+}
+
+func TestMaxResponseBytes_SaveToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwc")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "body")
+	client := gwc.NewForHandler(bodyHandler(strings.Repeat("a", 100)))
+
+	resp, err := client.Get().URL("http://service/").MaxResponseBytes(50).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if _, ok := resp.SaveToFile(filename).(*gwc.BodyTooLargeError); !ok {
+		t.Error("Expected BodyTooLargeError.")
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Error("File with partial body not removed.")
+	}
+
+	resp, err = client.Get().URL("http://service/").MaxResponseBytes(100).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if err := resp.SaveToFile(filename); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	data, _ := ioutil.ReadFile(filename)
+	if len(data) != 100 {
+		t.Errorf("Wrong file size. Got: %d, expected: %d", len(data), 100)
+	}
+}
+
+func gzipHandler(body []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write(body)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(body)
+		zw.Close()
+	})
+}
+
+func TestMaxCompressionRatio(t *testing.T) {
+	// zeros compress roughly 1000 times
+	bomb := make([]byte, 10<<20)
+	client := gwc.NewForHandler(gzipHandler(bomb)).MaxCompressionRatio(100)
+
+	resp, err := client.Get().URL("http://service/").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	_, err = resp.Bytes()
+	ratioErr, ok := err.(*gwc.CompressionRatioError)
+	if !ok {
+		t.Fatalf("Expected CompressionRatioError, got: %v", err)
+	}
+	if ratioErr.Ratio != 100 {
+		t.Errorf("Wrong ratio. Got: %g, expected: %g", ratioErr.Ratio, 100.0)
+	}
+
+	resp, err = client.Get().URL("http://service/").MaxCompressionRatio(2000).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	data, err := resp.Bytes()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if !bytes.Equal(data, bomb) {
+		t.Error("Wrong decompressed body.")
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Error("Content-Encoding header not removed.")
+	}
+}
+
+func TestMaxCompressionRatio_ExplicitAcceptEncoding(t *testing.T) {
+	client := gwc.NewForHandler(gzipHandler([]byte("hello"))).MaxCompressionRatio(100)
+
+	resp, err := client.Get().URL("http://service/").SetHeader("Accept-Encoding", "identity").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	got, err := resp.String()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if got != "hello" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", got, "hello")
+	}
+}
@@ -0,0 +1,901 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Config configures code generation.
+type Config struct {
+	// Package is name of package of generated code.
+	Package string
+}
+
+// Generate generates Go source of client for API described by provided
+// document.
+//
+// Generated code contains types for all schemas from document, Client with
+// one gwc.Group for each operation tag and method that builds *gwc.Request
+// for each operation. Security schemes are generated as functions that
+// return authentication middlewares, which are set to Client.Security and
+// used by operations that require them.
+func Generate(doc *Document, cfg Config) ([]byte, error) {
+	if cfg.Package == "" {
+		cfg.Package = "client"
+	}
+	g := &generator{
+		doc:     doc,
+		imports: make(map[string]string),
+		types:   make(map[string]string),
+	}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		if s := doc.Components.Schemas[name]; s != nil && doc.Schema(s) == nil {
+			return nil, fmt.Errorf("openapi: schema %q: reference %s can not be resolved", name, s.Ref)
+		}
+		g.declare(goName(name), doc.Components.Schemas[name], fmt.Sprintf("schema %q", name))
+	}
+	if err := g.client(); err != nil {
+		return nil, err
+	}
+	g.security()
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gwc-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "// Package %s is client for %s API", cfg.Package, doc.Info.Title)
+	if doc.Info.Version != "" {
+		fmt.Fprintf(&out, " (version %s)", doc.Info.Version)
+	}
+	fmt.Fprintf(&out, ".\npackage %s\n\n", cfg.Package)
+	g.writeImports(&out)
+	for _, name := range sortedKeys(g.types) {
+		out.WriteString(g.types[name])
+	}
+	out.Write(g.buf.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("openapi: generated invalid code: %v", err)
+	}
+	return src, nil
+}
+
+type generator struct {
+	doc *Document
+	// imports maps import path to its alias
+	imports map[string]string
+	// types maps names of generated types to their declarations
+	types map[string]string
+	buf   bytes.Buffer
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+func (g *generator) use(path, alias string) {
+	g.imports[path] = alias
+}
+
+func (g *generator) writeImports(out *bytes.Buffer) {
+	var std, other []string
+	for _, path := range sortedKeys(g.imports) {
+		line := strconv.Quote(path)
+		if alias := g.imports[path]; alias != "" {
+			line = alias + " " + line
+		}
+		if strings.Contains(path, ".") {
+			other = append(other, line)
+		} else {
+			std = append(std, line)
+		}
+	}
+	out.WriteString("import (\n")
+	for _, l := range std {
+		out.WriteString("\t" + l + "\n")
+	}
+	if len(std) > 0 && len(other) > 0 {
+		out.WriteString("\n")
+	}
+	for _, l := range other {
+		out.WriteString("\t" + l + "\n")
+	}
+	out.WriteString(")\n\n")
+}
+
+// Types
+
+// goType returns Go type for provided schema. Schemas that need their own
+// type (objects, enums and unions) are declared with provided name.
+func (g *generator) goType(s *Schema, name string) string {
+	if s == nil {
+		return "interface{}"
+	}
+	if s.Ref != "" {
+		return goName(refName(s.Ref))
+	}
+	if needsDeclaration(s) {
+		g.declare(name, s, "inline schema")
+		return name
+	}
+	switch s.PrimaryType() {
+	case "array":
+		return "[]" + g.goType(s.Items, name+"Item")
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + g.goType(s.AdditionalProperties, name+"Value")
+		}
+		return "map[string]interface{}"
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.use("time", "")
+			return "time.Time"
+		case "byte":
+			return "[]byte"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		if s.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	}
+	return "interface{}"
+}
+
+func needsDeclaration(s *Schema) bool {
+	return len(s.Enum) > 0 || len(s.OneOf) > 0 || len(s.AnyOf) > 0 || len(s.AllOf) > 0 || len(s.Properties) > 0
+}
+
+// isStruct reports if Go type generated for schema is struct.
+func (g *generator) isStruct(s *Schema) bool {
+	s = g.doc.Schema(s)
+	return s != nil && len(s.Enum) == 0 && len(s.OneOf) == 0 && len(s.AnyOf) == 0 &&
+		(len(s.AllOf) > 0 || len(s.Properties) > 0)
+}
+
+// declare generates declaration of type with provided name for schema.
+func (g *generator) declare(name string, s *Schema, source string) {
+	if _, ok := g.types[name]; ok {
+		return
+	}
+	// reserve name first, so recursive schemas do not declare it again
+	g.types[name] = ""
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s is generated from %s.\n", name, source)
+	writeDescription(&b, s.Description, true)
+	switch {
+	case len(s.Enum) > 0:
+		g.enum(&b, name, s)
+	case len(s.OneOf) > 0 || len(s.AnyOf) > 0:
+		g.union(&b, name, s)
+	case len(s.AllOf) > 0 || len(s.Properties) > 0:
+		g.structure(&b, name, s)
+	default:
+		fmt.Fprintf(&b, "type %s %s\n\n", name, g.goType(s, name))
+	}
+	g.types[name] = b.String()
+}
+
+func (g *generator) enum(b *bytes.Buffer, name string, s *Schema) {
+	base := "string"
+	switch s.PrimaryType() {
+	case "integer":
+		base = "int64"
+	case "number":
+		base = "float64"
+	}
+	fmt.Fprintf(b, "type %s %s\n\n", name, base)
+	fmt.Fprintf(b, "// Values of %s.\nconst (\n", name)
+	for _, v := range s.Enum {
+		if v == nil {
+			continue
+		}
+		constName := name + goName(fmt.Sprint(v))
+		if fmt.Sprint(v) == "" {
+			constName = name + "Empty"
+		}
+		literal := fmt.Sprint(v)
+		if str, ok := v.(string); ok {
+			literal = strconv.Quote(str)
+		}
+		fmt.Fprintf(b, "\t%s %s = %s\n", constName, name, literal)
+	}
+	b.WriteString(")\n\n")
+}
+
+func (g *generator) union(b *bytes.Buffer, name string, s *Schema) {
+	g.use("encoding/json", "")
+	fmt.Fprintf(b, "//\n// It holds raw JSON of one of its variants, which can be decoded with As\n")
+	fmt.Fprintf(b, "// methods.\ntype %s struct {\n\tjson.RawMessage\n}\n\n", name)
+
+	variants := s.OneOf
+	if len(variants) == 0 {
+		variants = s.AnyOf
+	}
+	seen := make(map[string]bool)
+	for i, v := range variants {
+		var typ, variant string
+		switch {
+		case v.Ref != "":
+			typ = goName(refName(v.Ref))
+			variant = typ
+		case needsDeclaration(v):
+			typ = fmt.Sprintf("%sVariant%d", name, i+1)
+			g.declare(typ, v, fmt.Sprintf("variant of %s", name))
+			variant = typ
+		default:
+			typ = g.goType(v, fmt.Sprintf("%sVariant%d", name, i+1))
+			variant = goName(v.PrimaryType())
+			if strings.HasPrefix(typ, "[]") {
+				variant += "List"
+			}
+		}
+		if seen[variant] {
+			continue
+		}
+		seen[variant] = true
+		fmt.Fprintf(b, "// As%s decodes %s as %s.\n", variant, name, typ)
+		fmt.Fprintf(b, "func (u %s) As%s() (%s, error) {\n", name, variant, typ)
+		fmt.Fprintf(b, "\tvar v %s\n\terr := json.Unmarshal(u.RawMessage, &v)\n\treturn v, err\n}\n\n", typ)
+		fmt.Fprintf(b, "// %sFrom%s creates %s from %s.\n", name, variant, name, typ)
+		fmt.Fprintf(b, "func %sFrom%s(v %s) (%s, error) {\n", name, variant, typ, name)
+		fmt.Fprintf(b, "\tdata, err := json.Marshal(v)\n\treturn %s{RawMessage: data}, err\n}\n\n", name)
+	}
+
+	if s.Discriminator != nil && s.Discriminator.PropertyName != "" {
+		prop := s.Discriminator.PropertyName
+		fmt.Fprintf(b, "// Discriminator returns value of %q property, which tells which variant\n", prop)
+		fmt.Fprintf(b, "// %s holds.\n", name)
+		fmt.Fprintf(b, "func (u %s) Discriminator() (string, error) {\n", name)
+		fmt.Fprintf(b, "\tvar v struct {\n\t\tValue string `json:%q`\n\t}\n", prop)
+		b.WriteString("\terr := json.Unmarshal(u.RawMessage, &v)\n\treturn v.Value, err\n}\n\n")
+	}
+}
+
+func (g *generator) structure(b *bytes.Buffer, name string, s *Schema) {
+	properties := make(map[string]*Schema)
+	required := make(map[string]bool)
+	var embedded []string
+	for _, part := range append([]*Schema{s}, s.AllOf...) {
+		if part != s && part.Ref != "" {
+			embedded = append(embedded, goName(refName(part.Ref)))
+			continue
+		}
+		for n, p := range part.Properties {
+			properties[n] = p
+		}
+		for _, r := range part.Required {
+			required[r] = true
+		}
+	}
+
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, e := range embedded {
+		fmt.Fprintf(b, "\t%s\n", e)
+	}
+	for _, prop := range sortedKeys(properties) {
+		ps := properties[prop]
+		field := goName(prop)
+		typ := g.goType(ps, name+field)
+		tag := prop
+		if !required[prop] {
+			tag += ",omitempty"
+		}
+		if g.isStruct(ps) && (!required[prop] || typ == name) {
+			typ = "*" + typ
+		}
+		if typ == "time.Time" && !required[prop] {
+			// zero time is not empty, so only pointer is omitted
+			typ = "*" + typ
+		}
+		writeDescription(b, ps.Description, false)
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", field, typ, tag)
+	}
+	b.WriteString("}\n\n")
+}
+
+// Client
+
+// group is generated gwc.Group that holds operations with same tag.
+type group struct {
+	name string
+	tag  string
+	ops  []*OperationInfo
+}
+
+func (g *generator) client() error {
+	groups := make(map[string]*group)
+	for _, op := range g.doc.Operations() {
+		tag := "default"
+		if len(op.Operation.Tags) > 0 {
+			tag = op.Operation.Tags[0]
+		}
+		name := goName(tag)
+		if groups[name] == nil {
+			groups[name] = &group{name: name, tag: tag}
+		}
+		groups[name].ops = append(groups[name].ops, op)
+	}
+	names := sortedKeys(groups)
+
+	g.use("strings", "")
+	g.use("github.com/delicb/cliware", "")
+	g.use("github.com/delicb/gwc", "")
+
+	if len(g.doc.Servers) > 0 {
+		g.p("// ServerURL is URL of first server from API description.")
+		g.p("const ServerURL = %q\n", g.doc.Servers[0].URL)
+	}
+	g.p("// Client is client for %s API. Its operations are grouped by tags.", g.doc.Info.Title)
+	hasSecurity := len(g.doc.Components.SecuritySchemes) > 0
+	g.p("type Client struct {")
+	for _, n := range names {
+		g.p("%s *%sAPI", n, n)
+	}
+	if hasSecurity {
+		g.p("// Security holds middlewares used by operations that require")
+		g.p("// authentication.")
+		g.p("Security *Security")
+	}
+	g.p("}\n")
+	g.p("// NewClient creates and returns client that sends requests with provided gwc")
+	g.p("// client to API at provided server URL. Provided middlewares are used for all")
+	g.p("// operations, and additional ones can be added to each group.")
+	g.p("func NewClient(client *gwc.Client, serverURL string, middlewares ...cliware.Middleware) *Client {")
+	g.p("serverURL = strings.TrimSuffix(serverURL, \"/\")")
+	security := ""
+	if hasSecurity {
+		g.p("security := &Security{}")
+		security = ", security: security"
+	}
+	g.p("return &Client{")
+	for _, n := range names {
+		g.p("%s: &%sAPI{Group: gwc.NewGroup(client, middlewares...), client: client, serverURL: serverURL%s},", n, n, security)
+	}
+	if hasSecurity {
+		g.p("Security: security,")
+	}
+	g.p("}")
+	g.p("}\n")
+
+	for _, n := range names {
+		grp := groups[n]
+		g.p("// %sAPI groups operations with tag %q.", grp.name, grp.tag)
+		g.p("type %sAPI struct {", grp.name)
+		g.p("*gwc.Group")
+		g.p("client *gwc.Client")
+		g.p("serverURL string")
+		if hasSecurity {
+			g.p("security *Security")
+		}
+		g.p("}\n")
+		for _, op := range grp.ops {
+			if err := g.operation(grp, op); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// param is generated argument of operation method.
+type param struct {
+	*Parameter
+	field    string
+	typ      string
+	optional bool
+}
+
+// value returns expression that converts provided expression of param type
+// to string.
+func (g *generator) value(expr, typ string) string {
+	switch typ {
+	case "string":
+		return expr
+	case "time.Time":
+		if strings.HasPrefix(expr, "*") {
+			expr = "(" + expr + ")"
+		}
+		return expr + ".Format(time.RFC3339)"
+	}
+	g.use("fmt", "")
+	return "fmt.Sprint(" + expr + ")"
+}
+
+// bodyKind describes how request body of one media type is sent.
+type bodyKind struct {
+	suffix string
+	typ    string
+	set    string
+}
+
+func (g *generator) bodyKind(mediaType string, schema *Schema, opName string) (int, bodyKind) {
+	base := mediaType
+	if i := strings.Index(base, ";"); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	switch {
+	case base == "application/json" || strings.HasSuffix(base, "+json"):
+		return 0, bodyKind{typ: g.goType(schema, opName+"Body"), set: "r.BodyJSON(body)"}
+	case base == "application/x-www-form-urlencoded":
+		g.use("net/url", "")
+		g.use("github.com/delicb/cliware-middlewares/body", "cwbody")
+		return 1, bodyKind{suffix: "Form", typ: "url.Values",
+			set: fmt.Sprintf("r.Use(cwbody.String(body.Encode())).SetHeader(\"Content-Type\", %q)", mediaType)}
+	case base == "application/xml" || base == "text/xml" || strings.HasSuffix(base, "+xml"):
+		g.use("github.com/delicb/cliware-middlewares/body", "cwbody")
+		return 2, bodyKind{suffix: "XML", typ: g.goType(schema, opName+"Body"),
+			set: fmt.Sprintf("r.Use(cwbody.XML(body)).SetHeader(\"Content-Type\", %q)", mediaType)}
+	case strings.HasPrefix(base, "text/"):
+		g.use("github.com/delicb/cliware-middlewares/body", "cwbody")
+		return 3, bodyKind{suffix: "Text", typ: "string",
+			set: fmt.Sprintf("r.Use(cwbody.String(body)).SetHeader(\"Content-Type\", %q)", mediaType)}
+	}
+	g.use("io", "")
+	g.use("github.com/delicb/cliware-middlewares/body", "cwbody")
+	return 4, bodyKind{suffix: "Raw", typ: "io.Reader",
+		set: fmt.Sprintf("r.Use(cwbody.Reader(body)).SetHeader(\"Content-Type\", %q)", mediaType)}
+}
+
+func (g *generator) operation(grp *group, info *OperationInfo) error {
+	op := info.Operation
+	name := goName(op.OperationID)
+	if op.OperationID == "" {
+		name = goName(strings.ToLower(info.Method) + " " + info.Path)
+	}
+
+	// arguments: path parameters, then params struct, then body
+	var args []string
+	var pathParams, otherParams []param
+	used := map[string]bool{"a": true, "r": true, "params": true, "body": true}
+	for _, p := range info.Parameters {
+		pp := param{Parameter: p, field: goName(p.Name)}
+		pp.typ = g.goType(p.Schema, name+pp.field)
+		if p.In == "path" {
+			arg := argName(p.Name, used)
+			args = append(args, arg+" "+pp.typ)
+			pp.field = arg
+			pathParams = append(pathParams, pp)
+			continue
+		}
+		if !p.Required && !strings.HasPrefix(pp.typ, "[]") && !strings.HasPrefix(pp.typ, "map[") {
+			pp.optional = true
+		}
+		otherParams = append(otherParams, pp)
+	}
+	if len(otherParams) > 0 {
+		args = append(args, fmt.Sprintf("params *%sParams", name))
+		g.params(name, otherParams)
+	}
+
+	bodies := map[int]bodyKind{}
+	if rb := g.doc.RequestBody(op.RequestBody); rb != nil {
+		for _, mt := range sortedKeys(rb.Content) {
+			kind, b := g.bodyKind(mt, rb.Content[mt].Schema, name)
+			if _, ok := bodies[kind]; !ok {
+				bodies[kind] = b
+			}
+		}
+	}
+	respType := g.responseType(name, op)
+	if err := g.pagination(name, op, otherParams, respType); err != nil {
+		return err
+	}
+
+	// path parameters are escaped and concatenated with literal parts of path
+	path := "a.serverURL + " + strconv.Quote(info.Path)
+	for _, p := range pathParams {
+		g.use("net/url", "")
+		value := "url.PathEscape(" + g.value(p.field, p.typ) + ")"
+		path = strings.Replace(path, "{"+p.Name+"}", `" + `+value+` + "`, -1)
+	}
+	path = strings.Replace(path, ` + ""`, "", -1)
+
+	write := func(suffix string, body *bodyKind) {
+		methodArgs := args
+		if body != nil {
+			methodArgs = append(methodArgs, "body "+body.typ)
+		}
+		g.p("// %s%s returns request for %s %s.", name, suffix, info.Method, info.Path)
+		writeDescription(&g.buf, op.Summary, true)
+		writeDescription(&g.buf, op.Description, true)
+		if respType != "" {
+			g.p("//\n// Body of successful response is %s.", respType)
+		}
+		if req := g.securityNames(op); req != "" && g.securityOptional(op) {
+			g.p("//\n// Optionally uses %s security.", req)
+		} else if req != "" {
+			g.p("//\n// Requires %s security.", req)
+		}
+		if op.Deprecated {
+			g.p("//\n// Deprecated: operation is deprecated by API.")
+		}
+		g.p("func (a *%s) %s%s(%s) *gwc.Request {", grp.name+"API", name, suffix, strings.Join(methodArgs, ", "))
+		g.p("r := a.client.Request().Use(a.Group).Method(%q).URL(%s)", info.Method, path)
+		if reqs := g.securityRequirements(op); reqs != "" {
+			g.p("a.security.apply(r%s)", reqs)
+		}
+		if len(otherParams) > 0 {
+			g.p("if params != nil {")
+			for _, p := range otherParams {
+				g.setParam(p)
+			}
+			g.p("}")
+		}
+		if body != nil {
+			g.p(body.set)
+		}
+		g.p("return r")
+		g.p("}\n")
+	}
+
+	if len(bodies) == 0 {
+		write("", nil)
+		return nil
+	}
+	first := true
+	for kind := 0; kind <= 4; kind++ {
+		b, ok := bodies[kind]
+		if !ok {
+			continue
+		}
+		suffix := b.suffix
+		if first {
+			suffix = ""
+			first = false
+		}
+		write(suffix, &b)
+	}
+	return nil
+}
+
+// params declares struct with query, header and cookie parameters of
+// operation.
+func (g *generator) params(name string, params []param) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %sParams holds query, header and cookie parameters of %s.\n", name, name)
+	fmt.Fprintf(&b, "type %sParams struct {\n", name)
+	for _, p := range params {
+		writeDescription(&b, p.Description, false)
+		typ := p.typ
+		if p.optional {
+			typ = "*" + typ
+		}
+		fmt.Fprintf(&b, "\t%s %s\n", p.field, typ)
+	}
+	b.WriteString("}\n\n")
+	g.types[name+"Params"] = b.String()
+}
+
+func (g *generator) setParam(p param) {
+	setter := map[string]string{"query": "SetQuery", "header": "SetHeader", "cookie": "SetCookie"}[p.In]
+	adder := map[string]string{"query": "AddQuery", "header": "AddHeader", "cookie": "SetCookie"}[p.In]
+	field := "params." + p.field
+	switch {
+	case p.optional:
+		g.p("if %s != nil {", field)
+		g.p("r.%s(%q, %s)", setter, p.Name, g.value("*"+field, p.typ))
+		g.p("}")
+	case strings.HasPrefix(p.typ, "[]"):
+		g.p("for _, v := range %s {", field)
+		g.p("r.%s(%q, %s)", adder, p.Name, g.value("v", p.typ[2:]))
+		g.p("}")
+	default:
+		g.p("r.%s(%q, %s)", setter, p.Name, g.value(field, p.typ))
+	}
+}
+
+// responseType returns type of body of first successful response of
+// operation with JSON content, or empty string if there is none.
+func (g *generator) responseType(name string, op *Operation) string {
+	for _, code := range sortedKeys(op.Responses) {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		resp := g.doc.Response(op.Responses[code])
+		if resp == nil {
+			continue
+		}
+		for _, mt := range sortedKeys(resp.Content) {
+			if mt == "application/json" || strings.HasSuffix(mt, "+json") {
+				return g.goType(resp.Content[mt].Schema, name+"Response")
+			}
+		}
+	}
+	return ""
+}
+
+// pagination generates NextPage method for params of paginated operation.
+func (g *generator) pagination(name string, op *Operation, params []param, respType string) error {
+	pg := op.Pagination
+	if pg == nil {
+		return nil
+	}
+	var cursor *param
+	for i := range params {
+		if params[i].In == "query" && params[i].Name == pg.CursorParam {
+			cursor = &params[i]
+		}
+	}
+	if cursor == nil || cursor.typ != "string" {
+		return fmt.Errorf("openapi: operation %s: pagination cursor has to be string query parameter", name)
+	}
+	var resp *Schema
+	for _, code := range sortedKeys(op.Responses) {
+		if r := g.doc.Response(op.Responses[code]); r != nil && strings.HasPrefix(code, "2") && r.Content["application/json"] != nil {
+			resp = g.doc.Schema(r.Content["application/json"].Schema)
+			break
+		}
+	}
+	var nextCursor *Schema
+	if resp != nil {
+		nextCursor = g.doc.Schema(resp.Properties[pg.NextCursor])
+	}
+	if nextCursor == nil || nextCursor.PrimaryType() != "string" {
+		return fmt.Errorf("openapi: operation %s: pagination next cursor has to be string property of response", name)
+	}
+
+	next := goName(pg.NextCursor)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// NextPage sets cursor of next page from provided response to params and\n")
+	fmt.Fprintf(&b, "// reports if there is next page.\n")
+	fmt.Fprintf(&b, "func (p *%sParams) NextPage(resp *%s) bool {\n", name, respType)
+	fmt.Fprintf(&b, "\tif resp.%s == \"\" {\n\t\treturn false\n\t}\n", next)
+	if cursor.optional {
+		fmt.Fprintf(&b, "\tcursor := resp.%s\n\tp.%s = &cursor\n", next, cursor.field)
+	} else {
+		fmt.Fprintf(&b, "\tp.%s = resp.%s\n", cursor.field, next)
+	}
+	b.WriteString("\treturn true\n}\n\n")
+	g.types[name+"Params.NextPage"] = b.String()
+	return nil
+}
+
+// Security
+
+// securityName returns name of function generated for security scheme.
+func securityName(scheme string) string {
+	name := goName(scheme)
+	if !strings.HasSuffix(name, "Auth") {
+		name += "Auth"
+	}
+	return name
+}
+
+// securityNames returns description of security requirements of operation.
+func (g *generator) securityNames(op *Operation) string {
+	var alternatives []string
+	for _, names := range g.securitySchemes(op) {
+		alternatives = append(alternatives, strings.Join(names, " and "))
+	}
+	return strings.Join(alternatives, " or ")
+}
+
+// securitySchemes returns names of functions generated for schemes of each
+// security requirement of operation. Empty requirements, which make
+// security optional, and requirements with undefined schemes are skipped.
+func (g *generator) securitySchemes(op *Operation) [][]string {
+	reqs := g.doc.Security
+	if op.Security != nil {
+		reqs = op.Security
+	}
+	var schemes [][]string
+	for _, req := range reqs {
+		var names []string
+		for _, n := range sortedKeys(req) {
+			if g.doc.Components.SecuritySchemes[n] == nil {
+				names = nil
+				break
+			}
+			names = append(names, securityName(n))
+		}
+		if len(names) > 0 {
+			schemes = append(schemes, names)
+		}
+	}
+	return schemes
+}
+
+// securityOptional reports if operation has empty security requirement,
+// which means it can be sent without authentication.
+func (g *generator) securityOptional(op *Operation) bool {
+	reqs := g.doc.Security
+	if op.Security != nil {
+		reqs = op.Security
+	}
+	for _, req := range reqs {
+		if len(req) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// securityRequirements returns arguments of Security.apply for security
+// requirements of operation, or empty string if operation does not use
+// security.
+func (g *generator) securityRequirements(op *Operation) string {
+	var args string
+	for _, names := range g.securitySchemes(op) {
+		fields := make([]string, len(names))
+		for i, n := range names {
+			fields[i] = "a.security." + n
+		}
+		args += ", []cliware.Middleware{" + strings.Join(fields, ", ") + "}"
+	}
+	return args
+}
+
+func (g *generator) security() {
+	schemes := sortedKeys(g.doc.Components.SecuritySchemes)
+	if len(schemes) == 0 {
+		return
+	}
+	g.p("// Security holds middlewares that authenticate requests with security")
+	g.p("// schemes of API, created with functions below. Operation uses first of its")
+	g.p("// security requirements whose middlewares are all set.")
+	g.p("type Security struct {")
+	for _, n := range schemes {
+		g.p("%s cliware.Middleware", securityName(n))
+	}
+	g.p("}\n")
+	g.p("// apply adds middlewares of first provided security requirement whose")
+	g.p("// middlewares are all set to request. If there is no such requirement,")
+	g.p("// request is sent without authentication.")
+	g.p("func (s *Security) apply(r *gwc.Request, requirements ...[]cliware.Middleware) {")
+	g.p("for _, req := range requirements {")
+	g.p("satisfied := true")
+	g.p("for _, m := range req {")
+	g.p("satisfied = satisfied && m != nil")
+	g.p("}")
+	g.p("if satisfied {")
+	g.p("r.Use(req...)")
+	g.p("return")
+	g.p("}")
+	g.p("}")
+	g.p("}\n")
+	for _, n := range schemes {
+		s := g.doc.Components.SecuritySchemes[n]
+		name := securityName(n)
+		var args, body string
+		switch {
+		case s.Type == "http" && strings.EqualFold(s.Scheme, "basic"):
+			g.use("github.com/delicb/cliware-middlewares/auth", "")
+			args, body = "username, password string", "auth.Basic(username, password)"
+		case s.Type == "http" && !strings.EqualFold(s.Scheme, "bearer"):
+			g.use("github.com/delicb/cliware-middlewares/auth", "")
+			args, body = "credentials string", fmt.Sprintf("auth.Custom(%q + credentials)", s.Scheme+" ")
+		case s.Type == "apiKey" && s.In == "header":
+			g.use("github.com/delicb/cliware-middlewares/headers", "")
+			args, body = "key string", fmt.Sprintf("headers.Set(%q, key)", s.Name)
+		case s.Type == "apiKey" && s.In == "query":
+			g.use("github.com/delicb/cliware-middlewares/query", "")
+			args, body = "key string", fmt.Sprintf("query.Set(%q, key)", s.Name)
+		case s.Type == "apiKey" && s.In == "cookie":
+			g.use("github.com/delicb/cliware-middlewares/cookies", "")
+			args, body = "key string", fmt.Sprintf("cookies.Set(%q, key)", s.Name)
+		default:
+			// http bearer, oauth2 and openIdConnect all send bearer token
+			g.use("github.com/delicb/cliware-middlewares/auth", "")
+			args, body = "token string", "auth.Bearer(token)"
+		}
+		g.p("// %s returns middleware that authenticates requests with %q", name, n)
+		g.p("// security scheme.")
+		g.p("func %s(%s) cliware.Middleware {", name, args)
+		g.p("return %s", body)
+		g.p("}\n")
+	}
+}
+
+// Names
+
+var initialisms = map[string]string{
+	"api": "API", "http": "HTTP", "id": "ID", "ip": "IP", "json": "JSON",
+	"uri": "URI", "url": "URL", "uuid": "UUID", "xml": "XML",
+}
+
+// words splits identifier into words, on non alphanumeric characters and
+// on lower to upper case transitions.
+func words(s string) []string {
+	var result []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			result = append(result, string(current))
+			current = nil
+		}
+	}
+	var prev rune
+	for _, r := range s {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+		prev = r
+	}
+	flush()
+	return result
+}
+
+// goName returns exported Go identifier for provided name.
+func goName(s string) string {
+	var b strings.Builder
+	for _, w := range words(s) {
+		if up, ok := initialisms[strings.ToLower(w)]; ok {
+			b.WriteString(up)
+			continue
+		}
+		r := []rune(w)
+		b.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// argName returns unexported Go identifier for provided name, that is not
+// keyword nor already used.
+func argName(s string, used map[string]bool) string {
+	ws := words(s)
+	name := "arg"
+	if len(ws) > 0 {
+		name = strings.ToLower(ws[0]) + strings.TrimPrefix(goName(s), goName(ws[0]))
+	}
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "arg" + name
+	}
+	for token.IsKeyword(name) || used[name] {
+		name += "Param"
+	}
+	used[name] = true
+	return name
+}
+
+// writeDescription writes description as comment. If separate is true,
+// empty comment line is written before it.
+func writeDescription(b *bytes.Buffer, description string, separate bool) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return
+	}
+	if separate {
+		b.WriteString("//\n")
+	}
+	for _, line := range strings.Split(description, "\n") {
+		b.WriteString(strings.TrimRight("// "+line, " ") + "\n")
+	}
+}
+
+// sortedKeys returns sorted keys of provided map with string keys.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,108 @@
+package openapi_test
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/delicb/gwc/openapi"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestGenerate_Golden(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		t.Run(name, func(t *testing.T) {
+			doc, err := openapi.Load(file)
+			if err != nil {
+				t.Fatal("Got unexpected error:", err)
+			}
+			src, err := openapi.Generate(doc, openapi.Config{Package: name})
+			if err != nil {
+				t.Fatal("Got unexpected error:", err)
+			}
+			golden := filepath.Join("testdata", name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+					t.Fatal("Got unexpected error:", err)
+				}
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal("Got unexpected error:", err)
+			}
+			if !bytes.Equal(src, expected) {
+				t.Errorf("Generated code differs from %s, run tests with -update to see the difference.", golden)
+			}
+		})
+	}
+}
+
+// TestGenerate_Build checks that generated golden files compile, by vetting
+// them as packages of this module.
+func TestGenerate_Build(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Building generated code skipped in short mode.")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("Go tool not found.")
+	}
+	files, err := filepath.Glob("testdata/*.golden")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	// directory starting with underscore is ignored by ./... patterns
+	dir, err := ioutil.TempDir(".", "_build")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+	var packages []string
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".golden")
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		pkg := filepath.Join(dir, name)
+		if err := os.Mkdir(pkg, 0755); err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pkg, name+".go"), src, 0644); err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		packages = append(packages, "./"+filepath.ToSlash(pkg))
+	}
+	out, err := exec.Command(goTool, append([]string{"vet"}, packages...)...).CombinedOutput()
+	if err != nil {
+		t.Errorf("Generated code does not compile: %v\n%s", err, out)
+	}
+}
+
+func TestGenerate_InvalidPagination(t *testing.T) {
+	doc, err := openapi.Parse([]byte(`{
+		"openapi": "3.0.3",
+		"paths": {"/items": {"get": {
+			"operationId": "list",
+			"x-pagination": {"cursorParam": "cursor", "nextCursor": "next"},
+			"responses": {"200": {"description": "OK"}}
+		}}}
+	}`))
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if _, err := openapi.Generate(doc, openapi.Config{}); err == nil {
+		t.Error("Expected error for pagination without cursor parameter.")
+	}
+}
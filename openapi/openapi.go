@@ -0,0 +1,359 @@
+// Package openapi reads OpenAPI 3.0 and 3.1 documents, generates gwc
+// clients from them and validates requests and responses against them.
+//
+// Only documents in JSON format are supported. YAML documents can be
+// converted to JSON with any YAML tool before use.
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// Document is OpenAPI document.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers"`
+	Paths      map[string]*PathItem  `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security"`
+
+	// raw is decoded JSON of document, used for validation
+	raw interface{}
+}
+
+// Info holds metadata about API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// Server is server that hosts API.
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+// Components holds reusable objects of document.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	Parameters      map[string]*Parameter      `json:"parameters"`
+	RequestBodies   map[string]*RequestBody    `json:"requestBodies"`
+	Responses       map[string]*Response       `json:"responses"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityRequirement maps names of security schemes to required scopes.
+type SecurityRequirement map[string][]string
+
+// PathItem describes operations available on single path.
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Put        *Operation   `json:"put"`
+	Post       *Operation   `json:"post"`
+	Delete     *Operation   `json:"delete"`
+	Options    *Operation   `json:"options"`
+	Head       *Operation   `json:"head"`
+	Patch      *Operation   `json:"patch"`
+	Trace      *Operation   `json:"trace"`
+}
+
+// Operation describes single API operation on a path.
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description"`
+	Tags        []string              `json:"tags"`
+	Parameters  []*Parameter          `json:"parameters"`
+	RequestBody *RequestBody          `json:"requestBody"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security"`
+	Deprecated  bool                  `json:"deprecated"`
+	// Pagination is pagination hint, set with "x-pagination" extension.
+	Pagination *Pagination `json:"x-pagination"`
+}
+
+// Pagination describes cursor based pagination of operation. CursorParam is
+// name of query parameter that holds cursor and NextCursor is name of
+// response body property that holds cursor of next page.
+type Pagination struct {
+	CursorParam string `json:"cursorParam"`
+	NextCursor  string `json:"nextCursor"`
+}
+
+// Parameter describes single operation parameter.
+type Parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes body of request.
+type RequestBody struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Required    bool                  `json:"required"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// Response describes single response of operation.
+type Response struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Headers     map[string]*Parameter `json:"headers"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// MediaType holds schema of body with single media type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// SecurityScheme describes security scheme that API uses.
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description"`
+	Name         string `json:"name"`
+	In           string `json:"in"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat"`
+}
+
+// Types is list of schema types. In OpenAPI 3.0 schema has single type,
+// while in 3.1 it can have multiple.
+type Types []string
+
+// UnmarshalJSON is implementation of json.Unmarshaler interface.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+	return nil
+}
+
+// Schema describes data type.
+type Schema struct {
+	Ref         string             `json:"$ref"`
+	Type        Types              `json:"type"`
+	Format      string             `json:"format"`
+	Description string             `json:"description"`
+	Enum        []interface{}      `json:"enum"`
+	Properties  map[string]*Schema `json:"properties"`
+	Required    []string           `json:"required"`
+	Items       *Schema            `json:"items"`
+	OneOf       []*Schema          `json:"oneOf"`
+	AnyOf       []*Schema          `json:"anyOf"`
+	AllOf       []*Schema          `json:"allOf"`
+	Nullable    bool               `json:"nullable"`
+	// AdditionalProperties is schema of additional properties of object,
+	// if there is one.
+	AdditionalProperties *Schema        `json:"-"`
+	Discriminator        *Discriminator `json:"discriminator"`
+}
+
+// Discriminator describes property that selects schema of oneOf or anyOf.
+type Discriminator struct {
+	PropertyName string            `json:"propertyName"`
+	Mapping      map[string]string `json:"mapping"`
+}
+
+// UnmarshalJSON is implementation of json.Unmarshaler interface.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type schema Schema
+	var raw struct {
+		schema
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Schema(raw.schema)
+	// additionalProperties can be boolean as well, which does not affect
+	// generated types
+	if len(raw.AdditionalProperties) > 0 && raw.AdditionalProperties[0] == '{' {
+		s.AdditionalProperties = new(Schema)
+		return json.Unmarshal(raw.AdditionalProperties, s.AdditionalProperties)
+	}
+	return nil
+}
+
+// PrimaryType returns first type of schema that is not "null", or empty
+// string if schema has no type.
+func (s *Schema) PrimaryType() string {
+	for _, t := range s.Type {
+		if t != "null" {
+			return t
+		}
+	}
+	return ""
+}
+
+// Parse parses OpenAPI document in JSON format.
+func Parse(data []byte) (*Document, error) {
+	doc := new(Document)
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("openapi: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("openapi: unsupported version %q", doc.OpenAPI)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&doc.raw); err != nil {
+		return nil, fmt.Errorf("openapi: %v", err)
+	}
+	return doc, nil
+}
+
+// Load reads and parses OpenAPI document from file.
+func Load(path string) (*Document, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// refName returns name of component that reference points to.
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// Schema returns schema that provided schema references, or schema itself
+// if it is not a reference. Nil is returned if reference can not be
+// resolved, including references that form a cycle.
+func (d *Document) Schema(s *Schema) *Schema {
+	seen := make(map[*Schema]bool)
+	for s != nil && s.Ref != "" {
+		if seen[s] {
+			return nil
+		}
+		seen[s] = true
+		s = d.Components.Schemas[refName(s.Ref)]
+	}
+	return s
+}
+
+// Parameter returns parameter that provided parameter references, or
+// parameter itself if it is not a reference. Like with Schema, nil is
+// returned for references that can not be resolved.
+func (d *Document) Parameter(p *Parameter) *Parameter {
+	seen := make(map[*Parameter]bool)
+	for p != nil && p.Ref != "" {
+		if seen[p] {
+			return nil
+		}
+		seen[p] = true
+		p = d.Components.Parameters[refName(p.Ref)]
+	}
+	return p
+}
+
+// RequestBody returns request body that provided request body references,
+// or request body itself if it is not a reference.
+func (d *Document) RequestBody(b *RequestBody) *RequestBody {
+	seen := make(map[*RequestBody]bool)
+	for b != nil && b.Ref != "" {
+		if seen[b] {
+			return nil
+		}
+		seen[b] = true
+		b = d.Components.RequestBodies[refName(b.Ref)]
+	}
+	return b
+}
+
+// Response returns response that provided response references, or response
+// itself if it is not a reference.
+func (d *Document) Response(r *Response) *Response {
+	seen := make(map[*Response]bool)
+	for r != nil && r.Ref != "" {
+		if seen[r] {
+			return nil
+		}
+		seen[r] = true
+		r = d.Components.Responses[refName(r.Ref)]
+	}
+	return r
+}
+
+// OperationInfo is operation together with its method, path and all
+// parameters, including ones defined on path.
+type OperationInfo struct {
+	Method     string
+	Path       string
+	Operation  *Operation
+	Parameters []*Parameter
+}
+
+// Operations returns all operations from document, sorted by path and
+// method. References of parameters are resolved.
+func (d *Document) Operations() []*OperationInfo {
+	paths := make([]string, 0, len(d.Paths))
+	for p := range d.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var ops []*OperationInfo
+	for _, path := range paths {
+		item := d.Paths[path]
+		for _, m := range []struct {
+			method string
+			op     *Operation
+		}{
+			{"GET", item.Get}, {"PUT", item.Put}, {"POST", item.Post},
+			{"DELETE", item.Delete}, {"OPTIONS", item.Options}, {"HEAD", item.Head},
+			{"PATCH", item.Patch}, {"TRACE", item.Trace},
+		} {
+			if m.op == nil {
+				continue
+			}
+			ops = append(ops, &OperationInfo{
+				Method:     m.method,
+				Path:       path,
+				Operation:  m.op,
+				Parameters: d.mergeParameters(item.Parameters, m.op.Parameters),
+			})
+		}
+	}
+	return ops
+}
+
+// mergeParameters returns path parameters overridden by operation
+// parameters with same name and location.
+func (d *Document) mergeParameters(path, op []*Parameter) []*Parameter {
+	var params []*Parameter
+	index := make(map[string]int)
+	for _, p := range append(append([]*Parameter{}, path...), op...) {
+		p = d.Parameter(p)
+		if p == nil {
+			continue
+		}
+		key := p.In + " " + p.Name
+		if i, ok := index[key]; ok {
+			params[i] = p
+			continue
+		}
+		index[key] = len(params)
+		params = append(params, p)
+	}
+	return params
+}
@@ -0,0 +1,119 @@
+package openapi_test
+
+import (
+	"testing"
+
+	"github.com/delicb/gwc/openapi"
+)
+
+func TestParse(t *testing.T) {
+	for _, data := range []string{
+		`{"openapi": "2.0"}`,
+		`{"swagger": "2.0"}`,
+		`not json`,
+	} {
+		if _, err := openapi.Parse([]byte(data)); err == nil {
+			t.Errorf("Expected error for %s.", data)
+		}
+	}
+}
+
+func TestSchema_Types(t *testing.T) {
+	doc, err := openapi.Parse([]byte(`{
+		"openapi": "3.1.0",
+		"components": {"schemas": {
+			"Single": {"type": "string"},
+			"Multiple": {"type": ["null", "integer"], "additionalProperties": false},
+			"Map": {"type": "object", "additionalProperties": {"type": "string"}}
+		}}
+	}`))
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	schemas := doc.Components.Schemas
+	if got := schemas["Single"].PrimaryType(); got != "string" {
+		t.Errorf("Wrong type. Got: %s, expected: %s", got, "string")
+	}
+	if got := schemas["Multiple"].PrimaryType(); got != "integer" {
+		t.Errorf("Wrong type. Got: %s, expected: %s", got, "integer")
+	}
+	if schemas["Multiple"].AdditionalProperties != nil {
+		t.Error("Boolean additionalProperties parsed as schema.")
+	}
+	if ap := schemas["Map"].AdditionalProperties; ap == nil || ap.PrimaryType() != "string" {
+		t.Error("additionalProperties schema not parsed.")
+	}
+}
+
+func TestDocument_Operations(t *testing.T) {
+	doc, err := openapi.Parse([]byte(`{
+		"openapi": "3.0.3",
+		"paths": {
+			"/b/{id}": {
+				"parameters": [
+					{"name": "id", "in": "path", "required": true, "description": "path level"},
+					{"$ref": "#/components/parameters/Trace"}
+				],
+				"post": {"parameters": [{"name": "id", "in": "path", "required": true, "description": "operation level"}]},
+				"get": {}
+			},
+			"/a": {"get": {}}
+		},
+		"components": {"parameters": {"Trace": {"name": "X-Trace", "in": "header"}}}
+	}`))
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	ops := doc.Operations()
+	var got []string
+	for _, op := range ops {
+		got = append(got, op.Method+" "+op.Path)
+	}
+	expected := []string{"GET /a", "GET /b/{id}", "POST /b/{id}"}
+	if len(got) != len(expected) {
+		t.Fatalf("Wrong operations. Got: %v, expected: %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Wrong operation. Got: %s, expected: %s", got[i], expected[i])
+		}
+	}
+	post := ops[2]
+	if len(post.Parameters) != 2 {
+		t.Fatalf("Wrong number of parameters. Got: %d, expected: 2", len(post.Parameters))
+	}
+	if post.Parameters[0].Description != "operation level" {
+		t.Error("Path parameter not overridden by operation parameter.")
+	}
+	if post.Parameters[1].Name != "X-Trace" {
+		t.Error("Parameter reference not resolved.")
+	}
+}
+
+func TestDocument_CyclicReferences(t *testing.T) {
+	doc, err := openapi.Parse([]byte(`{
+		"openapi": "3.0.3",
+		"components": {
+			"schemas": {
+				"A": {"$ref": "#/components/schemas/B"},
+				"B": {"$ref": "#/components/schemas/A"},
+				"Self": {"$ref": "#/components/schemas/Self"}
+			},
+			"parameters": {"P": {"$ref": "#/components/parameters/P"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for _, name := range []string{"A", "B", "Self"} {
+		if s := doc.Schema(doc.Components.Schemas[name]); s != nil {
+			t.Errorf("Wrong schema for cyclic reference %s. Got: %v, expected: nil", name, s)
+		}
+	}
+	if p := doc.Parameter(doc.Components.Parameters["P"]); p != nil {
+		t.Errorf("Wrong parameter for cyclic reference. Got: %v, expected: nil", p)
+	}
+	if _, err := openapi.Generate(doc, openapi.Config{}); err == nil {
+		t.Error("Expected error for cyclic schema references.")
+	}
+}
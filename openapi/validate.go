@@ -0,0 +1,517 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/delicb/cliware"
+
+	"github.com/delicb/gwc/jsonschema"
+)
+
+// Mode tells what Validator does when request or response does not match
+// API description.
+type Mode int
+
+const (
+	// Fail makes request fail with *ValidationError. Invalid requests are
+	// not sent.
+	Fail Mode = iota
+	// Log only logs problems, request and response are not changed.
+	Log
+)
+
+// ValidationError is returned by Validator in Fail mode when request or
+// response does not match API description.
+type ValidationError struct {
+	// Response is true if problems are found in response, and false if
+	// they are found in request.
+	Response bool
+	Method   string
+	URL      string
+	Problems []string
+}
+
+// Error is implementation of error interface.
+func (e *ValidationError) Error() string {
+	what := "request"
+	if e.Response {
+		what = "response of request"
+	}
+	return fmt.Sprintf("openapi: %s %s %s does not match API description: %s",
+		what, e.Method, e.URL, strings.Join(e.Problems, "; "))
+}
+
+// Validator is middleware that validates requests and responses against
+// OpenAPI document.
+//
+// Request is matched to operation by method and path, relative to path of
+// any server from document. Path, query, header and cookie parameters and
+// request body are validated before request is sent, and status code,
+// content type and body are validated when response is received. Only JSON
+// bodies are validated against schemas, for other media types only content
+// type is checked.
+//
+// Since it validates final request, Validator should be added to
+// gwc.Client with UsePost.
+type Validator struct {
+	mode     Mode
+	logger   *log.Logger
+	prefixes []string
+	routes   []*route
+}
+
+// route is compiled description of single operation.
+type route struct {
+	method    string
+	segments  []string
+	literals  int
+	params    []*routeParam
+	body      *routeBody
+	responses map[string]map[string]*jsonschema.Schema
+}
+
+type routeParam struct {
+	name     string
+	in       string
+	required bool
+	typ      string
+	schema   *jsonschema.Schema
+}
+
+type routeBody struct {
+	required bool
+	content  map[string]*jsonschema.Schema
+}
+
+// NewValidator creates and returns validator for provided document, which
+// has to be created with Parse or Load. Error is returned if any schema in
+// document can not be compiled.
+func NewValidator(doc *Document, mode Mode) (*Validator, error) {
+	root, ok := doc.raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("openapi: document has to be created with Parse or Load")
+	}
+	v := &Validator{mode: mode}
+
+	for _, s := range doc.Servers {
+		if u, err := url.Parse(s.URL); err == nil && strings.Trim(u.Path, "/") != "" {
+			v.prefixes = append(v.prefixes, "/"+strings.Trim(u.Path, "/"))
+		}
+	}
+	v.prefixes = append(v.prefixes, "")
+
+	paths, _ := root["paths"].(map[string]interface{})
+	for _, path := range sortedKeys(paths) {
+		item, _ := deref(root, paths[path]).(map[string]interface{})
+		for _, method := range []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"} {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			r, err := newRoute(root, strings.ToUpper(method), path, item, op)
+			if err != nil {
+				return nil, fmt.Errorf("openapi: %s %s: %v", strings.ToUpper(method), path, err)
+			}
+			v.routes = append(v.routes, r)
+		}
+	}
+	// routes with more literal segments are more specific
+	sort.SliceStable(v.routes, func(i, j int) bool {
+		return v.routes[i].literals > v.routes[j].literals
+	})
+	return v, nil
+}
+
+// Logger sets logger used to log problems. If it is not set, standard
+// logger from log package is used.
+func (v *Validator) Logger(logger *log.Logger) *Validator {
+	v.logger = logger
+	return v
+}
+
+// deref returns node that provided node references, or node itself if it is
+// not a reference.
+func deref(root, node interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return node
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#") {
+			return node
+		}
+		pointer, err := url.PathUnescape(ref[1:])
+		if err != nil {
+			return nil
+		}
+		node, _ = jsonschema.Pointer(root, pointer)
+	}
+	return nil
+}
+
+// compileContent compiles schemas of content map of request body or
+// response.
+func compileContent(root interface{}, content interface{}) (map[string]*jsonschema.Schema, error) {
+	result := make(map[string]*jsonschema.Schema)
+	m, _ := content.(map[string]interface{})
+	for mediaType, mt := range m {
+		mt, _ := mt.(map[string]interface{})
+		var schema *jsonschema.Schema
+		if s, ok := mt["schema"]; ok {
+			var err error
+			if schema, err = jsonschema.CompileIn(root, s); err != nil {
+				return nil, err
+			}
+		}
+		result[mediaType] = schema
+	}
+	return result, nil
+}
+
+func newRoute(root interface{}, method, path string, item, op map[string]interface{}) (*route, error) {
+	r := &route{
+		method:    method,
+		segments:  strings.Split(strings.Trim(path, "/"), "/"),
+		responses: make(map[string]map[string]*jsonschema.Schema),
+	}
+	for _, s := range r.segments {
+		if !strings.HasPrefix(s, "{") {
+			r.literals++
+		}
+	}
+
+	index := make(map[string]int)
+	itemParams, _ := item["parameters"].([]interface{})
+	opParams, _ := op["parameters"].([]interface{})
+	for _, p := range append(append([]interface{}{}, itemParams...), opParams...) {
+		pm, ok := deref(root, p).(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rp := &routeParam{}
+		rp.name, _ = pm["name"].(string)
+		rp.in, _ = pm["in"].(string)
+		rp.required, _ = pm["required"].(bool)
+		if s, ok := pm["schema"]; ok {
+			var err error
+			if rp.schema, err = jsonschema.CompileIn(root, s); err != nil {
+				return nil, fmt.Errorf("parameter %q: %v", rp.name, err)
+			}
+			rp.typ = schemaType(root, s)
+		}
+		key := rp.in + " " + strings.ToLower(rp.name)
+		if i, ok := index[key]; ok {
+			r.params[i] = rp
+			continue
+		}
+		index[key] = len(r.params)
+		r.params = append(r.params, rp)
+	}
+
+	if body, ok := deref(root, op["requestBody"]).(map[string]interface{}); ok {
+		content, err := compileContent(root, body["content"])
+		if err != nil {
+			return nil, fmt.Errorf("request body: %v", err)
+		}
+		r.body = &routeBody{content: content}
+		r.body.required, _ = body["required"].(bool)
+	}
+
+	responses, _ := op["responses"].(map[string]interface{})
+	for code, resp := range responses {
+		rm, _ := deref(root, resp).(map[string]interface{})
+		content, err := compileContent(root, rm["content"])
+		if err != nil {
+			return nil, fmt.Errorf("response %s: %v", code, err)
+		}
+		r.responses[strings.ToUpper(code)] = content
+	}
+	return r, nil
+}
+
+// schemaType returns type of schema, used to convert parameter values from
+// strings.
+func schemaType(root, schema interface{}) string {
+	s, _ := deref(root, schema).(map[string]interface{})
+	switch t := s["type"].(type) {
+	case string:
+		if t == "array" {
+			return "array:" + schemaType(root, s["items"])
+		}
+		return t
+	case []interface{}:
+		for _, e := range t {
+			if e != "null" {
+				if e == "array" {
+					return "array:" + schemaType(root, s["items"])
+				}
+				return fmt.Sprint(e)
+			}
+		}
+	}
+	return ""
+}
+
+// match returns route that matches request and values of path parameters.
+func (v *Validator) match(req *http.Request) (*route, map[string]string) {
+	for _, prefix := range v.prefixes {
+		if !strings.HasPrefix(req.URL.Path, prefix) {
+			continue
+		}
+		segments := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, prefix), "/"), "/")
+		for _, r := range v.routes {
+			if r.method != req.Method || len(r.segments) != len(segments) {
+				continue
+			}
+			values := make(map[string]string)
+			matched := true
+			for i, s := range r.segments {
+				if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+					values[s[1:len(s)-1]] = segments[i]
+				} else if s != segments[i] {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				return r, values
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (v *Validator) Exec(next cliware.Handler) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		r, values := v.match(req)
+		var problems []string
+		if r == nil {
+			problems = []string{"no operation matches request"}
+		} else {
+			problems = v.validateRequest(r, values, req)
+		}
+		if err := v.report(false, req, problems); err != nil {
+			return nil, err
+		}
+
+		resp, err := next.Handle(req)
+		if err != nil || r == nil || resp == nil {
+			return resp, err
+		}
+		problems = v.validateResponse(r, resp)
+		return resp, v.report(true, req, problems)
+	})
+}
+
+// report logs problems or returns them as error, depending on mode.
+func (v *Validator) report(response bool, req *http.Request, problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	err := &ValidationError{
+		Response: response,
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Problems: problems,
+	}
+	if v.mode == Fail {
+		return err
+	}
+	if v.logger != nil {
+		v.logger.Print(err)
+	} else {
+		log.Print(err)
+	}
+	return nil
+}
+
+func (v *Validator) validateRequest(r *route, pathValues map[string]string, req *http.Request) []string {
+	var problems []string
+	query := req.URL.Query()
+	for _, p := range r.params {
+		var values []string
+		switch p.in {
+		case "path":
+			if value, ok := pathValues[p.name]; ok {
+				if unescaped, err := url.PathUnescape(value); err == nil {
+					value = unescaped
+				}
+				values = []string{value}
+			}
+		case "query":
+			values = query[p.name]
+		case "header":
+			// these headers are described by other parts of document
+			switch http.CanonicalHeaderKey(p.name) {
+			case "Accept", "Content-Type", "Authorization":
+				continue
+			}
+			values = req.Header.Values(p.name)
+		case "cookie":
+			if c, err := req.Cookie(p.name); err == nil {
+				values = []string{c.Value}
+			}
+		}
+		where := fmt.Sprintf("%s parameter %q", p.in, p.name)
+		if len(values) == 0 {
+			if p.required {
+				problems = append(problems, where+" is required")
+			}
+			continue
+		}
+		if p.schema != nil {
+			problems = append(problems, schemaProblems(where, p.schema.Validate(paramValue(p.typ, values)))...)
+		}
+	}
+	return append(problems, v.validateRequestBody(r, req)...)
+}
+
+func (v *Validator) validateRequestBody(r *route, req *http.Request) []string {
+	data, err := readBody(&req.Body)
+	if err != nil {
+		return []string{fmt.Sprintf("reading body: %v", err)}
+	}
+	if req.Body != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+	}
+	if r.body == nil {
+		if len(data) > 0 {
+			return []string{"body is not allowed"}
+		}
+		return nil
+	}
+	if len(data) == 0 {
+		if r.body.required {
+			return []string{"body is required"}
+		}
+		return nil
+	}
+	return contentProblems("body", r.body.content, req.Header.Get("Content-Type"), data)
+}
+
+func (v *Validator) validateResponse(r *route, resp *http.Response) []string {
+	code := strconv.Itoa(resp.StatusCode)
+	content, ok := r.responses[code]
+	if !ok {
+		content, ok = r.responses[code[:1]+"XX"]
+	}
+	if !ok {
+		content, ok = r.responses["DEFAULT"]
+	}
+	if !ok {
+		return []string{fmt.Sprintf("status code %d is not documented", resp.StatusCode)}
+	}
+	data, err := readBody(&resp.Body)
+	if err != nil {
+		return []string{fmt.Sprintf("reading body: %v", err)}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if len(content) == 0 {
+		return []string{fmt.Sprintf("body is not documented for status code %d", resp.StatusCode)}
+	}
+	return contentProblems("body", content, resp.Header.Get("Content-Type"), data)
+}
+
+// readBody reads provided body and replaces it with one that returns same
+// data.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(*body)
+	(*body).Close()
+	*body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, err
+}
+
+// contentProblems checks that content type of body is documented and
+// validates JSON body against its schema.
+func contentProblems(where string, content map[string]*jsonschema.Schema, contentType string, data []byte) []string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return []string{fmt.Sprintf("%s has invalid content type %q", where, contentType)}
+	}
+	schema, ok := content[mediaType]
+	if !ok {
+		schema, ok = content[mediaType[:strings.Index(mediaType, "/")+1]+"*"]
+	}
+	if !ok {
+		schema, ok = content["*/*"]
+	}
+	if !ok {
+		return []string{fmt.Sprintf("%s content type %q is not documented", where, mediaType)}
+	}
+	if schema == nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return nil
+	}
+	var value interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("%s is not valid JSON: %v", where, err)}
+	}
+	return schemaProblems(where, schema.Validate(value))
+}
+
+// schemaProblems converts schema validation error to list of problems.
+func schemaProblems(where string, err error) []string {
+	if err == nil {
+		return nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []string{fmt.Sprintf("%s: %v", where, err)}
+	}
+	problems := make([]string, len(verr.Errors))
+	for i, e := range verr.Errors {
+		problems[i] = fmt.Sprintf("%s: %v", where, e)
+	}
+	return problems
+}
+
+// paramValue converts string values of parameter to value of its type.
+func paramValue(typ string, values []string) interface{} {
+	if strings.HasPrefix(typ, "array:") {
+		if len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		items := make([]interface{}, len(values))
+		for i, v := range values {
+			items[i] = scalarValue(typ[len("array:"):], v)
+		}
+		return items
+	}
+	return scalarValue(typ, values[0])
+}
+
+func scalarValue(typ, value string) interface{} {
+	switch typ {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
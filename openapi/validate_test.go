@@ -0,0 +1,147 @@
+package openapi_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/openapi"
+)
+
+func newValidatedClient(t *testing.T, mode openapi.Mode, handler http.HandlerFunc) (*gwc.Client, *openapi.Validator) {
+	doc, err := openapi.Load("testdata/petstore.json")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	validator, err := openapi.NewValidator(doc, mode)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	client := gwc.NewForHandler(handler)
+	client.UsePost(validator)
+	return client, validator
+}
+
+func petsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/v1/pets":
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 1, "name": "rex"}`))
+			return
+		}
+		w.Write([]byte(`{"items": [{"id": 1, "name": "rex", "status": "sold"}]}`))
+	case "/v1/pets/1":
+		w.Write([]byte(`{"id": "1", "name": "rex"}`))
+	case "/v1/pets/2":
+		w.WriteHeader(http.StatusTeapot)
+	}
+}
+
+func problems(t *testing.T, err error, response bool) []string {
+	verr, ok := err.(*openapi.ValidationError)
+	if !ok {
+		t.Fatalf("Expected ValidationError, got: %v", err)
+	}
+	if verr.Response != response {
+		t.Errorf("Wrong Response flag. Got: %t, expected: %t", verr.Response, response)
+	}
+	return verr.Problems
+}
+
+func TestValidator_Valid(t *testing.T) {
+	client, _ := newValidatedClient(t, openapi.Fail, petsHandler)
+	resp, err := client.Get().URL("http://petstore.example.com/v1/pets").
+		SetQuery("limit", "10").
+		AddQuery("status", "sold").
+		SetHeader("X-Request-ID", "abc").
+		Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	// body is still readable after validation
+	if body, _ := resp.String(); !strings.Contains(body, "rex") {
+		t.Errorf("Wrong body: %s", body)
+	}
+
+	_, err = client.Post().URL("http://petstore.example.com/v1/pets").
+		BodyJSON(map[string]interface{}{"name": "rex", "status": "pending"}).
+		Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+}
+
+func TestValidator_InvalidRequest(t *testing.T) {
+	sent := false
+	client, _ := newValidatedClient(t, openapi.Fail, func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+		petsHandler(w, r)
+	})
+
+	_, err := client.Get().URL("http://petstore.example.com/v1/pets").
+		SetQuery("limit", "many").
+		AddQuery("status", "lost").
+		Send()
+	p := problems(t, err, false)
+	if len(p) != 3 {
+		t.Errorf("Wrong number of problems. Got: %d, expected: 3 (%v)", len(p), p)
+	}
+	if sent {
+		t.Error("Invalid request was sent.")
+	}
+
+	_, err = client.Post().URL("http://petstore.example.com/v1/pets").
+		BodyJSON(map[string]interface{}{"status": "pending"}).
+		Send()
+	p = problems(t, err, false)
+	if len(p) != 1 || !strings.Contains(p[0], `missing required property "name"`) {
+		t.Errorf("Wrong problems: %v", p)
+	}
+
+	_, err = client.Get().URL("http://petstore.example.com/v1/unknown").Send()
+	problems(t, err, false)
+}
+
+func TestValidator_InvalidResponse(t *testing.T) {
+	client, _ := newValidatedClient(t, openapi.Fail, petsHandler)
+
+	_, err := client.Get().URL("http://petstore.example.com/v1/pets/1").Send()
+	p := problems(t, err, true)
+	if len(p) != 1 || !strings.Contains(p[0], `"/id"`) {
+		t.Errorf("Wrong problems: %v", p)
+	}
+
+	_, err = client.Get().URL("http://petstore.example.com/v1/pets/2").Send()
+	p = problems(t, err, true)
+	if len(p) != 1 || !strings.Contains(p[0], "418") {
+		t.Errorf("Wrong problems: %v", p)
+	}
+}
+
+func TestValidator_Log(t *testing.T) {
+	client, validator := newValidatedClient(t, openapi.Log, petsHandler)
+	var buf bytes.Buffer
+	validator.Logger(log.New(&buf, "", 0))
+
+	resp, err := client.Get().URL("http://petstore.example.com/v1/pets/1").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Wrong status code. Got: %d, expected: %d", resp.StatusCode, http.StatusOK)
+	}
+	if !strings.Contains(buf.String(), "does not match API description") {
+		t.Errorf("Problem not logged. Got: %s", buf.String())
+	}
+}
+
+func TestNewValidator_NotParsed(t *testing.T) {
+	if _, err := openapi.NewValidator(&openapi.Document{}, openapi.Fail); err == nil {
+		t.Error("Expected error for document that is not parsed.")
+	}
+}
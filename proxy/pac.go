@@ -0,0 +1,342 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PAC is parsed proxy auto-config file. Scripts are evaluated by
+// interpreter of JavaScript subset that is sufficient for most PAC files:
+// functions, variables, if/else, operators, string methods and all
+// standard PAC functions except dateRange. Scripts can not loop and can
+// only call PAC functions. Evaluation is limited by number of steps and
+// length of strings scripts create, and it stops when context of request is
+// canceled, so scripts can not run for long or exhaust memory.
+//
+// PAC is safe for concurrent use.
+type PAC struct {
+	// globals are functions and variables declared in script
+	globals map[string]interface{}
+}
+
+// ParsePAC parses PAC script, which has to define FindProxyForURL
+// function.
+func ParsePAC(script string) (*PAC, error) {
+	nodes, err := parseScript(script)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: invalid PAC script: %v", err)
+	}
+	p := &PAC{globals: make(map[string]interface{})}
+	for _, n := range nodes {
+		if f, ok := n.(*funcDecl); ok {
+			p.globals[f.name] = &closure{decl: f}
+		}
+	}
+	if _, ok := p.globals["FindProxyForURL"]; !ok {
+		return nil, fmt.Errorf("proxy: PAC script does not define FindProxyForURL")
+	}
+	in := p.interpreter(context.Background())
+	for _, n := range nodes {
+		if v, ok := n.(*varStmt); ok {
+			if _, err := in.exec(v, in.globals); err != nil {
+				return nil, fmt.Errorf("proxy: PAC script failed: %v", err)
+			}
+		}
+	}
+	for name, value := range in.globals.vars {
+		if _, ok := value.(builtin); !ok {
+			p.globals[name] = value
+		}
+	}
+	return p, nil
+}
+
+// LoadPAC loads and parses PAC file from provided location, which can be
+// HTTP(S) URL, file URL or path.
+func LoadPAC(location string) (*PAC, error) {
+	var data []byte
+	var err error
+	switch {
+	case strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://"):
+		data, err = download(location)
+	case strings.HasPrefix(location, "file://"):
+		var u *url.URL
+		if u, err = url.Parse(location); err == nil {
+			data, err = ioutil.ReadFile(u.Path)
+		}
+	default:
+		data, err = ioutil.ReadFile(location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("proxy: loading PAC file: %v", err)
+	}
+	return ParsePAC(string(data))
+}
+
+// download downloads PAC file directly, since proxy is not known yet.
+func download(location string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// interpreter returns interpreter with PAC functions and globals of script.
+func (p *PAC) interpreter(ctx context.Context) *interpreter {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	vars := pacFunctions(ctx)
+	for name, value := range p.globals {
+		vars[name] = value
+	}
+	return &interpreter{ctx: ctx, globals: &scope{vars: vars}}
+}
+
+// FindProxyForURL calls FindProxyForURL function of script and returns its
+// result, like "PROXY proxy.example.com:8080; DIRECT".
+func (p *PAC) FindProxyForURL(ctx context.Context, rawURL, host string) (string, error) {
+	in := p.interpreter(ctx)
+	result, err := in.call(p.globals["FindProxyForURL"], []interface{}{rawURL, host}, 0)
+	if err != nil {
+		return "", fmt.Errorf("proxy: PAC script failed: %v", err)
+	}
+	if result == nil {
+		return direct, nil
+	}
+	return toString(result), nil
+}
+
+// proxy returns first supported proxy that script returns for provided
+// URL, or nil if connection should be direct.
+func (p *PAC) proxy(ctx context.Context, u *url.URL) (*url.URL, error) {
+	rawURL := u.String()
+	if u.Scheme == "https" {
+		// browsers pass only scheme and host of HTTPS URLs to scripts, so
+		// that path is not exposed
+		rawURL = u.Scheme + "://" + u.Host + "/"
+	}
+	result, err := p.FindProxyForURL(ctx, rawURL, u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	return parsePACResult(result)
+}
+
+// pacSchemes maps proxy types in PAC results to proxy URL schemes.
+var pacSchemes = map[string]string{
+	"PROXY":  "http",
+	"HTTP":   "http",
+	"HTTPS":  "https",
+	"SOCKS5": "socks5",
+}
+
+// parsePACResult returns first supported proxy from result of
+// FindProxyForURL. SOCKS and SOCKS4 proxies are not supported and are
+// skipped, and connection is direct if result has no supported proxy.
+// Proxies after first supported one are not used, requests fail if it is
+// not reachable instead of failing over to next one.
+func parsePACResult(result string) (*url.URL, error) {
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == direct {
+			return nil, nil
+		}
+		scheme, ok := pacSchemes[kind]
+		if !ok || len(fields) != 2 {
+			continue
+		}
+		return parseProxy(scheme + "://" + fields[1])
+	}
+	return nil, nil
+}
+
+// pacFunctions returns standard PAC functions. Names are resolved using
+// provided context.
+func pacFunctions(ctx context.Context) map[string]interface{} {
+	resolve := func(host string) net.IP {
+		if ip := net.ParseIP(host); ip != nil {
+			return ip
+		}
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+		if err != nil || len(ips) == 0 {
+			return nil
+		}
+		return ips[0]
+	}
+	str := func(args []interface{}, i int) string {
+		if i < len(args) {
+			return toString(args[i])
+		}
+		return ""
+	}
+	return map[string]interface{}{
+		"isPlainHostName": builtin(func(args []interface{}) (interface{}, error) {
+			return !strings.Contains(str(args, 0), "."), nil
+		}),
+		"dnsDomainIs": builtin(func(args []interface{}) (interface{}, error) {
+			return strings.HasSuffix(strings.ToLower(str(args, 0)), strings.ToLower(str(args, 1))), nil
+		}),
+		"localHostOrDomainIs": builtin(func(args []interface{}) (interface{}, error) {
+			host, hostDomain := strings.ToLower(str(args, 0)), strings.ToLower(str(args, 1))
+			if host == hostDomain {
+				return true, nil
+			}
+			return !strings.Contains(host, ".") && strings.HasPrefix(hostDomain, host+"."), nil
+		}),
+		"isResolvable": builtin(func(args []interface{}) (interface{}, error) {
+			return resolve(str(args, 0)) != nil, nil
+		}),
+		"dnsResolve": builtin(func(args []interface{}) (interface{}, error) {
+			if ip := resolve(str(args, 0)); ip != nil {
+				return ip.String(), nil
+			}
+			return nil, nil
+		}),
+		"isInNet": builtin(func(args []interface{}) (interface{}, error) {
+			ip := resolve(str(args, 0)).To4()
+			pattern := net.ParseIP(str(args, 1)).To4()
+			mask := net.ParseIP(str(args, 2)).To4()
+			if ip == nil || pattern == nil || mask == nil {
+				return false, nil
+			}
+			return ip.Mask(net.IPMask(mask)).Equal(pattern.Mask(net.IPMask(mask))), nil
+		}),
+		"myIpAddress": builtin(func(args []interface{}) (interface{}, error) {
+			return myIPAddress(), nil
+		}),
+		"dnsDomainLevels": builtin(func(args []interface{}) (interface{}, error) {
+			return float64(strings.Count(str(args, 0), ".")), nil
+		}),
+		"shExpMatch": builtin(func(args []interface{}) (interface{}, error) {
+			return shExpMatch(str(args, 0), str(args, 1)), nil
+		}),
+		"convert_addr": builtin(func(args []interface{}) (interface{}, error) {
+			ip := net.ParseIP(str(args, 0)).To4()
+			if ip == nil {
+				return float64(0), nil
+			}
+			return float64(uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])), nil
+		}),
+		"weekdayRange": builtin(weekdayRange),
+		"timeRange":    builtin(timeRange),
+		"dateRange": builtin(func(args []interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("dateRange is not supported")
+		}),
+		"alert": builtin(func(args []interface{}) (interface{}, error) {
+			return nil, nil
+		}),
+	}
+}
+
+// myIPAddress returns first IPv4 address of this host that is not
+// loopback.
+func myIPAddress() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() && n.IP.To4() != nil {
+				return n.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// shExpMatch matches string against shell expression, where "*" matches
+// any sequence of characters and "?" any single character.
+func shExpMatch(s, pattern string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	matched, _ := regexp.MatchString(b.String(), s)
+	return matched
+}
+
+var weekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// now returns current time, in UTC if last argument is "GMT", and
+// arguments without it.
+func now(args []interface{}) (time.Time, []interface{}) {
+	t := time.Now()
+	if len(args) > 0 && toString(args[len(args)-1]) == "GMT" {
+		return t.UTC(), args[:len(args)-1]
+	}
+	return t, args
+}
+
+// inRange returns true if value is between from and to, which can wrap
+// around.
+func inRange(value, from, to int) bool {
+	if from <= to {
+		return value >= from && value <= to
+	}
+	return value >= from || value <= to
+}
+
+func weekdayRange(args []interface{}) (interface{}, error) {
+	t, args := now(args)
+	day := func(i int) (int, error) {
+		for d, name := range weekdays {
+			if strings.ToUpper(toString(args[i])) == name {
+				return d, nil
+			}
+		}
+		return 0, fmt.Errorf("weekdayRange: invalid weekday %q", toString(args[i]))
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("weekdayRange: invalid arguments")
+	}
+	from, err := day(0)
+	if err != nil {
+		return nil, err
+	}
+	to := from
+	if len(args) == 2 {
+		if to, err = day(1); err != nil {
+			return nil, err
+		}
+	}
+	return inRange(int(t.Weekday()), from, to), nil
+}
+
+// timeRange supports only hour forms, timeRange(hour) and
+// timeRange(hour1, hour2).
+func timeRange(args []interface{}) (interface{}, error) {
+	t, args := now(args)
+	switch len(args) {
+	case 1:
+		return t.Hour() == int(toNumber(args[0])), nil
+	case 2:
+		// end hour is exclusive, same as in browsers
+		return inRange(t.Hour(), int(toNumber(args[0])), int(toNumber(args[1]))-1), nil
+	}
+	return nil, fmt.Errorf("timeRange: only hour ranges are supported")
+}
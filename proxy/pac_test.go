@@ -0,0 +1,191 @@
+package proxy_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/delicb/gwc/proxy"
+)
+
+const corporatePAC = `
+// proxies of corporate network
+var proxies = "PROXY proxy1.corp:8080; PROXY proxy2.corp:8080";
+
+function isInternal(host) {
+	return isPlainHostName(host) ||
+		dnsDomainIs(host, ".corp.example.com") ||
+		localHostOrDomainIs(host, "intranet.example.com");
+}
+
+/* main entry point */
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isInternal(host)) {
+		return "DIRECT";
+	} else if (isInNet(host, "10.0.0.0", "255.0.0.0") || shExpMatch(host, "192.168.*")) {
+		return "DIRECT";
+	}
+	if (shExpMatch(url, "http://*/downloads/*.iso"))
+		return "PROXY downloads.corp:3128";
+	if (url.substring(0, 6) == "https:" && dnsDomainLevels(host) > 2)
+		return "SOCKS5 socks.corp:1080";
+	if (host.indexOf("legacy") != -1)
+		return "SOCKS legacy.corp:1080; HTTPS secure.corp:443";
+	if (host.indexOf("old") != -1)
+		return "SOCKS old.corp:1080; PROXY";
+	return proxies + "; DIRECT";
+}
+`
+
+func TestPAC_FindProxyForURL(t *testing.T) {
+	pac, err := proxy.ParsePAC(corporatePAC)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for _, data := range []struct {
+		URL    string
+		Host   string
+		Result string
+	}{
+		{"http://wiki/", "wiki", "DIRECT"},
+		{"http://build.corp.example.com/", "build.corp.example.com", "DIRECT"},
+		{"http://BUILD.CORP.EXAMPLE.COM/", "BUILD.CORP.EXAMPLE.COM", "DIRECT"},
+		{"http://intranet/", "intranet", "DIRECT"},
+		{"http://10.1.2.3/", "10.1.2.3", "DIRECT"},
+		{"http://192.168.0.5/", "192.168.0.5", "DIRECT"},
+		{"http://mirror.example.com/downloads/linux.iso", "mirror.example.com", "PROXY downloads.corp:3128"},
+		{"https://api.eu.example.com/", "api.eu.example.com", "SOCKS5 socks.corp:1080"},
+		{"http://legacy.example.com/", "legacy.example.com", "SOCKS legacy.corp:1080; HTTPS secure.corp:443"},
+		{"http://example.com/", "example.com", "PROXY proxy1.corp:8080; PROXY proxy2.corp:8080; DIRECT"},
+	} {
+		result, err := pac.FindProxyForURL(context.Background(), data.URL, data.Host)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if result != data.Result {
+			t.Errorf("Wrong result for %s. Got: %s, expected: %s", data.URL, result, data.Result)
+		}
+	}
+}
+
+func TestPAC_Proxies(t *testing.T) {
+	pac, err := proxy.ParsePAC(corporatePAC)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	p := proxy.New().PAC(pac)
+	for _, data := range []struct {
+		URL   string
+		Proxy string
+	}{
+		{"http://wiki/", ""},
+		// only first proxy is used, without failover
+		{"http://example.com/", "http://proxy1.corp:8080"},
+		{"https://api.eu.example.com/", "socks5://socks.corp:1080"},
+		// SOCKS4 is not supported, so next proxy is used
+		{"http://legacy.example.com/", "https://secure.corp:443"},
+		// without supported proxy connection is direct
+		{"http://old.example.com/", ""},
+	} {
+		req, _ := http.NewRequest("GET", data.URL, nil)
+		u, err := p.Proxy(req)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != data.Proxy {
+			t.Errorf("Wrong proxy for %s. Got: %s, expected: %s", data.URL, got, data.Proxy)
+		}
+	}
+}
+
+func TestParsePAC_Errors(t *testing.T) {
+	for _, script := range []string{
+		`function FindProxy(url, host) { return "DIRECT"; }`,
+		`function FindProxyForURL(url, host) { return "DIRECT"`,
+		`function FindProxyForURL(url, host) { while (true) {} }`,
+		`function FindProxyForURL(url, host) { return 'DIRECT; }`,
+		`var x = undefinedFunction();
+		function FindProxyForURL(url, host) { return "DIRECT"; }`,
+		`FindProxyForURL = 1;`,
+	} {
+		if _, err := proxy.ParsePAC(script); err == nil {
+			t.Errorf("Expected error for script: %s", script)
+		}
+	}
+}
+
+func TestPAC_RuntimeErrors(t *testing.T) {
+	for _, script := range []string{
+		`function FindProxyForURL(url, host) { return FindProxyForURL(url, host); }`,
+		`function FindProxyForURL(url, host) { return missing; }`,
+		`function FindProxyForURL(url, host) { return host.split("."); }`,
+		`function FindProxyForURL(url, host) { return dateRange("JAN"); }`,
+		// exponential time and string length
+		`function f(s, n) { if (n == 0) return s; return f(s + s, n - 1) + f(s, n - 1); }
+		function FindProxyForURL(url, host) { return f(host, 60); }`,
+		`function f(n) { if (n == 0) return ""; f(n - 1); f(n - 1); return ""; }
+		function FindProxyForURL(url, host) { return f(60); }`,
+	} {
+		pac, err := proxy.ParsePAC(script)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if _, err := pac.FindProxyForURL(context.Background(), "http://example.com/", "example.com"); err == nil {
+			t.Errorf("Expected error for script: %s", script)
+		}
+	}
+}
+
+func TestPAC_Canceled(t *testing.T) {
+	pac, err := proxy.ParsePAC(`function FindProxyForURL(url, host) { return "DIRECT"; }`)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pac.FindProxyForURL(ctx, "http://example.com/", "example.com"); err == nil {
+		t.Error("Expected error for canceled context.")
+	}
+	if _, err := pac.FindProxyForURL(nil, "http://example.com/", "example.com"); err != nil {
+		t.Error("Got unexpected error:", err)
+	}
+}
+
+func TestLoadPAC(t *testing.T) {
+	script := `function FindProxyForURL(url, host) { return "PROXY loaded:8080"; }`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+		w.Write([]byte(script))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "pac")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "proxy.pac")
+	ioutil.WriteFile(file, []byte(script), 0600)
+
+	for _, location := range []string{server.URL + "/proxy.pac", file, "file://" + file} {
+		pac, err := proxy.LoadPAC(location)
+		if err != nil {
+			t.Fatalf("Got unexpected error for %s: %v", location, err)
+		}
+		result, _ := pac.FindProxyForURL(context.Background(), "http://example.com/", "example.com")
+		if result != "PROXY loaded:8080" {
+			t.Errorf("Wrong result. Got: %s, expected: %s", result, "PROXY loaded:8080")
+		}
+	}
+	if _, err := proxy.LoadPAC(filepath.Join(dir, "missing.pac")); err == nil {
+		t.Error("Expected error for missing file.")
+	}
+}
@@ -0,0 +1,969 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This file contains interpreter for subset of JavaScript that PAC files
+// commonly use: function declarations, var declarations and assignments,
+// if/else, return, string, number and boolean literals, logical, equality,
+// relational and arithmetic operators, calls of functions and of string
+// methods toLowerCase, toUpperCase, indexOf, substring and length. Loops and
+// objects are not supported, so scripts can not access anything but PAC
+// functions. Recursion can still make evaluation take exponential time and
+// string concatenation can make strings grow exponentially, so evaluation
+// is limited by number of steps and length of strings, and it stops when
+// its context is canceled.
+
+const (
+	// maxCallDepth limits recursion in scripts.
+	maxCallDepth = 64
+	// maxSteps limits number of statements and function calls evaluated
+	// by single call of script function.
+	maxSteps = 100000
+	// maxStringLength limits length of strings created by scripts.
+	maxStringLength = 1 << 16
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	line  int
+}
+
+// punctuations are all supported operators and delimiters, longest first.
+var punctuations = []string{
+	"===", "!==", "==", "!=", "<=", ">=", "&&", "||",
+	"(", ")", "{", "}", ";", ",", ".", "!", "=", "+", "-", "*", "/", "%", "<", ">",
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated string", line)
+				}
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+					switch src[j] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[j])
+					}
+					continue
+				}
+				b.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{kind: tokString, value: b.String(), line: line})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokNumber, value: src[i:j], line: line})
+			i = j
+		case c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '$' || src[j] >= 'a' && src[j] <= 'z' ||
+				src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, value: src[i:j], line: line})
+			i = j
+		default:
+			found := false
+			for _, p := range punctuations {
+				if strings.HasPrefix(src[i:], p) {
+					tokens = append(tokens, token{kind: tokPunct, value: p, line: line})
+					i += len(p)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, line: line}), nil
+}
+
+// node is node of syntax tree.
+type node interface{}
+
+type (
+	funcDecl struct {
+		name   string
+		params []string
+		body   []node
+	}
+	varStmt struct {
+		names  []string
+		values []node
+	}
+	assignStmt struct {
+		name  string
+		value node
+	}
+	ifStmt struct {
+		cond      node
+		then, els node
+	}
+	returnStmt struct {
+		value node
+	}
+	blockStmt struct {
+		body []node
+	}
+	exprStmt struct {
+		expr node
+	}
+	literal struct {
+		value interface{}
+	}
+	identExpr struct {
+		name string
+		line int
+	}
+	unaryExpr struct {
+		op      string
+		operand node
+	}
+	binaryExpr struct {
+		op          string
+		left, right node
+		line        int
+	}
+	callExpr struct {
+		fn   node
+		args []node
+		line int
+	}
+	memberExpr struct {
+		object node
+		name   string
+		line   int
+	}
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(kind tokenKind, value string) bool {
+	t := p.peek()
+	return t.kind == kind && t.value == value
+}
+
+func (p *parser) accept(kind tokenKind, value string) bool {
+	if p.is(kind, value) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, value string) error {
+	if !p.accept(kind, value) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("line %d: unexpected end of script", t.line)
+	}
+	return fmt.Errorf("line %d: unexpected %q", t.line, t.value)
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return "", p.unexpected()
+	}
+	p.next()
+	return t.value, nil
+}
+
+// parseScript parses top level of script, which can contain only function
+// and variable declarations.
+func parseScript(src string) ([]node, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	var nodes []node
+	for p.peek().kind != tokEOF {
+		switch {
+		case p.is(tokIdent, "function"):
+			f, err := p.function()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, f)
+		case p.is(tokIdent, "var"):
+			v, err := p.statement()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, v)
+		case p.accept(tokPunct, ";"):
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	return nodes, nil
+}
+
+func (p *parser) function() (*funcDecl, error) {
+	p.next()
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokPunct, "("); err != nil {
+		return nil, err
+	}
+	f := &funcDecl{name: name}
+	for !p.accept(tokPunct, ")") {
+		if len(f.params) > 0 {
+			if err := p.expect(tokPunct, ","); err != nil {
+				return nil, err
+			}
+		}
+		param, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		f.params = append(f.params, param)
+	}
+	block, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	f.body = block.body
+	return f, nil
+}
+
+func (p *parser) block() (*blockStmt, error) {
+	if err := p.expect(tokPunct, "{"); err != nil {
+		return nil, err
+	}
+	b := &blockStmt{}
+	for !p.accept(tokPunct, "}") {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		b.body = append(b.body, s)
+	}
+	return b, nil
+}
+
+func (p *parser) statement() (node, error) {
+	switch {
+	case p.is(tokPunct, "{"):
+		return p.block()
+	case p.accept(tokPunct, ";"):
+		return &blockStmt{}, nil
+	case p.accept(tokIdent, "if"):
+		if err := p.expect(tokPunct, "("); err != nil {
+			return nil, err
+		}
+		cond, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokPunct, ")"); err != nil {
+			return nil, err
+		}
+		s := &ifStmt{cond: cond}
+		if s.then, err = p.statement(); err != nil {
+			return nil, err
+		}
+		if p.accept(tokIdent, "else") {
+			if s.els, err = p.statement(); err != nil {
+				return nil, err
+			}
+		}
+		return s, nil
+	case p.accept(tokIdent, "return"):
+		s := &returnStmt{}
+		if !p.is(tokPunct, ";") && !p.is(tokPunct, "}") {
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			s.value = value
+		}
+		p.accept(tokPunct, ";")
+		return s, nil
+	case p.accept(tokIdent, "var"):
+		s := &varStmt{}
+		for {
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			var value node = &literal{}
+			if p.accept(tokPunct, "=") {
+				if value, err = p.expression(); err != nil {
+					return nil, err
+				}
+			}
+			s.names = append(s.names, name)
+			s.values = append(s.values, value)
+			if !p.accept(tokPunct, ",") {
+				break
+			}
+		}
+		p.accept(tokPunct, ";")
+		return s, nil
+	}
+	if p.peek().kind == tokIdent && p.tokens[p.pos+1].kind == tokPunct && p.tokens[p.pos+1].value == "=" {
+		name := p.next().value
+		p.next()
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		p.accept(tokPunct, ";")
+		return &assignStmt{name: name, value: value}, nil
+	}
+	expr, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	p.accept(tokPunct, ";")
+	return &exprStmt{expr: expr}, nil
+}
+
+// binaryLevels are binary operators by precedence, lowest first.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "===", "!=="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) expression() (node, error) {
+	return p.binary(0)
+}
+
+func (p *parser) binary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, o := range binaryLevels[level] {
+			if p.is(tokPunct, o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		line := p.next().line
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right, line: line}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if p.is(tokPunct, "!") || p.is(tokPunct, "-") {
+		op := p.next().value
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: op, operand: operand}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		line := p.peek().line
+		switch {
+		case p.accept(tokPunct, "("):
+			call := &callExpr{fn: expr, line: line}
+			for !p.accept(tokPunct, ")") {
+				if len(call.args) > 0 {
+					if err := p.expect(tokPunct, ","); err != nil {
+						return nil, err
+					}
+				}
+				arg, err := p.expression()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+			}
+			expr = call
+		case p.accept(tokPunct, "."):
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			expr = &memberExpr{object: expr, name: name, line: line}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokString:
+		p.next()
+		return &literal{value: t.value}, nil
+	case tokNumber:
+		p.next()
+		n, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid number %q", t.line, t.value)
+		}
+		return &literal{value: n}, nil
+	case tokIdent:
+		p.next()
+		switch t.value {
+		case "true":
+			return &literal{value: true}, nil
+		case "false":
+			return &literal{value: false}, nil
+		case "null", "undefined":
+			return &literal{}, nil
+		}
+		if unsupported[t.value] {
+			return nil, fmt.Errorf("line %d: %s is not supported", t.line, t.value)
+		}
+		return &identExpr{name: t.value, line: t.line}, nil
+	}
+	if p.accept(tokPunct, "(") {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokPunct, ")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	return nil, p.unexpected()
+}
+
+// unsupported are JavaScript keywords of statements and expressions that
+// interpreter does not support.
+var unsupported = map[string]bool{
+	"while": true, "for": true, "do": true, "switch": true, "case": true,
+	"break": true, "continue": true, "function": true, "new": true,
+	"this": true, "try": true, "catch": true, "throw": true, "delete": true,
+	"typeof": true, "instanceof": true, "in": true, "with": true,
+	"let": true, "const": true, "eval": true,
+}
+
+// builtin is function implemented in Go that scripts can call.
+type builtin func(args []interface{}) (interface{}, error)
+
+// method is string method bound to its receiver.
+type method struct {
+	receiver string
+	name     string
+}
+
+// scope holds variables of single function call, with globals as parent.
+type scope struct {
+	vars   map[string]interface{}
+	parent *scope
+}
+
+func (s *scope) lookup(name string) (interface{}, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (s *scope) assign(name string, value interface{}) {
+	for c := s; c != nil; c = c.parent {
+		if _, ok := c.vars[name]; ok {
+			c.vars[name] = value
+			return
+		}
+	}
+	// undeclared variables are global in JavaScript
+	root := s
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.vars[name] = value
+}
+
+// returnValue is used to unwind evaluation of function body on return.
+type returnValue struct {
+	value interface{}
+}
+
+// interpreter evaluates single call of script function. It is not safe
+// for concurrent use.
+type interpreter struct {
+	ctx     context.Context
+	globals *scope
+	depth   int
+	steps   int
+}
+
+// step counts single evaluation step and returns error if evaluation has
+// to stop, because it took too many steps or its context is done.
+func (in *interpreter) step() error {
+	in.steps++
+	if in.steps > maxSteps {
+		return fmt.Errorf("maximum number of evaluation steps exceeded")
+	}
+	return in.ctx.Err()
+}
+
+func (in *interpreter) call(fn interface{}, args []interface{}, line int) (interface{}, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+	switch f := fn.(type) {
+	case builtin:
+		return f(args)
+	case *method:
+		return callMethod(f, args)
+	case *closure:
+		if in.depth >= maxCallDepth {
+			return nil, fmt.Errorf("line %d: maximum call depth exceeded", line)
+		}
+		in.depth++
+		defer func() { in.depth-- }()
+		s := &scope{vars: make(map[string]interface{}), parent: in.globals}
+		for i, param := range f.decl.params {
+			var v interface{}
+			if i < len(args) {
+				v = args[i]
+			}
+			s.vars[param] = v
+		}
+		ret, err := in.execBlock(f.decl.body, s)
+		if err != nil {
+			return nil, err
+		}
+		if ret != nil {
+			return ret.value, nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("line %d: %s is not a function", line, toString(fn))
+}
+
+// closure is function declared in script.
+type closure struct {
+	decl *funcDecl
+}
+
+func (in *interpreter) execBlock(body []node, s *scope) (*returnValue, error) {
+	for _, stmt := range body {
+		ret, err := in.exec(stmt, s)
+		if err != nil || ret != nil {
+			return ret, err
+		}
+	}
+	return nil, nil
+}
+
+func (in *interpreter) exec(stmt node, s *scope) (*returnValue, error) {
+	if err := in.step(); err != nil {
+		return nil, err
+	}
+	switch n := stmt.(type) {
+	case *blockStmt:
+		return in.execBlock(n.body, s)
+	case *varStmt:
+		for i, name := range n.names {
+			v, err := in.eval(n.values[i], s)
+			if err != nil {
+				return nil, err
+			}
+			s.vars[name] = v
+		}
+	case *assignStmt:
+		v, err := in.eval(n.value, s)
+		if err != nil {
+			return nil, err
+		}
+		s.assign(n.name, v)
+	case *ifStmt:
+		cond, err := in.eval(n.cond, s)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(cond) {
+			return in.exec(n.then, s)
+		}
+		if n.els != nil {
+			return in.exec(n.els, s)
+		}
+	case *returnStmt:
+		if n.value == nil {
+			return &returnValue{}, nil
+		}
+		v, err := in.eval(n.value, s)
+		if err != nil {
+			return nil, err
+		}
+		return &returnValue{value: v}, nil
+	case *exprStmt:
+		_, err := in.eval(n.expr, s)
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (in *interpreter) eval(expr node, s *scope) (interface{}, error) {
+	switch n := expr.(type) {
+	case *literal:
+		return n.value, nil
+	case *identExpr:
+		v, ok := s.lookup(n.name)
+		if !ok {
+			return nil, fmt.Errorf("line %d: %s is not defined", n.line, n.name)
+		}
+		return v, nil
+	case *unaryExpr:
+		v, err := in.eval(n.operand, s)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			return !truthy(v), nil
+		}
+		return -toNumber(v), nil
+	case *binaryExpr:
+		return in.evalBinary(n, s)
+	case *memberExpr:
+		v, err := in.eval(n.object, s)
+		if err != nil {
+			return nil, err
+		}
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("line %d: property %s of non-string value is not supported", n.line, n.name)
+		}
+		switch n.name {
+		case "length":
+			return float64(len(str)), nil
+		case "toLowerCase", "toUpperCase", "indexOf", "substring":
+			return &method{receiver: str, name: n.name}, nil
+		}
+		return nil, fmt.Errorf("line %d: string property %s is not supported", n.line, n.name)
+	case *callExpr:
+		fn, err := in.eval(n.fn, s)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]interface{}, len(n.args))
+		for i, a := range n.args {
+			if args[i], err = in.eval(a, s); err != nil {
+				return nil, err
+			}
+		}
+		return in.call(fn, args, n.line)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+func (in *interpreter) evalBinary(n *binaryExpr, s *scope) (interface{}, error) {
+	left, err := in.eval(n.left, s)
+	if err != nil {
+		return nil, err
+	}
+	// logical operators evaluate right side only if needed and return
+	// value of one of sides
+	switch n.op {
+	case "||":
+		if truthy(left) {
+			return left, nil
+		}
+		return in.eval(n.right, s)
+	case "&&":
+		if !truthy(left) {
+			return left, nil
+		}
+		return in.eval(n.right, s)
+	}
+	right, err := in.eval(n.right, s)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return looseEqual(left, right), nil
+	case "!=":
+		return !looseEqual(left, right), nil
+	case "===":
+		return strictEqual(left, right), nil
+	case "!==":
+		return !strictEqual(left, right), nil
+	case "+":
+		_, ls := left.(string)
+		_, rs := right.(string)
+		if ls || rs {
+			l, r := toString(left), toString(right)
+			if len(l)+len(r) > maxStringLength {
+				return nil, fmt.Errorf("line %d: string longer than %d bytes", n.line, maxStringLength)
+			}
+			return l + r, nil
+		}
+		return toNumber(left) + toNumber(right), nil
+	case "-":
+		return toNumber(left) - toNumber(right), nil
+	case "*":
+		return toNumber(left) * toNumber(right), nil
+	case "/":
+		return toNumber(left) / toNumber(right), nil
+	case "%":
+		return math.Mod(toNumber(left), toNumber(right)), nil
+	}
+	// relational operators compare strings as strings and everything
+	// else as numbers
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	var cmp int
+	if lok && rok {
+		cmp = strings.Compare(ls, rs)
+	} else {
+		l, r := toNumber(left), toNumber(right)
+		if math.IsNaN(l) || math.IsNaN(r) {
+			return false, nil
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func callMethod(m *method, args []interface{}) (interface{}, error) {
+	switch m.name {
+	case "toLowerCase":
+		return strings.ToLower(m.receiver), nil
+	case "toUpperCase":
+		return strings.ToUpper(m.receiver), nil
+	case "indexOf":
+		if len(args) == 0 {
+			return float64(-1), nil
+		}
+		return float64(strings.Index(m.receiver, toString(args[0]))), nil
+	}
+	// substring
+	start, end := 0, len(m.receiver)
+	if len(args) > 0 {
+		start = clamp(toNumber(args[0]), len(m.receiver))
+	}
+	if len(args) > 1 {
+		end = clamp(toNumber(args[1]), len(m.receiver))
+	}
+	if start > end {
+		start, end = end, start
+	}
+	return m.receiver[start:end], nil
+}
+
+func clamp(f float64, max int) int {
+	if math.IsNaN(f) || f < 0 {
+		return 0
+	}
+	if f > float64(max) {
+		return max
+	}
+	return int(f)
+}
+
+func truthy(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case float64:
+		return x != 0 && !math.IsNaN(x)
+	case string:
+		return x != ""
+	}
+	return true
+}
+
+func toNumber(v interface{}) float64 {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if x {
+			return 1
+		}
+		return 0
+	case float64:
+		return x
+	case string:
+		if strings.TrimSpace(x) == "" {
+			return 0
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	}
+	return math.NaN()
+}
+
+func toString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case string:
+		return x
+	case *closure:
+		return "function " + x.decl.name
+	}
+	return "function"
+}
+
+func looseEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return as == bs
+	}
+	ab, aok := a.(bool)
+	bb, bok := b.(bool)
+	if aok && bok {
+		return ab == bb
+	}
+	switch a.(type) {
+	case string, bool, float64:
+	default:
+		return strictEqual(a, b)
+	}
+	return toNumber(a) == toNumber(b)
+}
+
+// strictEqual compares values without conversions. Functions are equal
+// only if they are same script function.
+func strictEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	case float64:
+		y, ok := b.(float64)
+		return ok && x == y
+	case *closure:
+		y, ok := b.(*closure)
+		return ok && x == y
+	}
+	return false
+}
@@ -0,0 +1,437 @@
+// Package proxy routes requests of gwc clients through proxies.
+//
+// Proxies selects proxy for every request using, in order: NO_PROXY style
+// exclusions, per-host rules, PAC file and default proxies for URL scheme.
+// Selected proxy can be HTTP proxy (plain requests are forwarded and HTTPS
+// requests are tunneled with CONNECT), HTTP proxy reached over TLS or
+// SOCKS5 proxy. Credentials can be given in proxy URL or set with Auth,
+// which is useful for proxies returned by PAC files.
+//
+//	p := proxy.New().
+//		FromEnvironment().
+//		Host("*.internal.example.com", "DIRECT").
+//		Auth("proxy.example.com:3128", "user", "secret")
+//	client, err := p.Client(nil)
+//	if err != nil {
+//		// handle error
+//	}
+//	c := gwc.New(client)
+//
+// Proxy that was selected for request can be obtained with Selected, for
+// debugging.
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/delicb/gwc/internal/wrap"
+)
+
+// direct is target of rules that do not use proxy.
+const direct = "DIRECT"
+
+// rule routes requests to matching hosts through proxy. Proxy is nil for
+// direct connections.
+type rule struct {
+	pattern string
+	proxy   *url.URL
+}
+
+// Proxies selects proxy for requests. It should be fully configured before
+// it is used to create clients.
+type Proxies struct {
+	noProxy  []*noProxyEntry
+	rules    []*rule
+	pac      *PAC
+	schemes  map[string]*url.URL
+	fallback *url.URL
+	auth     map[string]*url.Userinfo
+	onSelect func(req *http.Request, proxy *url.URL)
+	err      error
+}
+
+// New creates and returns Proxies that connect directly until configured
+// otherwise.
+func New() *Proxies {
+	return &Proxies{
+		schemes: make(map[string]*url.URL),
+		auth:    make(map[string]*url.Userinfo),
+	}
+}
+
+// parseProxy parses proxy URL. URL without scheme is HTTP proxy and
+// "DIRECT" means that proxy is not used.
+func parseProxy(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.EqualFold(raw, direct) {
+		return nil, nil
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: invalid proxy URL %q: %v", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy: unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy: proxy URL %q has no host", raw)
+	}
+	return u, nil
+}
+
+// setErr remembers first configuration error, which is returned when
+// Proxies is used.
+func (p *Proxies) setErr(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// Default sets proxy used for requests that are not matched by any other
+// rule, regardless of their scheme.
+func (p *Proxies) Default(rawURL string) *Proxies {
+	u, err := parseProxy(rawURL)
+	if err != nil {
+		p.setErr(err)
+		return p
+	}
+	p.fallback = u
+	return p
+}
+
+// Scheme sets proxy used for requests with provided URL scheme that are not
+// matched by any other rule. Empty URL removes proxy for scheme.
+func (p *Proxies) Scheme(scheme, rawURL string) *Proxies {
+	if rawURL == "" {
+		delete(p.schemes, scheme)
+		return p
+	}
+	u, err := parseProxy(rawURL)
+	if err != nil {
+		p.setErr(err)
+		return p
+	}
+	p.schemes[scheme] = u
+	return p
+}
+
+// Host routes requests to hosts that match provided pattern through
+// provided proxy, or directly if proxy is "DIRECT". Pattern is host name,
+// where "*." prefix matches all subdomains, or "*" which matches all hosts.
+// Rules are checked in order in which they are added.
+func (p *Proxies) Host(pattern, rawURL string) *Proxies {
+	u, err := parseProxy(rawURL)
+	if err != nil {
+		p.setErr(err)
+		return p
+	}
+	p.rules = append(p.rules, &rule{pattern: strings.ToLower(pattern), proxy: u})
+	return p
+}
+
+// NoProxy excludes hosts from proxying, using same format as NO_PROXY
+// environment variable: comma separated list of host names (matching
+// domain and its subdomains, or only subdomains if name starts with "."),
+// IP addresses and CIDR networks, optionally with port. Single "*"
+// excludes all hosts.
+func (p *Proxies) NoProxy(noProxy string) *Proxies {
+	p.noProxy = append(p.noProxy, parseNoProxy(noProxy)...)
+	return p
+}
+
+// PAC sets PAC file used to select proxy for requests that are not
+// excluded or matched by host rules. First supported proxy from result of
+// script is used, without failing over to next ones, and request is sent
+// directly if there is none.
+func (p *Proxies) PAC(pac *PAC) *Proxies {
+	p.pac = pac
+	return p
+}
+
+// FromEnvironment sets proxies from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables (or their lowercase versions). Same as
+// http.ProxyFromEnvironment, requests to localhost and loopback addresses
+// are never proxied.
+func (p *Proxies) FromEnvironment() *Proxies {
+	if v := getenv("HTTP_PROXY"); v != "" {
+		p.Scheme("http", v)
+	}
+	if v := getenv("HTTPS_PROXY"); v != "" {
+		p.Scheme("https", v)
+	}
+	p.NoProxy("localhost,127.0.0.0/8,::1")
+	p.NoProxy(getenv("NO_PROXY"))
+	return p
+}
+
+func getenv(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+// Auth sets credentials for proxy with provided host (including port).
+// They are used unless proxy URL has its own.
+func (p *Proxies) Auth(proxyHost, username, password string) *Proxies {
+	p.auth[strings.ToLower(proxyHost)] = url.UserPassword(username, password)
+	return p
+}
+
+// OnSelect sets function that is called with every request and proxy
+// selected for it (nil for direct connection), which can be used for
+// logging.
+func (p *Proxies) OnSelect(onSelect func(req *http.Request, proxy *url.URL)) *Proxies {
+	p.onSelect = onSelect
+	return p
+}
+
+// Proxy returns proxy for provided request, or nil if request should not
+// use proxy. It has signature of http.Transport.Proxy.
+func (p *Proxies) Proxy(req *http.Request) (*url.URL, error) {
+	u, err := p.selectProxy(req)
+	if err != nil {
+		return nil, err
+	}
+	if u != nil && u.User == nil {
+		if user, ok := p.auth[strings.ToLower(u.Host)]; ok {
+			withAuth := *u
+			withAuth.User = user
+			u = &withAuth
+		}
+	}
+	if s, ok := req.Context().Value(selectionKey).(*selection); ok {
+		s.set(u)
+	}
+	if p.onSelect != nil {
+		p.onSelect(req, redact(u))
+	}
+	return u, nil
+}
+
+func (p *Proxies) selectProxy(req *http.Request) (*url.URL, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	host := strings.ToLower(req.URL.Hostname())
+	port := req.URL.Port()
+	if port == "" {
+		port = defaultPorts[req.URL.Scheme]
+	}
+	if matchNoProxy(p.noProxy, host, port) {
+		return nil, nil
+	}
+	for _, r := range p.rules {
+		if matchHost(r.pattern, host) {
+			return r.proxy, nil
+		}
+	}
+	if p.pac != nil {
+		return p.pac.proxy(req.Context(), req.URL)
+	}
+	if u, ok := p.schemes[req.URL.Scheme]; ok {
+		return u, nil
+	}
+	return p.fallback, nil
+}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// matchHost returns true if host matches pattern of host rule.
+func matchHost(pattern, host string) bool {
+	if pattern == "*" || pattern == host {
+		return true
+	}
+	return strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])
+}
+
+// Transport returns copy of provided transport (or of
+// http.DefaultTransport if nil) that uses these proxies.
+func (p *Proxies) Transport(t *http.Transport) (*http.Transport, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if t == nil {
+		t = http.DefaultTransport.(*http.Transport)
+	}
+	t = t.Clone()
+	t.Proxy = p.Proxy
+	return t, nil
+}
+
+// Client returns copy of provided client (or of empty client if nil) that
+// uses these proxies. Transport of provided client has to be
+// *http.Transport (or nil) or transport of client created by trust or ssrf
+// package, otherwise error is returned. Clients created by ssrf package
+// always connect directly, so proxies are not used by them. Unlike
+// transport returned by Transport, returned client records proxy selected
+// for each request, see Selected.
+func (p *Proxies) Client(client *http.Client) (*http.Client, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	t, rewrap, ok := wrap.Unwrap(client.Transport)
+	if !ok {
+		return nil, fmt.Errorf("proxy: transport of type %T can not be configured, *http.Transport is required", client.Transport)
+	}
+	t, err := p.Transport(t)
+	if err != nil {
+		return nil, err
+	}
+	configured := *client
+	configured.Transport = &transport{next: rewrap(t)}
+	return &configured, nil
+}
+
+type selectionKeyType string
+
+var selectionKey selectionKeyType = "proxy-selection"
+
+// selection holds proxy selected for request.
+type selection struct {
+	mu       sync.Mutex
+	proxy    *url.URL
+	selected bool
+}
+
+func (s *selection) set(proxy *url.URL) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxy = proxy
+	s.selected = true
+}
+
+// transport records proxy selected for each request.
+type transport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip is implementation of http.RoundTripper interface.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), selectionKey, &selection{})
+	return t.next.RoundTrip(req.WithContext(ctx))
+}
+
+// CloseIdleConnections closes idle connections of underlying transport.
+func (t *transport) CloseIdleConnections() {
+	wrap.CloseIdleConnections(t.next)
+}
+
+// Unwrap is implementation of wrap.Wrapper interface.
+func (t *transport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// Wrap is implementation of wrap.Wrapper interface.
+func (t *transport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &transport{next: next}
+}
+
+// Selected returns proxy that was selected for request sent by client
+// created with Proxies.Client, usually taken from http.Response.Request.
+// Returned proxy is nil for direct connection, and ok is false if
+// selection is unknown. Password is removed from returned URL.
+func Selected(req *http.Request) (proxy *url.URL, ok bool) {
+	s, found := req.Context().Value(selectionKey).(*selection)
+	if !found {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return redact(s.proxy), s.selected
+}
+
+// redact returns copy of URL without password.
+func redact(u *url.URL) *url.URL {
+	if u == nil || u.User == nil {
+		return u
+	}
+	c := *u
+	c.User = url.User(u.User.Username())
+	return &c
+}
+
+// noProxyEntry is single entry of NO_PROXY list.
+type noProxyEntry struct {
+	all    bool
+	domain string
+	// subdomains is true if entry matches only subdomains of domain
+	subdomains bool
+	network    *net.IPNet
+	ip         net.IP
+	port       string
+}
+
+func parseNoProxy(noProxy string) []*noProxyEntry {
+	var entries []*noProxyEntry
+	for _, raw := range strings.FieldsFunc(noProxy, func(r rune) bool { return r == ',' || r == ' ' }) {
+		raw = strings.ToLower(strings.TrimSpace(raw))
+		if raw == "*" {
+			entries = append(entries, &noProxyEntry{all: true})
+			continue
+		}
+		if _, network, err := net.ParseCIDR(raw); err == nil {
+			entries = append(entries, &noProxyEntry{network: network})
+			continue
+		}
+		e := &noProxyEntry{}
+		if host, port, err := net.SplitHostPort(raw); err == nil {
+			raw, e.port = host, port
+		}
+		if ip := net.ParseIP(raw); ip != nil {
+			e.ip = ip
+			entries = append(entries, e)
+			continue
+		}
+		if strings.HasPrefix(raw, "*.") {
+			raw = raw[1:]
+		}
+		if strings.HasPrefix(raw, ".") {
+			e.subdomains = true
+			raw = raw[1:]
+		}
+		e.domain = raw
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// matchNoProxy returns true if host and port match any of entries.
+func matchNoProxy(entries []*noProxyEntry, host, port string) bool {
+	ip := net.ParseIP(host)
+	for _, e := range entries {
+		if e.all {
+			return true
+		}
+		if e.port != "" && e.port != port {
+			continue
+		}
+		switch {
+		case e.network != nil:
+			if ip != nil && e.network.Contains(ip) {
+				return true
+			}
+		case e.ip != nil:
+			if ip != nil && e.ip.Equal(ip) {
+				return true
+			}
+		case e.domain != "":
+			if strings.HasSuffix(host, "."+e.domain) || (!e.subdomains && host == e.domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,430 @@
+package proxy_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/proxy"
+	"github.com/delicb/gwc/trust"
+)
+
+// newHTTPProxy starts HTTP proxy that forwards plain requests by
+// responding itself and tunnels CONNECT requests. It requires provided
+// credentials, if they are not empty.
+func newHTTPProxy(t *testing.T, username, password string) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var seen []string
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username != "" && r.Header.Get("Proxy-Authorization") != expected {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.Host)
+		mu.Unlock()
+		if r.Method != http.MethodConnect {
+			w.Write([]byte("proxied " + r.URL.String()))
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		pipe(conn, target)
+	}))
+	return server, &seen
+}
+
+// pipe copies data between connections until one of them is closed.
+func pipe(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+	}()
+	io.Copy(b, a)
+	b.Close()
+}
+
+// newSOCKS5Proxy starts SOCKS5 proxy that requires provided credentials.
+func newSOCKS5Proxy(t *testing.T, username, password string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS5(conn, username, password)
+		}
+	}()
+	return l
+}
+
+func serveSOCKS5(conn net.Conn, username, password string) {
+	defer conn.Close()
+	buf := make([]byte, 262)
+	// greeting: version, number of methods, methods
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 2})
+	// username and password authentication
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	user := make([]byte, buf[1])
+	io.ReadFull(conn, user)
+	io.ReadFull(conn, buf[:1])
+	pass := make([]byte, buf[0])
+	io.ReadFull(conn, pass)
+	if string(user) != username || string(pass) != password {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+	// connect request: version, command, reserved, address type
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	var host string
+	switch buf[3] {
+	case 1:
+		io.ReadFull(conn, buf[:4])
+		host = net.IP(buf[:4]).String()
+	case 3:
+		io.ReadFull(conn, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	io.ReadFull(conn, buf[:2])
+	port := binary.BigEndian.Uint16(buf[:2])
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	pipe(conn, target)
+}
+
+func send(t *testing.T, p *proxy.Proxies, base *http.Client, rawURL string) (*gwc.Response, string) {
+	client, err := p.Client(base)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	resp, err := gwc.New(client).Get().URL(rawURL).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	body, err := resp.String()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	return resp, body
+}
+
+func TestHTTPProxy(t *testing.T) {
+	server, _ := newHTTPProxy(t, "user", "secret")
+	defer server.Close()
+	proxyURL, _ := url.Parse(server.URL)
+
+	p := proxy.New().Default(server.URL).Auth(proxyURL.Host, "user", "secret")
+	resp, body := send(t, p, nil, "http://service.invalid/path")
+	if body != "proxied http://service.invalid/path" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "proxied http://service.invalid/path")
+	}
+	selected, ok := proxy.Selected(resp.Request)
+	if !ok || selected == nil {
+		t.Fatal("Selected proxy not recorded.")
+	}
+	if selected.Host != proxyURL.Host || selected.User.Username() != "user" {
+		t.Errorf("Wrong selected proxy. Got: %s, expected: %s", selected, proxyURL.Host)
+	}
+	if _, hasPassword := selected.User.Password(); hasPassword {
+		t.Error("Password not removed from selected proxy.")
+	}
+
+	// credentials in URL
+	withUser := "http://user:secret@" + proxyURL.Host
+	if _, body := send(t, proxy.New().Default(withUser), nil, "http://service.invalid/"); body != "proxied http://service.invalid/" {
+		t.Errorf("Wrong body. Got: %s", body)
+	}
+}
+
+func TestHTTPProxy_Connect(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer target.Close()
+	server, seen := newHTTPProxy(t, "", "")
+	defer server.Close()
+
+	base := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	_, body := send(t, proxy.New().Default(server.URL), base, target.URL)
+	if body != "secure" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "secure")
+	}
+	targetURL, _ := url.Parse(target.URL)
+	if len(*seen) != 1 || (*seen)[0] != "CONNECT "+targetURL.Host {
+		t.Errorf("Request not tunneled. Got: %v", *seen)
+	}
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer target.Close()
+	l := newSOCKS5Proxy(t, "user", "secret")
+	defer l.Close()
+
+	p := proxy.New().Default("socks5://"+l.Addr().String()).Auth(l.Addr().String(), "user", "secret")
+	resp, body := send(t, p, nil, target.URL)
+	if body != "ok" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "ok")
+	}
+	if selected, _ := proxy.Selected(resp.Request); selected == nil || selected.Scheme != "socks5" {
+		t.Errorf("Wrong selected proxy. Got: %v", selected)
+	}
+}
+
+func TestProxies_Rules(t *testing.T) {
+	p := proxy.New().
+		NoProxy("internal.example.com, .corp.example.com,10.0.0.0/8,192.168.1.1,example.net:8080").
+		Host("*.special.example.com", "special:3128").
+		Host("direct.example.com", "DIRECT").
+		Scheme("https", "secure:3128").
+		Default("fallback:3128")
+
+	for _, data := range []struct {
+		URL   string
+		Proxy string
+	}{
+		{"http://internal.example.com/", ""},
+		{"http://api.internal.example.com/", ""},
+		{"http://corp.example.com/", "http://fallback:3128"},
+		{"http://a.corp.example.com/", ""},
+		{"http://10.1.2.3/", ""},
+		{"http://192.168.1.1/", ""},
+		{"http://192.168.1.2/", "http://fallback:3128"},
+		{"http://example.net:8080/", ""},
+		{"http://example.net/", "http://fallback:3128"},
+		{"http://a.special.example.com/", "http://special:3128"},
+		{"http://direct.example.com/", ""},
+		{"https://example.org/", "http://secure:3128"},
+		{"http://example.org/", "http://fallback:3128"},
+	} {
+		req, _ := http.NewRequest("GET", data.URL, nil)
+		u, err := p.Proxy(req)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != data.Proxy {
+			t.Errorf("Wrong proxy for %s. Got: %s, expected: %s", data.URL, got, data.Proxy)
+		}
+	}
+
+	if _, err := proxy.New().Default("ftp://proxy").Client(nil); err == nil {
+		t.Error("Expected error for unsupported proxy scheme.")
+	}
+}
+
+func TestProxies_FromEnvironment(t *testing.T) {
+	for name, value := range map[string]string{
+		"HTTP_PROXY":  "http://env-proxy:3128",
+		"HTTPS_PROXY": "",
+		"https_proxy": "https://secure-proxy:3129",
+		"NO_PROXY":    "skip.example.com",
+	} {
+		old, set := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if set {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	p := proxy.New().FromEnvironment()
+	for _, data := range []struct {
+		URL   string
+		Proxy string
+	}{
+		{"http://example.com/", "http://env-proxy:3128"},
+		{"https://example.com/", "https://secure-proxy:3129"},
+		{"http://skip.example.com/", ""},
+		{"http://localhost:8080/", ""},
+		{"http://127.0.0.1/", ""},
+	} {
+		req, _ := http.NewRequest("GET", data.URL, nil)
+		u, _ := p.Proxy(req)
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != data.Proxy {
+			t.Errorf("Wrong proxy for %s. Got: %s, expected: %s", data.URL, got, data.Proxy)
+		}
+	}
+}
+
+func TestProxies_PAC(t *testing.T) {
+	server, _ := newHTTPProxy(t, "", "")
+	defer server.Close()
+	proxyURL, _ := url.Parse(server.URL)
+
+	pac, err := proxy.ParsePAC(`
+		function FindProxyForURL(url, host) {
+			if (dnsDomainIs(host, ".invalid"))
+				return "PROXY ` + proxyURL.Host + `; DIRECT";
+			return "DIRECT";
+		}`)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	var mu sync.Mutex
+	var logged []string
+	p := proxy.New().PAC(pac).OnSelect(func(req *http.Request, proxy *url.URL) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, req.URL.Host+" "+proxy.String())
+	})
+	_, body := send(t, p, nil, "http://service.invalid/")
+	if body != "proxied http://service.invalid/" {
+		t.Errorf("Wrong body. Got: %s", body)
+	}
+	if len(logged) != 1 || logged[0] != "service.invalid http://"+proxyURL.Host {
+		t.Errorf("Wrong selection logged. Got: %v", logged)
+	}
+}
+
+// newLocalhostServer starts TLS server with self signed certificate for
+// localhost and returns it with PEM encoded certificate. Certificate of
+// httptest server is valid for IP address, which is not known when TLS
+// connection through proxy is verified.
+func newLocalhostServer(t *testing.T, handler http.Handler) (*httptest.Server, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	return server, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestProxies_Trust(t *testing.T) {
+	target, rootsPEM := newLocalhostServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer target.Close()
+	targetURL, _ := url.Parse(target.URL)
+	targetURL.Host = "localhost:" + targetURL.Port()
+	server, seen := newHTTPProxy(t, "", "")
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "proxy")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	defer os.RemoveAll(dir)
+	roots := filepath.Join(dir, "roots.pem")
+	if err := ioutil.WriteFile(roots, rootsPEM, 0600); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	p := proxy.New().Default(server.URL)
+	cfg := trust.New().RootCAs(roots)
+
+	// both orders of configuration give client that uses proxy and trusts
+	// configured roots
+	proxyClient, err := p.Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	trustClient, err := cfg.Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for i, configure := range []func() (*http.Client, error){
+		func() (*http.Client, error) { return cfg.Client(proxyClient) },
+		func() (*http.Client, error) { return p.Client(trustClient) },
+	} {
+		client, err := configure()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		resp, err := gwc.New(client).Get().URL(targetURL.String()).Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		if body, _ := resp.String(); body != "secure" {
+			t.Errorf("Wrong body. Got: %s, expected: %s", body, "secure")
+		}
+		if selected, ok := proxy.Selected(resp.Request); !ok || selected == nil {
+			t.Error("Selected proxy not recorded.")
+		}
+		if len(*seen) != i+1 {
+			t.Errorf("Request not tunneled. Got: %v", *seen)
+		}
+	}
+
+	// without trust configuration, certificate of server is not trusted
+	resp, err := gwc.New(proxyClient).Get().URL(targetURL.String()).Send()
+	if err == nil {
+		resp.Body.Close()
+		t.Error("Expected error for untrusted certificate without trust configuration.")
+	}
+}
@@ -2,6 +2,8 @@ package gwc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/delicb/cliware"
@@ -11,6 +13,9 @@ import (
 	"github.com/delicb/cliware-middlewares/headers"
 	"github.com/delicb/cliware-middlewares/query"
 	cwurl "github.com/delicb/cliware-middlewares/url"
+
+	"github.com/delicb/gwc/idempotency"
+	"github.com/delicb/gwc/jsonschema"
 )
 
 // Request is struct used to hold information (mostly middlewares) used
@@ -44,6 +49,17 @@ func (r *Request) SetContext(ctx context.Context) *Request {
 	return r
 }
 
+// copy returns copy of request with provided context, so it can be sent
+// without changing original request.
+func (r *Request) copy(ctx context.Context) *Request {
+	return &Request{
+		Client:  r.Client,
+		before:  r.before.Copy(),
+		after:   r.after.Copy(),
+		context: ctx,
+	}
+}
+
 // Use adds provided middleware to this request middleware chain.
 func (r *Request) Use(m ...cliware.Middleware) *Request {
 	r.before.Use(m...)
@@ -65,14 +81,50 @@ func (r *Request) Method(method string) *Request {
 }
 
 // URL parses and sets URL for this request.
+// If enabled with Client.UnixURLs, URLs of HTTP servers listening on Unix
+// sockets are supported in form
+// unix:///var/run/docker.sock:/v1.41/containers/json, where socket path is
+// followed by colon and URL path, which starts with slash.
 func (r *Request) URL(rawURL string) *Request {
+	if isUnixURL(rawURL) {
+		r.Use(r.Client.unixURL(rawURL, cwurl.URL))
+		return r
+	}
 	r.Use(cwurl.URL(rawURL))
 	return r
 }
 
 // BaseURL sets schema and host from provided URL to this request.
-func (r *Request) BaseURL(rawURL string) *Request {
+// If fallback URLs are provided, request is sent to them, in order, when
+// sending to previous one fails with connection error. Base URL that failed
+// is skipped by all requests of the same client for failover.DefaultCooldown.
+// For more control (like failing over on status codes) use failover package
+// directly.
+// If enabled with Client.UnixURLs, base URL can also be path of Unix socket,
+// like unix:///var/run/docker.sock, but then fallbacks are not supported.
+func (r *Request) BaseURL(rawURL string, fallbacks ...string) *Request {
+	if isUnixURL(rawURL) {
+		if len(fallbacks) > 0 {
+			r.Use(cliware.RequestProcessor(func(*http.Request) error {
+				return fmt.Errorf("gwc: fallbacks are not supported for Unix socket base URL %s", rawURL)
+			}))
+			return r
+		}
+		r.Use(r.Client.unixURL(rawURL, cwurl.BaseURL))
+		return r
+	}
 	r.Use(cwurl.BaseURL(rawURL))
+	if len(fallbacks) == 0 {
+		return r
+	}
+	f, err := r.Client.failover(append([]string{rawURL}, fallbacks...))
+	if err != nil {
+		r.Use(cliware.RequestProcessor(func(*http.Request) error {
+			return err
+		}))
+		return r
+	}
+	r.Use(f)
 	return r
 }
 
@@ -154,28 +206,129 @@ func (r *Request) SetCookie(key, value string) *Request {
 	return r
 }
 
+// Idempotent sets Idempotency-Key header with newly generated key to this
+// request. Key is generated once per Send call and is preserved across
+// retries, which are allowed for this request regardless of its method.
+func (r *Request) Idempotent() *Request {
+	_, generator := r.Client.idempotencySettings()
+	r.Use(idempotency.Generate(generator))
+	return r
+}
+
+// IdempotencyKey sets provided key as Idempotency-Key header to this request
+// and allows retries of this request regardless of its method.
+func (r *Request) IdempotencyKey(key string) *Request {
+	r.Use(idempotency.Key(key))
+	return r
+}
+
+// IdempotentOperation sets Idempotency-Key header to key of operation with
+// provided ID. Key is loaded from client's idempotency store or generated
+// and saved to it if there is none, so operation can be resumed with same
+// key until it succeeds.
+func (r *Request) IdempotentOperation(operation string) *Request {
+	_, generator := r.Client.idempotencySettings()
+	r.Use(idempotency.Operation(r.Client.idempotencyKeyStore(), generator, operation))
+	return r
+}
+
 // BodyJSON adds provided data to request as JSON encoded body.
 func (r *Request) BodyJSON(data interface{}) *Request {
 	r.Use(body.JSON(data))
 	return r
 }
 
+// ResponseSchema sets JSON Schema against which response body is validated
+// when it is decoded with Response.JSON.
+func (r *Request) ResponseSchema(schema *jsonschema.Schema) *Request {
+	r.Use(ResponseSchema(schema))
+	return r
+}
+
+// JSONDecoding sets options used by Response.JSON to decode response body.
+func (r *Request) JSONDecoding(options ...JSONOption) *Request {
+	r.Use(JSONDecoding(options...))
+	return r
+}
+
+// MaxResponseBytes limits size of response body read by this request. See
+// MaxResponseBytes middleware for details.
+func (r *Request) MaxResponseBytes(n int64) *Request {
+	r.Use(MaxResponseBytes(n))
+	return r
+}
+
+// UnixSocket sends this request to HTTP server listening on Unix socket with
+// provided path. URL, BaseURL and Path still set URL of request.
+func (r *Request) UnixSocket(path string) *Request {
+	r.Use(UnixSocket(path))
+	return r
+}
+
+// MaxCompressionRatio limits how much compressed response body of this
+// request can expand. See MaxCompressionRatio middleware for details.
+func (r *Request) MaxCompressionRatio(ratio float64) *Request {
+	r.Use(MaxCompressionRatio(ratio))
+	return r
+}
+
 // sendRequest is private method that does actual request dispatching.
 func (r *Request) sendRequest(req *http.Request) (*http.Response, error) {
 	return r.Client.client.Do(req)
 }
 
+// chain returns middleware chain that contains all middlewares defined for
+// this request, followed by middlewares that are executed after them.
+func (r *Request) chain() *cliware.Chain {
+	return cliware.NewChain(r.before, r.after)
+}
+
+// prepareContext returns context that should be attached to HTTP request
+// built from this request.
+func (r *Request) prepareContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = r.context
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return clientToContext(ctx, r.Client.client)
+}
+
+// errDryRun is returned by final handler used by Build to stop request
+// from being sent.
+var errDryRun = errors.New("gwc: dry run, request not sent")
+
+// Build executes all defined middlewares and returns HTTP request as it would
+// be sent, without actually sending it. Middlewares that process responses
+// are executed as well, but they get errDryRun error instead of response.
+// If provided context is nil, context set via SetContext (or
+// context.Background()) is used.
+func (r *Request) Build(ctx context.Context) (*http.Request, error) {
+	var built *http.Request
+	builder := r.chain().Exec(cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		built = req
+		return nil, errDryRun
+	}))
+
+	req := cliware.EmptyRequest().WithContext(r.prepareContext(ctx))
+	_, err := builder.Handle(req)
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	if built == nil {
+		return nil, errors.New("gwc: request was not built, middleware did not call next handler")
+	}
+	return built, nil
+}
+
 // Send constructs and sends HTTP request.
 // This method uses all defined middlewares and client defined in requests
 // to construct HTTP request.
 func (r *Request) Send() (*Response, error) {
-	r.before.Use(r.after)
-	sender := r.before.Exec(cliware.HandlerFunc(r.sendRequest))
+	sender := r.chain().Exec(cliware.HandlerFunc(r.sendRequest))
 
-	if r.context == nil {
-		r.context = context.Background()
-	}
-	r.context = clientToContext(r.context, r.Client.client)
+	r.context = r.prepareContext(r.context)
 	req := cliware.EmptyRequest().WithContext(r.context)
 	resp, err := sender.Handle(req)
 	return BuildResponse(resp, err), err
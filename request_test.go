@@ -1,7 +1,10 @@
 package gwc_test
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
 	"testing"
 
 	"context"
@@ -402,3 +405,142 @@ func TestRequest_SetQueryParams(t *testing.T) {
 		}
 	}
 }
+
+func TestRequest_Build(t *testing.T) {
+	transport := newMockTransport(200)
+	client := gwc.New(&http.Client{Transport: transport})
+	postMiddleware := &mockMiddleware{}
+	client.UsePost(postMiddleware)
+	req := client.Post().
+		URL("https://example.com/users/:id").
+		Param("id", "42").
+		SetHeader("X-Test", "value")
+
+	built, err := req.Build(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if transport.called {
+		t.Error("Request was sent by Build.")
+	}
+	if !postMiddleware.called {
+		t.Error("Middleware from after chain not called.")
+	}
+	if built.Method != "POST" {
+		t.Errorf("Wrong request method. Got: %s, expected: POST", built.Method)
+	}
+	if got := built.URL.String(); got != "https://example.com/users/42" {
+		t.Errorf("Wrong request URL. Got: %s, expected: https://example.com/users/42", got)
+	}
+	if got := built.Header.Get("X-Test"); got != "value" {
+		t.Errorf("Wrong header value. Got: %s, expected: value", got)
+	}
+	if gwc.ClientFromContext(built.Context()) == nil {
+		t.Error("Client not set on built request context.")
+	}
+}
+
+func TestRequest_BuildContext(t *testing.T) {
+	client := gwc.New(dummyClient())
+	ctx := context.WithValue(context.Background(), "key", "value")
+	built, err := client.Get().Build(ctx)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if got := built.Context().Value("key"); got != "value" {
+		t.Errorf("Wrong context value. Got: %s, expected: value", got)
+	}
+}
+
+func TestRequest_BuildError(t *testing.T) {
+	client := gwc.New(dummyClient())
+	expected := errors.New("middleware error")
+	req := client.Get().UseFunc(func(next cliware.Handler) cliware.Handler {
+		return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, expected
+		})
+	})
+	built, err := req.Build(nil)
+	if err != expected {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, expected)
+	}
+	if built != nil {
+		t.Error("Got non-nil request on error.")
+	}
+}
+
+func TestRequest_BuildWrappedError(t *testing.T) {
+	client := gwc.New(dummyClient())
+	client.UsePostFunc(func(next cliware.Handler) cliware.Handler {
+		return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Handle(req)
+			if err != nil {
+				return nil, fmt.Errorf("wrapped: %w", err)
+			}
+			return resp, nil
+		})
+	})
+	built, err := client.Get().URL("http://example.com/").Build(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if built == nil {
+		t.Error("Got nil request.")
+	}
+}
+
+func TestRequest_BuildThenSend(t *testing.T) {
+	client := gwc.New(dummyClient())
+	countingMiddleware := &mockMiddleware{}
+	client.UsePost(countingMiddleware)
+	req := client.Get()
+	if _, err := req.Build(nil); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if _, err := req.Send(); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if countingMiddleware.count != 2 {
+		t.Errorf("Wrong number of middleware calls. Got: %d, expected: 2", countingMiddleware.count)
+	}
+}
+
+func TestRequest_BaseURLFallback(t *testing.T) {
+	var hosts []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		hosts = append(hosts, req.URL.Host)
+		if req.URL.Host == "primary.example.com" {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: 200, Request: req}, nil
+	})
+	client := gwc.New(&http.Client{Transport: transport})
+	for i := 0; i < 2; i++ {
+		_, err := client.Post().BaseURL("https://primary.example.com", "https://secondary.example.com").Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+	}
+	expected := []string{"primary.example.com", "secondary.example.com", "secondary.example.com"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("Wrong hosts. Got: %v, expected: %v", hosts, expected)
+	}
+}
+
+func TestRequest_IdempotentOperation(t *testing.T) {
+	var keys []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		keys = append(keys, req.Header.Get("Idempotency-Key"))
+		return &http.Response{StatusCode: 500, Request: req}, nil
+	})
+	client := gwc.New(&http.Client{Transport: transport})
+	client.Post().IdempotentOperation("op").Send()
+	client.Post().IdempotentOperation("op").Send()
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Operation key not reused: %v", keys)
+	}
+	client.Post().IdempotencyKey("explicit").Send()
+	if keys[2] != "explicit" {
+		t.Errorf("Wrong idempotency key. Got: %s, expected: explicit", keys[2])
+	}
+}
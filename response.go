@@ -2,12 +2,13 @@ package gwc
 
 import (
 	"bytes"
-	"encoding/json"
 	"io"
 	"net/http"
 	"os"
 
 	"encoding/xml"
+
+	"github.com/delicb/gwc/jsonschema"
 )
 
 // Response is thin wrapper around http.Response that provides some
@@ -26,39 +27,158 @@ func BuildResponse(rawResponse *http.Response, err error) *Response {
 }
 
 // SaveToFile writes response content to file with provided path.
+// If response body is larger than limit set with MaxResponseBytes, file is
+// removed and *BodyTooLargeError is returned.
 func (r *Response) SaveToFile(filename string) error {
 	if r.Error != nil {
 		return r.Error
 	}
+	defer r.Body.Close()
+	limit := r.maxResponseBytes()
+	if limit > 0 && r.ContentLength > limit {
+		return &BodyTooLargeError{Limit: limit}
+	}
 
 	fd, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
-	defer fd.Close()
-	defer r.Body.Close()
 
-	_, err = io.Copy(fd, r.Body)
-	if err != nil && err != io.EOF {
-		return err
+	var body io.Reader = r.Body
+	if limit > 0 {
+		body = io.LimitReader(r.Body, limit+1)
 	}
-	return nil
+	n, err := io.Copy(fd, body)
+	if err == nil && limit > 0 && n > limit {
+		err = &BodyTooLargeError{Limit: limit}
+	}
+	// file is closed once and error of closing it is returned, since
+	// written data may not be saved if closing fails
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil && limit > 0 {
+		os.Remove(filename)
+	}
+	return err
 }
 
 // JSON decodes response body to provided structure from JSON format.
-func (r *Response) JSON(userStruct interface{}) error {
+// Decoding is configured by options set with JSONDecoding middleware and
+// provided options, which are applied last. Empty body is reported as
+// ErrEmptyBody and malformed body as *DecodeError.
+// If JSON Schema is set for request with ResponseSchema, body is validated
+// against it first, see ValidateJSON.
+func (r *Response) JSON(userStruct interface{}, options ...JSONOption) error {
+	if r.Error != nil {
+		return r.Error
+	}
+	if schema := r.schema(); schema != nil {
+		return r.ValidateJSON(schema, userStruct, options...)
+	}
+	o := r.jsonOptions(options)
+	data, err := r.readBody(minLimit(o.maxBodySize, r.maxResponseBytes()))
+	if err != nil {
+		return err
+	}
+	return decodeJSON(data, userStruct, o)
+}
+
+// ValidateJSON validates response body against provided JSON Schema and
+// decodes it to provided structure. If body is not valid, nothing is
+// decoded and returned error is *jsonschema.ValidationError, which holds
+// JSON pointers to all invalid values. Decoding options are same as for
+// JSON.
+func (r *Response) ValidateJSON(schema *jsonschema.Schema, userStruct interface{}, options ...JSONOption) error {
 	if r.Error != nil {
 		return r.Error
 	}
+	o := r.jsonOptions(options)
+	data, err := r.readBody(minLimit(o.maxBodySize, r.maxResponseBytes()))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return ErrEmptyBody
+	}
+	if err := schema.ValidateJSON(data); err != nil {
+		return err
+	}
+	return decodeJSON(data, userStruct, o)
+}
 
+// schema returns JSON Schema set for request of this response, if any.
+func (r *Response) schema() *jsonschema.Schema {
+	if r.Request == nil {
+		return nil
+	}
+	return schemaFromContext(r.Request.Context())
+}
+
+// jsonOptions returns options for decoding JSON, set for request of this
+// response and provided ones.
+func (r *Response) jsonOptions(options []JSONOption) *jsonOptions {
+	o := new(jsonOptions)
+	if r.Request != nil {
+		for _, opt := range jsonOptionsFromContext(r.Request.Context()) {
+			opt(o)
+		}
+	}
+	for _, opt := range options {
+		opt(o)
+	}
+	return o
+}
+
+// maxResponseBytes returns limit for size of response body set with
+// MaxResponseBytes, or zero if there is none.
+func (r *Response) maxResponseBytes() int64 {
+	if r.Request == nil {
+		return 0
+	}
+	return maxResponseBytesFromContext(r.Request.Context())
+}
+
+// minLimit returns lower of two limits, where zero or negative value means
+// there is no limit.
+func minLimit(a, b int64) int64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// maxPreallocate is largest buffer allocated upfront based on
+// Content-Length, so that server can not make client allocate memory for
+// data it does not send.
+const maxPreallocate = 1 << 20
+
+// readBody reads and closes response body. If limit is positive and body
+// is larger, *BodyTooLargeError is returned.
+func (r *Response) readBody(limit int64) ([]byte, error) {
 	defer r.Body.Close()
-	jsonDecoder := json.NewDecoder(r.Body)
+	if limit > 0 && r.ContentLength > limit {
+		return nil, &BodyTooLargeError{Limit: limit}
+	}
+	buff := bytes.NewBuffer([]byte{})
 
-	err := jsonDecoder.Decode(&userStruct)
+	// if we got Content-Length set buffer size to it
+	if r.ContentLength > 0 && r.ContentLength <= maxPreallocate {
+		buff.Grow(int(r.ContentLength))
+	}
+
+	var reader io.Reader = r.Body
+	if limit > 0 {
+		reader = io.LimitReader(r.Body, limit+1)
+	}
+	_, err := io.Copy(buff, reader)
 	if err != nil && err != io.EOF {
-		return err
+		return nil, err
 	}
-	return nil
+	if limit > 0 && int64(buff.Len()) > limit {
+		return nil, &BodyTooLargeError{Limit: limit}
+	}
+	return buff.Bytes(), nil
 }
 
 // XML decodes response body to provided structure from XML format.
@@ -66,10 +186,13 @@ func (r *Response) XML(userStruct interface{}) error {
 	if r.Error != nil {
 		return r.Error
 	}
-	defer r.Body.Close()
+	data, err := r.readBody(r.maxResponseBytes())
+	if err != nil {
+		return err
+	}
 
-	xmlDecoder := xml.NewDecoder(r.Body)
-	err := xmlDecoder.Decode(r.Body)
+	xmlDecoder := xml.NewDecoder(bytes.NewReader(data))
+	err = xmlDecoder.Decode(userStruct)
 	if err != nil && err != io.EOF {
 		return err
 	}
@@ -81,19 +204,7 @@ func (r *Response) Bytes() ([]byte, error) {
 	if r.Error != nil {
 		return nil, r.Error
 	}
-	defer r.Body.Close()
-	buff := bytes.NewBuffer([]byte{})
-
-	// if we got Content-Length set buffer size to it
-	if r.ContentLength > 0 {
-		buff.Grow(int(r.ContentLength))
-	}
-
-	_, err := io.Copy(buff, r.Body)
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	return buff.Bytes(), nil
+	return r.readBody(r.maxResponseBytes())
 }
 
 // String returns response body in string format.
@@ -0,0 +1,217 @@
+package gwc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/delicb/cliware-middlewares/url"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/jsonschema"
+)
+
+var userSchema = jsonschema.MustCompile([]byte(`{
+	"type": "object",
+	"required": ["id", "name"],
+	"properties": {
+		"id": {"type": "integer"},
+		"name": {"type": "string"}
+	}
+}`))
+
+type schemaUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func userHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/invalid" {
+		w.Write([]byte(`{"id": "1", "name": "john"}`))
+		return
+	}
+	w.Write([]byte(`{"id": 1, "name": "john"}`))
+}
+
+func TestResponse_ValidateJSON(t *testing.T) {
+	client := gwc.NewForHandler(http.HandlerFunc(userHandler))
+
+	resp, err := client.Get().URL("http://service/valid").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	var u schemaUser
+	if err := resp.ValidateJSON(userSchema, &u); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if u.ID != 1 || u.Name != "john" {
+		t.Errorf("Wrong user. Got: %+v", u)
+	}
+
+	resp, err = client.Get().URL("http://service/invalid").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	u = schemaUser{}
+	err = resp.ValidateJSON(userSchema, &u)
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		t.Fatalf("Expected ValidationError, got: %v", err)
+	}
+	if len(verr.Errors) != 1 || verr.Errors[0].InstanceLocation != "/id" {
+		t.Errorf("Wrong validation errors: %v", verr)
+	}
+	if u.Name != "" {
+		t.Error("Invalid body was decoded.")
+	}
+}
+
+func TestRequest_ResponseSchema(t *testing.T) {
+	client := gwc.NewForHandler(http.HandlerFunc(userHandler))
+
+	resp, err := client.Get().URL("http://service/invalid").ResponseSchema(userSchema).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	var u schemaUser
+	if _, ok := resp.JSON(&u).(*jsonschema.ValidationError); !ok {
+		t.Error("Response body not validated against request schema.")
+	}
+
+	// without schema, body is decoded as before
+	resp, err = client.Get().URL("http://service/invalid").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	var m map[string]interface{}
+	if err := resp.JSON(&m); err != nil {
+		t.Error("Got unexpected error:", err)
+	}
+}
+
+func TestGroup_ResponseSchema(t *testing.T) {
+	client := gwc.NewForHandler(http.HandlerFunc(userHandler))
+	group := gwc.NewGroup(client, gwc.ResponseSchema(userSchema))
+
+	resp, err := group.DoCtx(context.Background(), url.URL("http://service/invalid"))
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	var u schemaUser
+	if _, ok := resp.JSON(&u).(*jsonschema.ValidationError); !ok {
+		t.Error("Response body not validated against group schema.")
+	}
+}
+
+func TestResponse_JSONOptions(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/unknown":
+			w.Write([]byte(`{"id": 1, "name": "john", "age": 30}`))
+		case "/trailing":
+			w.Write([]byte(`{"id": 1} {"id": 2}`))
+		case "/number":
+			w.Write([]byte(`{"id": 12345678901234567890}`))
+		case "/malformed":
+			w.Write([]byte(`{"id": 1, "name": "john",, "x": 1}`))
+		case "/type":
+			w.Write([]byte(`{"id": "one"}`))
+		}
+	})
+	client := gwc.NewForHandler(handler)
+
+	for _, data := range []struct {
+		Path    string
+		Options []gwc.JSONOption
+		Valid   bool
+	}{
+		{"/unknown", nil, true},
+		{"/unknown", []gwc.JSONOption{gwc.DisallowUnknownFields()}, false},
+		{"/trailing", nil, true},
+		{"/trailing", []gwc.JSONOption{gwc.RejectTrailingData()}, false},
+		{"/unknown", []gwc.JSONOption{gwc.MaxBodySize(10)}, false},
+		{"/unknown", []gwc.JSONOption{gwc.MaxBodySize(100)}, true},
+	} {
+		resp, err := client.Get().URL("http://service" + data.Path).Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		var u schemaUser
+		err = resp.JSON(&u, data.Options...)
+		if data.Valid && err != nil {
+			t.Errorf("Got unexpected error for %s: %v", data.Path, err)
+		}
+		if !data.Valid && err == nil {
+			t.Errorf("Expected error for %s.", data.Path)
+		}
+	}
+
+	// options set on client and group are used as well
+	strict := gwc.NewForHandler(handler).JSONDecoding(gwc.UseNumber())
+	resp, err := strict.Get().URL("http://service/number").JSONDecoding(gwc.DisallowUnknownFields()).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	var m map[string]interface{}
+	if err := resp.JSON(&m); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if n, ok := m["id"].(json.Number); !ok || n.String() != "12345678901234567890" {
+		t.Errorf("Number not decoded as json.Number. Got: %#v", m["id"])
+	}
+	resp, err = gwc.NewGroup(strict).JSONDecoding(gwc.RejectTrailingData()).Do(url.URL("http://service/trailing"))
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if err := resp.JSON(&m); err == nil {
+		t.Error("Expected error for trailing data with group options.")
+	}
+}
+
+func TestResponse_JSONErrors(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/malformed":
+			w.Write([]byte(`{"id": 1, "name": "john",, "x": 1}`))
+		case "/type":
+			w.Write([]byte(`{"id": "one"}`))
+		case "/too-large":
+			w.Write([]byte(`{"id": 1, "name": "john"}`))
+		}
+	})
+	client := gwc.NewForHandler(handler)
+	var u schemaUser
+
+	resp, _ := client.Get().URL("http://service/empty").Send()
+	if err := resp.JSON(&u); err != gwc.ErrEmptyBody {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, gwc.ErrEmptyBody)
+	}
+
+	resp, _ = client.Get().URL("http://service/malformed").Send()
+	err := resp.JSON(&u)
+	decodeErr, ok := err.(*gwc.DecodeError)
+	if !ok {
+		t.Fatalf("Expected DecodeError, got: %v", err)
+	}
+	if decodeErr.Offset != 26 {
+		t.Errorf("Wrong offset. Got: %d, expected: %d", decodeErr.Offset, 26)
+	}
+	if !strings.Contains(decodeErr.Snippet, ",,") {
+		t.Errorf("Wrong snippet. Got: %s", decodeErr.Snippet)
+	}
+
+	resp, _ = client.Get().URL("http://service/type").Send()
+	err = resp.JSON(&u)
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Expected wrapped UnmarshalTypeError, got: %v", err)
+	}
+
+	resp, _ = client.Get().URL("http://service/too-large").Send()
+	if _, ok := resp.JSON(&u, gwc.MaxBodySize(5)).(*gwc.BodyTooLargeError); !ok {
+		t.Error("Expected BodyTooLargeError.")
+	}
+}
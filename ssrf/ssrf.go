@@ -0,0 +1,458 @@
+// Package ssrf protects clients that send requests to untrusted URLs (like
+// user supplied webhooks) from server side request forgery.
+//
+// Guard wraps http.Client so that every request, including each redirect
+// hop, is checked against allowed schemes, hosts and ports, and every
+// connection is checked against blocked networks. Addresses are checked
+// after name resolution, right before connection is opened, so DNS
+// rebinding can not be used to reach blocked address with allowed name.
+// By default loopback, private, link-local, reserved and cloud metadata
+// service addresses are blocked. IPv4 addresses embedded in NAT64 and 6to4
+// IPv6 addresses are checked too.
+//
+// Guarded client is used as any other:
+//
+//	guard := ssrf.New().AllowPorts(80, 443)
+//	client, err := guard.Client(nil)
+//	if err != nil {
+//		// handle error
+//	}
+//	c := gwc.New(client)
+package ssrf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/delicb/gwc/internal/wrap"
+)
+
+// Category is group of addresses that can be blocked.
+type Category int
+
+const (
+	// Loopback addresses, including unspecified addresses (0.0.0.0 and ::)
+	// that connect to local host.
+	Loopback Category = iota
+	// Private addresses (RFC 1918, carrier-grade NAT and IPv6 unique local).
+	Private
+	// LinkLocal addresses.
+	LinkLocal
+	// Metadata are addresses of cloud metadata services. They are blocked
+	// even if link-local or private addresses are allowed.
+	Metadata
+	// Reserved addresses (IETF protocol assignments, benchmarking networks
+	// and addresses reserved for future use) are not used in public
+	// internet, but they can be routed inside private networks.
+	Reserved
+)
+
+func (c Category) String() string {
+	switch c {
+	case Loopback:
+		return "loopback"
+	case Private:
+		return "private"
+	case LinkLocal:
+		return "link-local"
+	case Metadata:
+		return "metadata service"
+	case Reserved:
+		return "reserved"
+	}
+	return "category " + strconv.Itoa(int(c))
+}
+
+// categories maps each category to its networks, in order in which they
+// are checked.
+var categories = []struct {
+	category Category
+	networks []*net.IPNet
+}{
+	{Metadata, mustParseCIDRs("169.254.169.254/32", "fd00:ec2::254/128", "100.100.100.200/32")},
+	{Loopback, mustParseCIDRs("127.0.0.0/8", "0.0.0.0/8", "::1/128", "::/128")},
+	{Private, mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")},
+	{LinkLocal, mustParseCIDRs("169.254.0.0/16", "fe80::/10")},
+	{Reserved, mustParseCIDRs("192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4")},
+}
+
+var (
+	// nat64 is well-known prefix of NAT64 addresses, which embed IPv4
+	// address in last four bytes.
+	nat64 = mustParseCIDRs("64:ff9b::/96")[0]
+	// sixToFour is prefix of 6to4 addresses, which embed IPv4 address in
+	// bytes after prefix.
+	sixToFour = mustParseCIDRs("2002::/16")[0]
+)
+
+// embeddedIPv4 returns IPv4 address embedded in NAT64 or 6to4 address, or
+// nil if provided address is not one of them.
+func embeddedIPv4(ip net.IP) net.IP {
+	if ip.To4() != nil || len(ip) != net.IPv6len {
+		return nil
+	}
+	switch {
+	case nat64.Contains(ip):
+		return net.IPv4(ip[12], ip[13], ip[14], ip[15])
+	case sixToFour.Contains(ip):
+		return net.IPv4(ip[2], ip[3], ip[4], ip[5])
+	}
+	return nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// BlockedError is returned when request or connection is blocked by Guard.
+type BlockedError struct {
+	// Target is URL or address that is blocked.
+	Target string
+	Reason string
+}
+
+// Error is implementation of error interface.
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("ssrf: %s blocked: %s", e.Target, e.Reason)
+}
+
+// DefaultMaxRedirects is number of redirects guarded client follows, if
+// not configured otherwise.
+const DefaultMaxRedirects = 10
+
+// Guard checks requests and connections against configured rules. Guard
+// should be fully configured before it is used to create clients.
+type Guard struct {
+	allowed      map[Category]bool
+	allowNets    []*net.IPNet
+	blockNets    []*net.IPNet
+	schemes      map[string]bool
+	hosts        []string
+	ports        map[int]bool
+	maxRedirects int
+}
+
+// New creates and returns Guard that allows only http and https schemes,
+// any host and port and blocks addresses of all categories.
+func New() *Guard {
+	return &Guard{
+		allowed:      make(map[Category]bool),
+		schemes:      map[string]bool{"http": true, "https": true},
+		ports:        make(map[int]bool),
+		maxRedirects: DefaultMaxRedirects,
+	}
+}
+
+// Allow allows addresses of provided categories.
+func (g *Guard) Allow(categories ...Category) *Guard {
+	for _, c := range categories {
+		g.allowed[c] = true
+	}
+	return g
+}
+
+// AllowNetworks allows addresses in provided networks. They are allowed
+// even if they are blocked by BlockNetworks or by category.
+func (g *Guard) AllowNetworks(networks ...*net.IPNet) *Guard {
+	g.allowNets = append(g.allowNets, networks...)
+	return g
+}
+
+// BlockNetworks blocks addresses in provided networks, in addition to ones
+// blocked by category.
+func (g *Guard) BlockNetworks(networks ...*net.IPNet) *Guard {
+	g.blockNets = append(g.blockNets, networks...)
+	return g
+}
+
+// AllowSchemes sets URL schemes that are allowed, replacing default http
+// and https.
+func (g *Guard) AllowSchemes(schemes ...string) *Guard {
+	g.schemes = make(map[string]bool, len(schemes))
+	for _, s := range schemes {
+		g.schemes[strings.ToLower(s)] = true
+	}
+	return g
+}
+
+// AllowHosts restricts requests to provided hosts. Host starting with "*."
+// matches all its subdomains, but not domain itself. If no hosts are set,
+// all hosts are allowed.
+func (g *Guard) AllowHosts(hosts ...string) *Guard {
+	for _, h := range hosts {
+		g.hosts = append(g.hosts, strings.ToLower(h))
+	}
+	return g
+}
+
+// AllowPorts restricts requests and connections to provided ports. If no
+// ports are set, all ports are allowed.
+func (g *Guard) AllowPorts(ports ...int) *Guard {
+	for _, p := range ports {
+		g.ports[p] = true
+	}
+	return g
+}
+
+// MaxRedirects sets maximal number of redirects guarded client follows.
+func (g *Guard) MaxRedirects(n int) *Guard {
+	g.maxRedirects = n
+	return g
+}
+
+// CheckURL checks that request to provided URL is allowed by scheme, host
+// and port rules. If host is IP address, it is checked as well. Addresses
+// of host names are checked only when connection is opened.
+func (g *Guard) CheckURL(u *url.URL) error {
+	if !g.schemes[strings.ToLower(u.Scheme)] {
+		return &BlockedError{Target: u.String(), Reason: fmt.Sprintf("scheme %q is not allowed", u.Scheme)}
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return &BlockedError{Target: u.String(), Reason: "host is missing"}
+	}
+	if !g.hostAllowed(host) {
+		return &BlockedError{Target: u.String(), Reason: fmt.Sprintf("host %q is not allowed", host)}
+	}
+	port, err := urlPort(u)
+	if err != nil {
+		return &BlockedError{Target: u.String(), Reason: err.Error()}
+	}
+	if !g.portAllowed(port) {
+		return &BlockedError{Target: u.String(), Reason: fmt.Sprintf("port %d is not allowed", port)}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return g.CheckIP(ip)
+	}
+	return nil
+}
+
+// CheckIP checks that connection to provided IP address is allowed.
+func (g *Guard) CheckIP(ip net.IP) error {
+	if reason := g.blockReason(ip); reason != "" {
+		return &BlockedError{Target: ip.String(), Reason: reason}
+	}
+	return nil
+}
+
+// blockReason returns reason why connection to IP address is not allowed,
+// or empty string if it is allowed.
+func (g *Guard) blockReason(ip net.IP) string {
+	if contains(g.allowNets, ip) {
+		return ""
+	}
+	if v4 := embeddedIPv4(ip); v4 != nil {
+		// connection to NAT64 or 6to4 address reaches embedded address
+		if reason := g.blockReason(v4); reason != "" {
+			return fmt.Sprintf("embedded address %s: %s", v4, reason)
+		}
+	}
+	if contains(g.blockNets, ip) {
+		return "address is in blocked network"
+	}
+	if ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return "address is not unicast"
+	}
+	for _, c := range categories {
+		if contains(c.networks, ip) {
+			if g.allowed[c.category] {
+				// metadata addresses are in other categories too, but
+				// if they are allowed other categories are not checked
+				if c.category == Metadata {
+					return ""
+				}
+				continue
+			}
+			return c.category.String() + " address is not allowed"
+		}
+	}
+	return ""
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Guard) hostAllowed(host string) bool {
+	if len(g.hosts) == 0 {
+		return true
+	}
+	host = strings.TrimSuffix(host, ".")
+	for _, h := range g.hosts {
+		if strings.HasPrefix(h, "*.") {
+			if strings.HasSuffix(host, h[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Guard) portAllowed(port int) bool {
+	return len(g.ports) == 0 || g.ports[port]
+}
+
+// urlPort returns port of URL, or default port for its scheme.
+func urlPort(u *url.URL) (int, error) {
+	if p := u.Port(); p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, fmt.Errorf("invalid port %q", p)
+		}
+		return port, nil
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return 80, nil
+	case "https":
+		return 443, nil
+	}
+	return 0, fmt.Errorf("port of scheme %q is unknown", u.Scheme)
+}
+
+// control is used as net.Dialer.Control, so it gets address after name
+// resolution, right before connection is opened.
+func (g *Guard) control(network, address string, _ syscall.RawConn) error {
+	host, p, err := net.SplitHostPort(address)
+	if err != nil {
+		return &BlockedError{Target: address, Reason: err.Error()}
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return &BlockedError{Target: address, Reason: "address is not IP address"}
+	}
+	if err := g.CheckIP(ip); err != nil {
+		return err
+	}
+	port, _ := strconv.Atoi(p)
+	if !g.portAllowed(port) {
+		return &BlockedError{Target: address, Reason: fmt.Sprintf("port %d is not allowed", port)}
+	}
+	return nil
+}
+
+// Dialer returns dialer that checks every address it connects to.
+func (g *Guard) Dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   g.control,
+	}
+}
+
+// Transport returns copy of provided transport (or of
+// http.DefaultTransport if nil) that checks every request and connection.
+// Transport connects directly, proxy and custom dial functions of provided
+// transport are not used.
+func (g *Guard) Transport(t *http.Transport) http.RoundTripper {
+	if t == nil {
+		t = http.DefaultTransport.(*http.Transport)
+	}
+	t = t.Clone()
+	t.Proxy = nil
+	t.Dial = nil
+	t.DialTLS = nil
+	t.DialTLSContext = nil
+	t.DialContext = g.Dialer().DialContext
+	return &transport{guard: g, next: t}
+}
+
+// transport checks URL of every request before sending it.
+type transport struct {
+	guard *Guard
+	next  http.RoundTripper
+}
+
+// RoundTrip is implementation of http.RoundTripper interface.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.guard.CheckURL(req.URL); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections of underlying transport.
+func (t *transport) CloseIdleConnections() {
+	wrap.CloseIdleConnections(t.next)
+}
+
+// Unwrap is implementation of wrap.Wrapper interface.
+func (t *transport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// Wrap is implementation of wrap.Wrapper interface. Transport configured by
+// other package is guarded again, so it still connects directly and checks
+// every connection.
+func (t *transport) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next, ok := next.(*http.Transport); ok {
+		return t.guard.Transport(next)
+	}
+	return &transport{guard: t.guard, next: next}
+}
+
+// RestrictsConnections is implementation of wrap.Restrictor interface.
+func (t *transport) RestrictsConnections() {}
+
+// ErrTooManyRedirects is returned when guarded client gets more redirects
+// than allowed.
+var ErrTooManyRedirects = errors.New("ssrf: too many redirects")
+
+// Client returns copy of provided client (or of empty client if nil) that
+// checks every request, redirect and connection. Transport of provided
+// client has to be *http.Transport (or nil) or transport of client created
+// by other package of this module that configures transports, otherwise
+// error is returned. Redirect policy of provided client is applied after
+// guard checks.
+func (g *Guard) Client(client *http.Client) (*http.Client, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	t, rewrap, ok := wrap.Unwrap(client.Transport)
+	if !ok {
+		return nil, fmt.Errorf("ssrf: transport of type %T can not be guarded, *http.Transport is required", client.Transport)
+	}
+	guarded := *client
+	guarded.Transport = rewrap(g.Transport(t))
+	checkRedirect := client.CheckRedirect
+	guarded.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= g.maxRedirects {
+			return ErrTooManyRedirects
+		}
+		if err := g.CheckURL(req.URL); err != nil {
+			return err
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		return nil
+	}
+	return &guarded, nil
+}
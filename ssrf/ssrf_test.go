@@ -0,0 +1,262 @@
+package ssrf_test
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/proxy"
+	"github.com/delicb/gwc/ssrf"
+	"github.com/delicb/gwc/trust"
+)
+
+func newServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	})
+	return httptest.NewServer(mux)
+}
+
+func guardedClient(t *testing.T, guard *ssrf.Guard) *gwc.Client {
+	client, err := guard.Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	return gwc.New(client)
+}
+
+func isBlocked(err error) bool {
+	var blocked *ssrf.BlockedError
+	return errors.As(err, &blocked)
+}
+
+func TestGuard_BlocksLoopback(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	for _, rawURL := range []string{
+		server.URL + "/ok",
+		// name is resolved and checked when connection is opened
+		"http://localhost:" + strconv.Itoa(port) + "/ok",
+	} {
+		_, err := guardedClient(t, ssrf.New()).Get().URL(rawURL).Send()
+		if !isBlocked(err) {
+			t.Errorf("Request to %s not blocked, got: %v", rawURL, err)
+		}
+	}
+
+	resp, err := guardedClient(t, ssrf.New().Allow(ssrf.Loopback)).Get().URL(server.URL + "/ok").Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	body, _ := resp.String()
+	if body != "ok" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "ok")
+	}
+}
+
+func TestGuard_Allowlists(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	for _, data := range []struct {
+		Name    string
+		Guard   *ssrf.Guard
+		Blocked bool
+	}{
+		{"allowed host", ssrf.New().Allow(ssrf.Loopback).AllowHosts("127.0.0.1"), false},
+		{"not allowed host", ssrf.New().Allow(ssrf.Loopback).AllowHosts("example.com"), true},
+		{"allowed port", ssrf.New().Allow(ssrf.Loopback).AllowPorts(port), false},
+		{"not allowed port", ssrf.New().Allow(ssrf.Loopback).AllowPorts(443), true},
+		{"not allowed scheme", ssrf.New().Allow(ssrf.Loopback).AllowSchemes("https"), true},
+		{"allowed network", ssrf.New().AllowNetworks(&net.IPNet{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(32, 32)}), false},
+		{"blocked network", ssrf.New().Allow(ssrf.Loopback).BlockNetworks(&net.IPNet{IP: net.IPv4(127, 0, 0, 0), Mask: net.CIDRMask(8, 32)}), true},
+	} {
+		_, err := guardedClient(t, data.Guard).Get().URL(server.URL + "/ok").Send()
+		if data.Blocked && !isBlocked(err) {
+			t.Errorf("%s: Request not blocked, got: %v", data.Name, err)
+		}
+		if !data.Blocked && err != nil {
+			t.Errorf("%s: Got unexpected error: %v", data.Name, err)
+		}
+	}
+}
+
+func TestGuard_Redirects(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	port := strconv.Itoa(server.Listener.Addr().(*net.TCPAddr).Port)
+	guard := ssrf.New().Allow(ssrf.Loopback).AllowHosts("127.0.0.1")
+
+	for _, data := range []struct {
+		To      string
+		Blocked bool
+	}{
+		{"http://127.0.0.1:" + port + "/ok", false},
+		{"http://localhost:" + port + "/ok", true},
+		{"ftp://127.0.0.1/file", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+	} {
+		redirect := server.URL + "/redirect?to=" + url.QueryEscape(data.To)
+		_, err := guardedClient(t, guard).Get().URL(redirect).Send()
+		if data.Blocked && !isBlocked(err) {
+			t.Errorf("Redirect to %s not blocked, got: %v", data.To, err)
+		}
+		if !data.Blocked && err != nil {
+			t.Errorf("Got unexpected error for redirect to %s: %v", data.To, err)
+		}
+	}
+
+	_, err := guardedClient(t, ssrf.New().Allow(ssrf.Loopback).MaxRedirects(0)).
+		Get().URL(server.URL + "/redirect?to=/ok").Send()
+	if !errors.Is(err, ssrf.ErrTooManyRedirects) {
+		t.Errorf("Wrong error. Got: %v, expected: %v", err, ssrf.ErrTooManyRedirects)
+	}
+}
+
+func TestGuard_CheckIP(t *testing.T) {
+	for _, data := range []struct {
+		IP      string
+		Guard   *ssrf.Guard
+		Blocked bool
+	}{
+		{"93.184.216.34", ssrf.New(), false},
+		{"127.0.0.1", ssrf.New(), true},
+		{"::1", ssrf.New(), true},
+		{"::ffff:127.0.0.1", ssrf.New(), true},
+		{"0.0.0.0", ssrf.New(), true},
+		{"10.1.2.3", ssrf.New(), true},
+		{"10.1.2.3", ssrf.New().Allow(ssrf.Private), false},
+		{"192.168.1.1", ssrf.New(), true},
+		{"fd12::1", ssrf.New(), true},
+		{"169.254.1.1", ssrf.New(), true},
+		{"169.254.1.1", ssrf.New().Allow(ssrf.LinkLocal), false},
+		{"169.254.169.254", ssrf.New().Allow(ssrf.LinkLocal), true},
+		{"169.254.169.254", ssrf.New().Allow(ssrf.Metadata), false},
+		{"fd00:ec2::254", ssrf.New().Allow(ssrf.Private), true},
+		{"224.0.0.1", ssrf.New(), true},
+		{"192.0.0.8", ssrf.New(), true},
+		{"198.18.0.1", ssrf.New(), true},
+		{"198.19.255.1", ssrf.New(), true},
+		{"240.0.0.1", ssrf.New(), true},
+		{"240.0.0.1", ssrf.New().Allow(ssrf.Reserved), false},
+		{"64:ff9b::7f00:1", ssrf.New(), true},
+		{"64:ff9b::a9fe:a9fe", ssrf.New().Allow(ssrf.LinkLocal), true},
+		{"64:ff9b::a00:1", ssrf.New().Allow(ssrf.Private), false},
+		{"64:ff9b::5db8:d822", ssrf.New(), false},
+		{"2002:c0a8:101::1", ssrf.New(), true},
+		{"2002:7f00:1::", ssrf.New(), true},
+		{"2002:5db8:d822::1", ssrf.New(), false},
+	} {
+		err := data.Guard.CheckIP(net.ParseIP(data.IP))
+		if data.Blocked && !isBlocked(err) {
+			t.Errorf("Address %s not blocked.", data.IP)
+		}
+		if !data.Blocked && err != nil {
+			t.Errorf("Got unexpected error for %s: %v", data.IP, err)
+		}
+	}
+}
+
+func TestGuard_CheckURL(t *testing.T) {
+	guard := ssrf.New().AllowHosts("example.com", "*.example.org")
+	for _, data := range []struct {
+		URL     string
+		Blocked bool
+	}{
+		{"https://example.com/hook", false},
+		{"https://EXAMPLE.com/hook", false},
+		{"https://sub.example.com/hook", true},
+		{"https://hooks.example.org/hook", false},
+		{"https://example.org/hook", true},
+		{"https://evilexample.org/hook", true},
+		{"file:///etc/passwd", true},
+		{"gopher://example.com/", true},
+	} {
+		u, _ := url.Parse(data.URL)
+		err := guard.CheckURL(u)
+		if data.Blocked && !isBlocked(err) {
+			t.Errorf("URL %s not blocked.", data.URL)
+		}
+		if !data.Blocked && err != nil {
+			t.Errorf("Got unexpected error for %s: %v", data.URL, err)
+		}
+	}
+}
+
+func TestGuard_Client(t *testing.T) {
+	custom := &http.Client{Transport: gwc.NewHandlerTransport(http.NotFoundHandler())}
+	if _, err := ssrf.New().Client(custom); err == nil {
+		t.Error("Expected error for transport that can not be guarded.")
+	}
+}
+
+func TestGuard_ClientWithTrustAndProxy(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied"))
+	}))
+	defer proxyServer.Close()
+
+	trustClient, err := trust.New().Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	proxyClient, err := proxy.New().Default(proxyServer.URL).Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	for _, data := range []struct {
+		Guard   *ssrf.Guard
+		Blocked bool
+	}{
+		{ssrf.New(), true},
+		{ssrf.New().Allow(ssrf.Loopback), false},
+	} {
+		guarded, err := data.Guard.Client(trustClient)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		trusted, err := trust.New().Client(guarded)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		guardedProxy, err := data.Guard.Client(proxyClient)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		proxied, err := proxy.New().Default(proxyServer.URL).Client(guarded)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		// guarded clients check connections and connect directly, whichever
+		// package configured client last
+		for i, client := range []*http.Client{guarded, trusted, guardedProxy, proxied} {
+			resp, err := gwc.New(client).Get().URL(server.URL + "/ok").Send()
+			if data.Blocked {
+				if !isBlocked(err) {
+					t.Errorf("Request of client %d not blocked. Got: %v", i, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Got unexpected error for client %d: %v", i, err)
+			}
+			if body, _ := resp.String(); body != "ok" {
+				t.Errorf("Wrong body for client %d. Got: %s, expected: %s", i, body, "ok")
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package trust
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// CertificateProvider provides client certificate for mutual TLS. It is
+// called when certificates are checked for changes (see Config.Reload) and
+// can return new certificate when old one is rotated.
+type CertificateProvider interface {
+	Certificate() (*tls.Certificate, error)
+}
+
+// CertificateFunc is adapter that allows usage of ordinary function as
+// CertificateProvider.
+type CertificateFunc func() (*tls.Certificate, error)
+
+// Certificate is implementation of CertificateProvider interface.
+func (f CertificateFunc) Certificate() (*tls.Certificate, error) {
+	return f()
+}
+
+// FileCertificate returns CertificateProvider that loads PEM encoded
+// certificate and key from provided files. Files are loaded again when
+// their size or modification time changes.
+func FileCertificate(certFile, keyFile string) CertificateProvider {
+	return &fileCertificate{certFile: certFile, keyFile: keyFile}
+}
+
+type fileCertificate struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	version string
+	cert    *tls.Certificate
+}
+
+// Certificate is implementation of CertificateProvider interface.
+func (f *fileCertificate) Certificate() (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	version, err := filesVersion([]string{f.certFile, f.keyFile})
+	if err != nil {
+		return nil, err
+	}
+	if f.cert != nil && version == f.version {
+		return f.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("trust: loading client certificate: %v", err)
+	}
+	f.cert = &cert
+	f.version = version
+	return f.cert, nil
+}
+
+// leaf returns parsed first certificate in chain.
+func leaf(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("trust: client certificate is empty")
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// filesVersion returns string that changes when any of provided files
+// changes.
+func filesVersion(files []string) (string, error) {
+	var version string
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", fmt.Errorf("trust: %v", err)
+		}
+		version += fmt.Sprintf("%s:%d:%d;", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return version, nil
+}
@@ -0,0 +1,607 @@
+// Package trust configures TLS of gwc clients: custom root certificates,
+// client certificates for mutual TLS and certificate pinning.
+//
+// Root certificates are loaded from PEM files and client certificate is
+// obtained from CertificateProvider (like FileCertificate). Both can be
+// reloaded periodically, so that certificates can be rotated without
+// recreating client. When client certificate changes, idle connections of
+// clients created by Config.Client that use old one are closed. Pins are
+// SHA-256 hashes of subject public key info (SPKI) of certificates and
+// connection is accepted if any certificate in verified chain matches any
+// of host's pins, so backup pins are simply additional pins.
+//
+//	cfg := trust.New().
+//		RootCAs("/etc/myapp/ca.pem").
+//		ClientCertificate("/etc/myapp/client.pem", "/etc/myapp/client-key.pem").
+//		Pin("api.example.com", primaryPin, backupPin).
+//		Reload(time.Minute)
+//	client, err := cfg.Client(nil)
+//	if err != nil {
+//		// handle error
+//	}
+//	c := gwc.New(client)
+package trust
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/delicb/gwc/internal/wrap"
+)
+
+// pinPrefix is prefix of pins in format "sha256/<base64 hash>".
+const pinPrefix = "sha256/"
+
+// SPKIHash returns pin of provided certificate, as "sha256/" followed by
+// base64 encoded SHA-256 hash of its subject public key info.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// PinError is returned when none of certificates presented by server
+// matches pins configured for its host.
+type PinError struct {
+	Host string
+	// Pins are pins of certificates in verified chain.
+	Pins []string
+	// Expected are pins configured for host.
+	Expected []string
+}
+
+// Error is implementation of error interface.
+func (e *PinError) Error() string {
+	return fmt.Sprintf("trust: certificate of %s does not match any pin, got %s", e.Host, strings.Join(e.Pins, ", "))
+}
+
+// Config holds TLS configuration. It should be fully configured before it
+// is used to create clients.
+type Config struct {
+	rootPaths   []string
+	systemRoots bool
+	provider    CertificateProvider
+	pins        map[string][]string
+	report      func(*PinError)
+	interval    time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	loaded  *material
+}
+
+// material is everything loaded from files and certificate provider, with
+// state of root certificate files it was loaded from.
+type material struct {
+	roots   *x509.CertPool
+	cert    *tls.Certificate
+	leaf    *x509.Certificate
+	version string
+	// rotations is number of times client certificate changed
+	rotations int
+}
+
+// New creates and returns empty Config. Without any options, it uses
+// system root certificates, same as default TLS configuration.
+func New() *Config {
+	return &Config{pins: make(map[string][]string)}
+}
+
+// RootCAs sets PEM files or directories with PEM files that contain
+// trusted root certificates. They replace system root certificates, unless
+// SystemRoots is used as well.
+func (c *Config) RootCAs(paths ...string) *Config {
+	c.rootPaths = append(c.rootPaths, paths...)
+	return c
+}
+
+// SystemRoots makes system root certificates trusted in addition to ones
+// set with RootCAs.
+func (c *Config) SystemRoots() *Config {
+	c.systemRoots = true
+	return c
+}
+
+// ClientCertificate sets PEM encoded certificate and key files used as
+// client certificate for mutual TLS. It is shortcut for
+// ClientCertificateProvider with FileCertificate.
+func (c *Config) ClientCertificate(certFile, keyFile string) *Config {
+	return c.ClientCertificateProvider(FileCertificate(certFile, keyFile))
+}
+
+// ClientCertificateProvider sets provider of client certificate for mutual
+// TLS. When provider returns new certificate, it is used for new
+// connections and idle connections of clients created by Client that use
+// old one are closed.
+func (c *Config) ClientCertificateProvider(provider CertificateProvider) *Config {
+	c.provider = provider
+	return c
+}
+
+// ClientCertificateExpiry returns expiration time of client certificate
+// that is currently used, or zero time if there is none.
+func (c *Config) ClientCertificateExpiry() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded == nil || c.loaded.leaf == nil {
+		return time.Time{}
+	}
+	return c.loaded.leaf.NotAfter
+}
+
+// Pin sets pins for provided host. Host starting with "*." matches all its
+// subdomains. Pins can be given with or without "sha256/" prefix. Hosts
+// without pins are not pinned.
+func (c *Config) Pin(host string, pins ...string) *Config {
+	host = strings.ToLower(host)
+	for _, p := range pins {
+		c.pins[host] = append(c.pins[host], pinPrefix+strings.TrimPrefix(p, pinPrefix))
+	}
+	return c
+}
+
+// ReportOnly makes pin mismatches reported to provided function instead of
+// failing connection, which can be used to test pins before enforcing them.
+func (c *Config) ReportOnly(report func(*PinError)) *Config {
+	c.report = report
+	return c
+}
+
+// Reload makes certificate files and certificate provider checked for
+// changes at most once per provided interval, when request is sent or new
+// connection is opened. Changed certificates are used for new connections.
+// If loading fails, previous certificates are used until it succeeds.
+func (c *Config) Reload(interval time.Duration) *Config {
+	c.interval = interval
+	return c
+}
+
+// init loads certificates, so that errors in files are reported when
+// transport is created.
+func (c *Config) init() error {
+	m, err := c.load()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.loaded = m
+	c.checked = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// tlsConfig returns TLS configuration for connection to server with
+// provided name, that offers provided application protocols. If name is
+// empty, name from connection state is used, which is empty for IP
+// addresses.
+func (c *Config) tlsConfig(serverName string, nextProtos []string) *tls.Config {
+	// certificates are verified in VerifyConnection, against roots that
+	// might be reloaded
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         nextProtos,
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			name := serverName
+			if name == "" {
+				name = cs.ServerName
+			}
+			return c.verify(name, cs)
+		},
+	}
+	if c.provider != nil {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return c.material().cert, nil
+		}
+	}
+	return cfg
+}
+
+// Transport loads certificates and returns copy of provided transport (or
+// of http.DefaultTransport if nil) that uses them. Transport opens TLS
+// connections itself, so custom TLS dial functions and TLS configuration
+// of provided transport are not used, except for its application protocols.
+// HTTP/2 is negotiated if provided transport attempts it. Config does not
+// keep returned transport, so its idle connections are not closed when
+// client certificate changes.
+func (c *Config) Transport(t *http.Transport) (*http.Transport, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	if t == nil {
+		t = http.DefaultTransport.(*http.Transport)
+	}
+	http2 := attemptsHTTP2(t)
+	t = t.Clone()
+	nextProtos := nextProtos(t.TLSClientConfig, http2)
+	// transport attempts HTTP/2 over connections opened by DialTLSContext
+	// only if forced
+	t.ForceAttemptHTTP2 = http2
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.DialTLS = nil
+	t.DialTLSContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return handshake(ctx, tls.Client(conn, c.tlsConfig(host, nextProtos)))
+	}
+	// used for connections through proxies, that are not opened by
+	// DialTLSContext
+	t.TLSClientConfig = c.tlsConfig("", nextProtos)
+	return t, nil
+}
+
+// attemptsHTTP2 reports if provided transport attempts HTTP/2 for TLS
+// connections. Like http.Transport, it is attempted unless TLSNextProto
+// disables it or custom dial functions or TLS configuration are set without
+// ForceAttemptHTTP2.
+func attemptsHTTP2(t *http.Transport) bool {
+	if t.TLSNextProto != nil {
+		_, ok := t.TLSNextProto["h2"]
+		return ok
+	}
+	return t.ForceAttemptHTTP2 || (t.TLSClientConfig == nil && t.Dial == nil &&
+		t.DialContext == nil && t.DialTLS == nil && t.DialTLSContext == nil)
+}
+
+// nextProtos returns application protocols offered in TLS handshake, which
+// are those from provided TLS configuration, with HTTP/2 and HTTP/1.1 added
+// if HTTP/2 is attempted or h2 removed if it is not.
+func nextProtos(cfg *tls.Config, http2 bool) []string {
+	protos := []string{}
+	if http2 {
+		protos = append(protos, "h2")
+	}
+	http1 := false
+	if cfg != nil {
+		for _, p := range cfg.NextProtos {
+			if p != "h2" {
+				protos = append(protos, p)
+			}
+			http1 = http1 || p == "http/1.1"
+		}
+	}
+	if http2 && !http1 {
+		protos = append(protos, "http/1.1")
+	}
+	return protos
+}
+
+// handshake performs TLS handshake, aborting it if context is done.
+func handshake(ctx context.Context, conn *tls.Conn) (net.Conn, error) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	if err := conn.Handshake(); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Client returns copy of provided client (or of empty client if nil) that
+// uses this configuration. Transport of provided client has to be
+// *http.Transport (or nil) or transport of client created by proxy or ssrf
+// package, otherwise error is returned. Unlike transport returned by
+// Transport, returned client checks certificates for changes on every
+// request, not only when new connection is opened, so idle connections with
+// old client certificate are closed promptly.
+func (c *Config) Client(client *http.Client) (*http.Client, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	t, rewrap, ok := wrap.Unwrap(client.Transport)
+	if !ok {
+		return nil, fmt.Errorf("trust: transport of type %T can not be configured, *http.Transport is required", client.Transport)
+	}
+	t, err := c.Transport(t)
+	if err != nil {
+		return nil, err
+	}
+	configured := *client
+	configured.Transport = c.wrap(rewrap(t))
+	return &configured, nil
+}
+
+// transport checks certificates for changes before sending request. When
+// client certificate changes, idle connections of next transport are
+// closed, so that new connections use new certificate. Config does not
+// keep transports it creates, so they are garbage collected with clients
+// that use them.
+type transport struct {
+	config *Config
+	next   http.RoundTripper
+
+	mu sync.Mutex
+	// rotations is number of client certificate changes seen by transport
+	rotations int
+}
+
+// wrap returns transport that checks certificates before sending requests
+// with provided one.
+func (c *Config) wrap(next http.RoundTripper) *transport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &transport{config: c, next: next, rotations: c.loaded.rotations}
+}
+
+// RoundTrip is implementation of http.RoundTripper interface.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	m := t.config.material()
+	t.mu.Lock()
+	rotated := m.rotations != t.rotations
+	t.rotations = m.rotations
+	t.mu.Unlock()
+	if rotated {
+		wrap.CloseIdleConnections(t.next)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections of underlying transport.
+func (t *transport) CloseIdleConnections() {
+	wrap.CloseIdleConnections(t.next)
+}
+
+// Unwrap is implementation of wrap.Wrapper interface.
+func (t *transport) Unwrap() http.RoundTripper {
+	return t.next
+}
+
+// Wrap is implementation of wrap.Wrapper interface.
+func (t *transport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return t.config.wrap(next)
+}
+
+// verify verifies certificate chain presented by server with provided name
+// and checks pins.
+func (c *Config) verify(serverName string, cs tls.ConnectionState) error {
+	if serverName == "" {
+		return errors.New("trust: server name is unknown, certificate can not be verified")
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("trust: server did not present certificate")
+	}
+	opts := x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         c.material().roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	chains, err := cs.PeerCertificates[0].Verify(opts)
+	if err != nil {
+		return err
+	}
+	return c.checkPins(serverName, chains)
+}
+
+// checkPins checks that any certificate in verified chains matches pins of
+// host, if it has any.
+func (c *Config) checkPins(host string, chains [][]*x509.Certificate) error {
+	expected := c.hostPins(strings.ToLower(host))
+	if len(expected) == 0 {
+		return nil
+	}
+	var got []string
+	seen := make(map[string]bool)
+	for _, chain := range chains {
+		for _, cert := range chain {
+			pin := SPKIHash(cert)
+			for _, e := range expected {
+				if pin == e {
+					return nil
+				}
+			}
+			if !seen[pin] {
+				seen[pin] = true
+				got = append(got, pin)
+			}
+		}
+	}
+	err := &PinError{Host: host, Pins: got, Expected: expected}
+	if c.report != nil {
+		c.report(err)
+		return nil
+	}
+	return err
+}
+
+// hostPins returns pins for host, including ones for wildcard hosts that
+// match it.
+func (c *Config) hostPins(host string) []string {
+	pins := append([]string(nil), c.pins[host]...)
+	for pattern, p := range c.pins {
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			pins = append(pins, p...)
+		}
+	}
+	return pins
+}
+
+// material returns loaded certificates, reloading them first if reload
+// interval passed since last check.
+func (c *Config) material() *material {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.interval <= 0 || time.Since(c.checked) < c.interval {
+		return c.loaded
+	}
+	c.checked = time.Now()
+	old := c.loaded
+	if m, err := c.reload(old); err == nil {
+		if rotated(old.cert, m.cert) {
+			m.rotations++
+		}
+		c.loaded = m
+	}
+	return c.loaded
+}
+
+// rotated returns true if certificates differ.
+func rotated(old, cert *tls.Certificate) bool {
+	if old == nil || cert == nil || old == cert {
+		return false
+	}
+	return !bytes.Equal(old.Certificate[0], cert.Certificate[0])
+}
+
+// reload loads root certificates if their files changed and gets client
+// certificate from provider.
+func (c *Config) reload(old *material) (*material, error) {
+	m := *old
+	version, err := c.version()
+	if err != nil {
+		return nil, err
+	}
+	if version != old.version {
+		if m.roots, err = c.loadRoots(); err != nil {
+			return nil, err
+		}
+		m.version = version
+	}
+	if err := c.loadCertificate(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// load loads all configured certificates.
+func (c *Config) load() (*material, error) {
+	version, err := c.version()
+	if err != nil {
+		return nil, err
+	}
+	m := &material{version: version}
+	if len(c.rootPaths) > 0 {
+		if m.roots, err = c.loadRoots(); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.loadCertificate(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadCertificate gets client certificate from provider, if there is one.
+func (c *Config) loadCertificate(m *material) error {
+	if c.provider == nil {
+		return nil
+	}
+	cert, err := c.provider.Certificate()
+	if err != nil {
+		return err
+	}
+	if cert == nil {
+		return errors.New("trust: certificate provider returned no certificate")
+	}
+	l, err := leaf(cert)
+	if err != nil {
+		return err
+	}
+	m.cert, m.leaf = cert, l
+	return nil
+}
+
+func (c *Config) loadRoots() (*x509.CertPool, error) {
+	if len(c.rootPaths) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if c.systemRoots {
+		system, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("trust: loading system roots: %v", err)
+		}
+		pool = system
+	}
+	files, err := c.rootFiles()
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("trust: %v", err)
+		}
+		if pool.AppendCertsFromPEM(data) {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("trust: no certificates found in %s", strings.Join(c.rootPaths, ", "))
+	}
+	return pool, nil
+}
+
+// rootFiles returns all files with root certificates. Directories are
+// expanded to regular files in them, without subdirectories.
+func (c *Config) rootFiles() ([]string, error) {
+	var files []string
+	for _, path := range c.rootPaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("trust: %v", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("trust: %v", err)
+		}
+		for _, e := range entries {
+			// Stat follows symbolic links, which are common in
+			// certificate directories
+			f := filepath.Join(path, e.Name())
+			if info, err := os.Stat(f); err == nil && info.Mode().IsRegular() {
+				files = append(files, f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// version returns string that changes when any of root certificate files
+// changes.
+func (c *Config) version() (string, error) {
+	files, err := c.rootFiles()
+	if err != nil {
+		return "", err
+	}
+	return filesVersion(files)
+}
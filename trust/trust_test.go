@@ -0,0 +1,381 @@
+package trust_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/gwc"
+	"github.com/delicb/gwc/trust"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "trust")
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+}
+
+func certPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// newCertificate creates self signed certificate and returns its PEM
+// encoded certificate and key.
+func newCertificate(t *testing.T, name string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
+
+func get(t *testing.T, cfg *trust.Config, url string) (string, error) {
+	client, err := cfg.Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	resp, err := gwc.New(client).Get().URL(url).Send()
+	if err != nil {
+		return "", err
+	}
+	return resp.String()
+}
+
+func TestRootCAs(t *testing.T) {
+	server := httptest.NewTLSServer(okHandler())
+	defer server.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := get(t, trust.New(), server.URL); err == nil {
+		t.Error("Expected error for server with unknown certificate.")
+	}
+
+	file := filepath.Join(dir, "ca.pem")
+	writeFile(t, file, certPEM(server.Certificate()))
+	body, err := get(t, trust.New().RootCAs(file), server.URL)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body != "ok" {
+		t.Errorf("Wrong body. Got: %s, expected: %s", body, "ok")
+	}
+
+	// directory with certificate among other files
+	other, _ := newCertificate(t, "other")
+	writeFile(t, filepath.Join(dir, "other.pem"), other)
+	writeFile(t, filepath.Join(dir, "README"), []byte("not a certificate"))
+	if _, err := get(t, trust.New().RootCAs(dir), server.URL); err != nil {
+		t.Error("Got unexpected error:", err)
+	}
+
+	if _, err := trust.New().RootCAs(filepath.Join(dir, "README")).Transport(nil); err == nil {
+		t.Error("Expected error for file without certificates.")
+	}
+	if _, err := trust.New().RootCAs(filepath.Join(dir, "missing")).Transport(nil); err == nil {
+		t.Error("Expected error for missing file.")
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(okHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ca.pem")
+	writeFile(t, file, certPEM(server.Certificate()))
+
+	for _, data := range []struct {
+		Transport *http.Transport
+		Expected  int
+	}{
+		{nil, 2},
+		{&http.Transport{ForceAttemptHTTP2: true}, 2},
+		{&http.Transport{}, 2},
+		{&http.Transport{DialContext: (&net.Dialer{}).DialContext}, 1},
+		{&http.Transport{ForceAttemptHTTP2: true, TLSNextProto: map[string]func(string, *tls.Conn) http.RoundTripper{}}, 1},
+	} {
+		transport, err := trust.New().RootCAs(file).Transport(data.Transport)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		resp, err := gwc.New(&http.Client{Transport: transport}).Get().URL(server.URL).Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != data.Expected {
+			t.Errorf("Wrong protocol version. Got: %d, expected: %d", resp.ProtoMajor, data.Expected)
+		}
+	}
+}
+
+func TestPin(t *testing.T) {
+	server := httptest.NewTLSServer(okHandler())
+	defer server.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ca.pem")
+	writeFile(t, file, certPEM(server.Certificate()))
+
+	pin := trust.SPKIHash(server.Certificate())
+	wrong := "sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+	if _, err := get(t, trust.New().RootCAs(file).Pin("127.0.0.1", pin), server.URL); err != nil {
+		t.Error("Got unexpected error:", err)
+	}
+	// backup pin
+	if _, err := get(t, trust.New().RootCAs(file).Pin("127.0.0.1", wrong, pin[len("sha256/"):]), server.URL); err != nil {
+		t.Error("Got unexpected error:", err)
+	}
+	// other hosts are not pinned
+	if _, err := get(t, trust.New().RootCAs(file).Pin("example.org", wrong), server.URL); err != nil {
+		t.Error("Got unexpected error:", err)
+	}
+
+	_, err := get(t, trust.New().RootCAs(file).Pin("127.0.0.1", wrong), server.URL)
+	var pinErr *trust.PinError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("Expected PinError, got: %v", err)
+	}
+	if len(pinErr.Pins) != 1 || pinErr.Pins[0] != pin {
+		t.Errorf("Wrong pins. Got: %v, expected: %v", pinErr.Pins, []string{pin})
+	}
+
+	var reported *trust.PinError
+	cfg := trust.New().RootCAs(file).Pin("127.0.0.1", wrong).ReportOnly(func(err *trust.PinError) {
+		reported = err
+	})
+	if _, err := get(t, cfg, server.URL); err != nil {
+		t.Error("Got unexpected error:", err)
+	}
+	if reported == nil || reported.Host != "127.0.0.1" {
+		t.Errorf("Pin mismatch not reported. Got: %v", reported)
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(okHandler())
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, certPEM(server.Certificate()))
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	cert, key := newCertificate(t, "client-1")
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+
+	cfg := trust.New().RootCAs(caFile).ClientCertificate(certFile, keyFile)
+	body, err := get(t, cfg, server.URL)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	if body != "client-1" {
+		t.Errorf("Wrong client certificate. Got: %s, expected: %s", body, "client-1")
+	}
+
+	if _, err := trust.New().ClientCertificate(certFile, caFile).Transport(nil); err == nil {
+		t.Error("Expected error for invalid key.")
+	}
+}
+
+func TestReload(t *testing.T) {
+	server := httptest.NewUnstartedServer(okHandler())
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	other, _ := newCertificate(t, "other")
+	writeFile(t, caFile, other)
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	cert, key := newCertificate(t, "client-1")
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+
+	cfg := trust.New().RootCAs(caFile).ClientCertificate(certFile, keyFile).Reload(time.Millisecond)
+	client, err := cfg.Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	c := gwc.New(client)
+	if _, err := c.Get().URL(server.URL).Send(); err == nil {
+		t.Fatal("Expected error for server with unknown certificate.")
+	}
+
+	// rotate files on disk, with modification time that surely differs
+	later := time.Now().Add(time.Minute)
+	writeFile(t, caFile, certPEM(server.Certificate()))
+	cert, key = newCertificate(t, "client-2")
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+	for _, f := range []string{caFile, certFile, keyFile} {
+		os.Chtimes(f, later, later)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	resp, err := c.Get().URL(server.URL).Send()
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	body, _ := resp.String()
+	if body != "client-2" {
+		t.Errorf("Wrong client certificate. Got: %s, expected: %s", body, "client-2")
+	}
+}
+
+func TestClientCertificateProvider(t *testing.T) {
+	server := httptest.NewUnstartedServer(okHandler())
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, certPEM(server.Certificate()))
+
+	var mu sync.Mutex
+	var current *tls.Certificate
+	rotate := func(name string) {
+		cert, key := newCertificate(t, name)
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		mu.Lock()
+		current = &pair
+		mu.Unlock()
+	}
+	provider := trust.CertificateFunc(func() (*tls.Certificate, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return current, nil
+	})
+	rotate("client-1")
+
+	cfg := trust.New().RootCAs(caFile).ClientCertificateProvider(provider).Reload(time.Millisecond)
+	client, err := cfg.Client(nil)
+	if err != nil {
+		t.Fatal("Got unexpected error:", err)
+	}
+	c := gwc.New(client)
+	checkExpiry := func() {
+		mu.Lock()
+		leaf, _ := x509.ParseCertificate(current.Certificate[0])
+		mu.Unlock()
+		if expiry := cfg.ClientCertificateExpiry(); !expiry.Equal(leaf.NotAfter) {
+			t.Errorf("Wrong expiry. Got: %s, expected: %s", expiry, leaf.NotAfter)
+		}
+	}
+	checkExpiry()
+
+	for _, name := range []string{"client-1", "client-2"} {
+		if name != "client-1" {
+			rotate(name)
+			time.Sleep(5 * time.Millisecond)
+		}
+		resp, err := c.Get().URL(server.URL).Send()
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		// connection from first request is idle and would be reused if it
+		// was not closed after rotation
+		body, _ := resp.String()
+		if body != name {
+			t.Errorf("Wrong client certificate. Got: %s, expected: %s", body, name)
+		}
+	}
+	checkExpiry()
+
+	failing := trust.CertificateFunc(func() (*tls.Certificate, error) {
+		return nil, errors.New("no certificate")
+	})
+	if _, err := trust.New().ClientCertificateProvider(failing).Transport(nil); err == nil {
+		t.Error("Expected error from certificate provider.")
+	}
+}
+
+func TestConfig_ClientsCollected(t *testing.T) {
+	cfg := trust.New()
+	collected := make(chan struct{}, 10)
+	for i := 0; i < 10; i++ {
+		client, err := cfg.Client(nil)
+		if err != nil {
+			t.Fatal("Got unexpected error:", err)
+		}
+		next := client.Transport.(interface{ Unwrap() http.RoundTripper }).Unwrap()
+		runtime.SetFinalizer(next.(*http.Transport), func(*http.Transport) {
+			collected <- struct{}{}
+		})
+	}
+	deadline := time.After(5 * time.Second)
+	for count := 0; count < 10; {
+		runtime.GC()
+		select {
+		case <-collected:
+			count++
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Transports of clients are kept by config.")
+		}
+	}
+}